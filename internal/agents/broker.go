@@ -0,0 +1,729 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/events"
+	"github.com/pingplex/pingplex/internal/scheduler"
+	"github.com/pingplex/pingplex/internal/targets"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAssignmentTimeout = 2 * time.Minute
+	outboxSize               = 1000
+	// workerGrace is how long a worker is kept after its poll ended
+	workerGrace = 30 * time.Second
+	// maintainInterval is how often departed workers and expired jobs are handled
+	maintainInterval = time.Second
+	// pollInterval is how often a waiting poll checks the shared queue
+	pollInterval = time.Second
+
+	completedChannel = workKeyPrefix + "completed"
+)
+
+type outgoing struct {
+	workerID   gocql.UUID
+	assignment Assignment
+}
+
+// completion is published to the replica waiting for an assignment, with
+// the result or the error the assignment failed with.
+type completion struct {
+	AssignmentID gocql.UUID     `json:"assignmentId"`
+	Result       checker.Result `json:"result"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// waitingJob is a dispatched job until its assignment completes, fails or
+// expires. The callback is nil when nothing waits for the outcome.
+type waitingJob struct {
+	job       scheduler.Job
+	done      func(scheduler.Report)
+	expiresAt time.Time
+}
+
+// Broker distributes the dispatched checks between the agents polling for work.
+//
+// A check goes to an active agent supporting the target type and serving the
+// check location. Among them, the agent with the highest rendezvous hash of
+// the target is preferred, so targets stick to agents and only the work of
+// joining or leaving agents moves. Agents that stop polling leave, and their
+// queued work is handed to the others. Checks no agent can take are refused
+// and run by the server.
+//
+// The broker reports the lag of the checks handed to agents, and the checks
+// expiring before an agent ran them as missed.
+//
+// With Redis, the work is shared between replicas, so agents may poll any of
+// them.
+type Broker struct {
+	config   Config
+	versions versionPolicy
+
+	store   workStore
+	redis   *redis.Client
+	targets *targets.Service
+	events  *events.Service
+	tracker *scheduler.Tracker
+	outbox  chan outgoing
+	started time.Time
+
+	mu      sync.Mutex
+	workers map[gocql.UUID]worker
+	backlog map[gocql.UUID]int
+	gone    map[gocql.UUID]struct{}
+	waiting map[gocql.UUID]waitingJob
+	wakeups map[gocql.UUID]chan struct{}
+
+	logger *zap.Logger
+}
+
+var _ scheduler.RemoteDispatcher = (*Broker)(nil)
+
+func NewBroker(
+	config Config,
+	targets *targets.Service,
+	events *events.Service,
+	tracker *scheduler.Tracker,
+	redis *redis.Client,
+	logger *zap.Logger,
+) *Broker {
+	if config.AssignmentTimeout <= 0 {
+		config.AssignmentTimeout = defaultAssignmentTimeout
+	}
+
+	var store workStore = newMemoryStore()
+	if redis != nil {
+		store = &redisStore{redis: redis}
+	}
+
+	return &Broker{
+		config:   config,
+		versions: newVersionPolicy(config),
+
+		store:   store,
+		redis:   redis,
+		targets: targets,
+		events:  events,
+		tracker: tracker,
+		outbox:  make(chan outgoing, outboxSize),
+		started: time.Now(),
+
+		mu:      sync.Mutex{},
+		workers: map[gocql.UUID]worker{},
+		backlog: map[gocql.UUID]int{},
+		gone:    map[gocql.UUID]struct{}{},
+		waiting: map[gocql.UUID]waitingJob{},
+		wakeups: map[gocql.UUID]chan struct{}{},
+
+		logger: logger,
+	}
+}
+
+// Dispatch queues the job for an agent, it returns false when no agent can take it.
+func (b *Broker) Dispatch(job scheduler.Job) bool {
+	return b.dispatch(newAssignment(job), job.Done, true)
+}
+
+// Poll waits up to the given time for work of the agent and returns at most
+// limit assignments, never exceeding the agent's concurrency limit.
+//
+// Validating agents only receive the canary checks queued for them, agents
+// below the minimum version receive none.
+func (b *Broker) Poll(ctx context.Context, agent Agent, limit int, wait time.Duration) ([]Work, error) {
+	if !receivesWork(agent.Status) {
+		return nil, ErrNotActive
+	}
+	if err := b.versions.check(agent.Version); err != nil {
+		return nil, err
+	}
+
+	capacity := agent.Capabilities.MaxConcurrentChecks
+	if limit <= 0 || limit > capacity {
+		limit = capacity
+	}
+
+	deadline := time.Now().Add(wait)
+	if agent.Status == StatusActive {
+		if err := b.announce(ctx, newWorker(agent, deadline.Add(workerGrace))); err != nil {
+			return nil, err
+		}
+	}
+
+	wake := b.wakeup(agent.ID)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		work, err := b.take(ctx, agent, limit)
+		if err != nil || len(work) > 0 {
+			return work, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-timer.C:
+			return nil, nil
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Diagnose asks the agent to collect the diagnostics of the failed check of
+// the incident, it returns ErrNotPolling when the agent cannot receive them.
+func (b *Broker) Diagnose(
+	ctx context.Context,
+	agentID, incidentID gocql.UUID,
+	target checker.Target,
+	checkTime time.Time,
+) error {
+	now := time.Now()
+	if !b.polling(agentID, now) {
+		return ErrNotPolling
+	}
+
+	b.send(ctx, agentID, Assignment{
+		ID:            gocql.MustRandomUUID(),
+		TargetID:      target.ID,
+		Type:          target.Type,
+		Kind:          scheduler.KindDiagnostics,
+		ScheduledAt:   now,
+		Interval:      0,
+		Location:      "",
+		ExcludeAgents: nil,
+		Behind:        false,
+		IncidentID:    incidentID,
+		FailedAt:      checkTime,
+	})
+
+	return nil
+}
+
+// accepts reports whether the agent may receive work.
+func (b *Broker) accepts(agent Agent) bool {
+	return receivesWork(agent.Status) && b.versions.check(agent.Version) == nil
+}
+
+// receivesWork reports whether agents with the status may poll for work.
+func receivesWork(status Status) bool {
+	return status == StatusActive || status == StatusValidating
+}
+
+// Complete marks the assignment of the agent done and passes the result to
+// the job waiting for it, on whichever replica it waits.
+func (b *Broker) Complete(ctx context.Context, agentID, assignmentID gocql.UUID, result checker.Result) error {
+	if _, err := b.store.complete(ctx, agentID, assignmentID); err != nil {
+		return err
+	}
+
+	if b.done(assignmentID, result) || b.redis == nil {
+		return nil
+	}
+
+	return b.publish(ctx, completion{AssignmentID: assignmentID, Result: result, Error: ""})
+}
+
+func (b *Broker) publish(ctx context.Context, c completion) error {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode completion: %w", err)
+	}
+	if pubErr := b.redis.Publish(ctx, completedChannel, payload).Err(); pubErr != nil {
+		return fmt.Errorf("failed to publish completion: %w", pubErr)
+	}
+
+	return nil
+}
+
+// Run delivers the queued work and handles departed agents until the context
+// is canceled.
+func (b *Broker) Run(ctx context.Context) {
+	unsubscribe := b.events.Subscribe(b.onEvent)
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Go(func() { b.listen(ctx) })
+
+	ticker := time.NewTicker(maintainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case o := <-b.outbox:
+			b.deliver(ctx, o)
+		case now := <-ticker.C:
+			b.maintain(ctx, now)
+		}
+	}
+}
+
+// onEvent drops agents that are no longer active, their work moves on the
+// next maintenance.
+func (b *Broker) onEvent(event events.Event) {
+	change, ok := event.Data.(StatusChange)
+	if event.Type != events.TypeAgentStatusChanged || !ok || change.To == StatusActive {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.gone[event.AgentID] = struct{}{}
+}
+
+// send queues the assignment for the agent, whichever agent the target would
+// go to.
+func (b *Broker) send(ctx context.Context, agentID gocql.UUID, a Assignment) {
+	b.deliver(ctx, outgoing{workerID: agentID, assignment: a})
+}
+
+// polling reports whether the agent polled for work recently.
+func (b *Broker) polling(agentID gocql.UUID, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w, ok := b.workers[agentID]
+	return ok && now.Before(w.Until)
+}
+
+// assignment returns the assignment handed to the agent, until its result
+// is reported.
+func (b *Broker) assignment(ctx context.Context, agentID, assignmentID gocql.UUID) (Assignment, bool, error) {
+	return b.store.ticket(ctx, agentID, assignmentID)
+}
+
+// orphan stands in for the assignment of a result checked before the server
+// started: without Redis the assignments do not survive a restart, so the
+// results agents spooled through it would be lost. The result is taken as a
+// scheduled run when the agent could have been assigned the target.
+func (b *Broker) orphan(
+	ctx context.Context,
+	agent Agent,
+	assignmentID gocql.UUID,
+	result checker.Result,
+) (Assignment, bool, error) {
+	if b.redis != nil || !result.CheckTime.Before(b.started) || result.CheckTime.Before(b.started.Add(-SubmissionTTL)) {
+		return Assignment{}, false, nil
+	}
+
+	target, err := b.targets.Get(ctx, result.TargetID)
+	if errors.Is(err, targets.ErrNotFound) {
+		return Assignment{}, false, nil
+	}
+	if err != nil {
+		return Assignment{}, false, fmt.Errorf("failed to load target: %w", err)
+	}
+
+	a := Assignment{
+		ID:            assignmentID,
+		TargetID:      target.ID,
+		Type:          target.Type,
+		Kind:          scheduler.KindScheduled,
+		ScheduledAt:   result.CheckTime,
+		Interval:      0,
+		Location:      "",
+		ExcludeAgents: nil,
+		Behind:        false,
+		IncidentID:    gocql.UUID{},
+		FailedAt:      time.Time{},
+	}
+	w := newWorker(agent, time.Time{})
+	if len(target.Locations) == 0 {
+		return a, w.accepts(a), nil
+	}
+	for _, location := range target.Locations {
+		a.Location = location
+		if w.accepts(a) {
+			return a, true, nil
+		}
+	}
+
+	return Assignment{}, false, nil
+}
+
+// release frees the capacity of the agent held by the assignment.
+func (b *Broker) release(ctx context.Context, agentID, assignmentID gocql.UUID) error {
+	_, err := b.store.complete(ctx, agentID, assignmentID)
+	return err
+}
+
+// dispatch queues the assignment for the preferred worker. With track set,
+// the job is followed until the assignment completes, so its expiry is
+// reported; work moved between agents is followed by the original dispatch.
+func (b *Broker) dispatch(a Assignment, done func(scheduler.Report), track bool) bool {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w, ok := b.pick(a, now)
+	if !ok {
+		return false
+	}
+
+	select {
+	case b.outbox <- outgoing{workerID: w.ID, assignment: a}:
+	default:
+		return false
+	}
+
+	b.backlog[w.ID]++
+	if track {
+		b.waiting[a.ID] = waitingJob{
+			job:       a.job(),
+			done:      done,
+			expiresAt: now.Add(2 * b.config.AssignmentTimeout), //nolint:mnd // queued, then running
+		}
+	}
+
+	return true
+}
+
+// pick returns the worker preferred for the assignment among those that can
+// take it.
+func (b *Broker) pick(a Assignment, now time.Time) (worker, bool) {
+	var (
+		best      worker
+		bestScore uint64
+		found     bool
+	)
+	for _, w := range b.workers {
+		if !now.Before(w.Until) || !w.accepts(a) || b.backlog[w.ID] >= backlogLimit(w) {
+			continue
+		}
+		if _, gone := b.gone[w.ID]; gone {
+			continue
+		}
+
+		if score := rendezvous(w.ID, a); !found || score > bestScore {
+			best, bestScore, found = w, score, true
+		}
+	}
+
+	return best, found
+}
+
+// backlogLimit is the number of assignments queued for a worker before the
+// next preferred one takes over.
+func backlogLimit(w worker) int {
+	return max(2*w.MaxConcurrentChecks, 1) //nolint:mnd // one batch running, one waiting
+}
+
+func rendezvous(workerID gocql.UUID, a Assignment) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(workerID.Bytes())
+	_, _ = h.Write(a.TargetID.Bytes())
+	_, _ = h.Write([]byte(a.Location))
+
+	return h.Sum64()
+}
+
+func (b *Broker) deliver(ctx context.Context, o outgoing) {
+	queued, err := b.store.push(ctx, o.workerID, o.assignment, b.config.AssignmentTimeout)
+	if err != nil {
+		b.logger.Error("failed to queue check", zap.Stringer("agent_id", o.workerID), zap.Error(err))
+		b.fail(ctx, o.assignment.ID, err)
+		return
+	}
+
+	b.mu.Lock()
+	b.backlog[o.workerID] = queued
+	wake := b.wakeups[o.workerID]
+	b.mu.Unlock()
+
+	if wake != nil {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *Broker) announce(ctx context.Context, w worker) error {
+	if err := b.store.announce(ctx, w); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.workers[w.ID]; !ok {
+		b.logger.Info("agent joined", zap.Stringer("agent_id", w.ID), zap.String("location", w.Location))
+	}
+	b.workers[w.ID] = w
+	delete(b.gone, w.ID)
+
+	return nil
+}
+
+func (b *Broker) wakeup(id gocql.UUID) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wake, ok := b.wakeups[id]
+	if !ok {
+		wake = make(chan struct{}, 1)
+		b.wakeups[id] = wake
+	}
+
+	return wake
+}
+
+// take hands the queued work to the agent within its free capacity.
+func (b *Broker) take(ctx context.Context, agent Agent, limit int) ([]Work, error) {
+	now := time.Now()
+
+	outstanding, err := b.store.outstanding(ctx, agent.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	free := min(limit, agent.Capabilities.MaxConcurrentChecks-outstanding)
+	if free <= 0 {
+		return nil, nil
+	}
+
+	items, err := b.store.pop(ctx, agent.ID, free)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	b.mu.Lock()
+	b.backlog[agent.ID] = max(b.backlog[agent.ID]-len(items), 0)
+	b.mu.Unlock()
+
+	work := make([]Work, 0, len(items))
+	for _, a := range items {
+		if w, ok := b.prepare(ctx, a, now); ok {
+			b.tracker.Started(a.job(), now)
+			work = append(work, w)
+		}
+	}
+
+	assigned := make([]Assignment, len(work))
+	for i, w := range work {
+		assigned[i] = w.Assignment
+	}
+	if len(assigned) > 0 {
+		if assignErr := b.store.assign(ctx, agent.ID, assigned, now.Add(b.config.AssignmentTimeout)); assignErr != nil {
+			return nil, assignErr
+		}
+	}
+
+	return work, nil
+}
+
+// prepare loads the target of the assignment, it returns false when the
+// check should no longer run.
+func (b *Broker) prepare(ctx context.Context, a Assignment, now time.Time) (Work, bool) {
+	if a.Kind == scheduler.KindScheduled && a.Interval > 0 && now.After(a.ScheduledAt.Add(a.Interval)) {
+		// The next run is due already.
+		b.tracker.Missed(a.job(), scheduler.MissExpired, missedRuns(a, now), now)
+		b.fail(ctx, a.ID, ErrAssignmentExpired)
+		return Work{}, false
+	}
+
+	target, err := b.targets.CheckTarget(ctx, a.TargetID)
+	if err != nil {
+		if !errors.Is(err, targets.ErrNotFound) {
+			b.logger.Error("failed to load target", zap.Stringer("target_id", a.TargetID), zap.Error(err))
+		}
+		b.fail(ctx, a.ID, err)
+		return Work{}, false
+	}
+	if !target.Enabled && a.Kind != scheduler.KindManual && a.Kind != scheduler.KindCanary &&
+		a.Kind != scheduler.KindDiagnostics {
+		b.fail(ctx, a.ID, scheduler.ErrDisabled)
+		return Work{}, false
+	}
+
+	return Work{Assignment: a, Target: target.CheckTarget()}, true
+}
+
+// missedRuns returns the number of scheduled runs of the assignment that
+// were due by now without it running.
+func missedRuns(a Assignment, now time.Time) int {
+	if a.Interval <= 0 {
+		return 1
+	}
+	return max(int(now.Sub(a.ScheduledAt)/a.Interval), 1)
+}
+
+// listen passes the completions of other replicas to the local waiting jobs.
+func (b *Broker) listen(ctx context.Context) {
+	if b.redis == nil {
+		return
+	}
+
+	sub := b.redis.Subscribe(ctx, completedChannel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			var c completion
+			if err := json.Unmarshal([]byte(msg.Payload), &c); err != nil {
+				b.logger.Warn("failed to decode completion", zap.Error(err))
+				continue
+			}
+			if c.Error != "" {
+				b.failed(c.AssignmentID, errors.New(c.Error)) //nolint:err113 // reported by another replica
+				continue
+			}
+			b.done(c.AssignmentID, c.Result)
+		}
+	}
+}
+
+// done passes the result to the job waiting for the assignment, it reports
+// whether the job waits on this replica.
+func (b *Broker) done(assignmentID gocql.UUID, result checker.Result) bool {
+	b.mu.Lock()
+	waiting, ok := b.waiting[assignmentID]
+	delete(b.waiting, assignmentID)
+	b.mu.Unlock()
+
+	if ok && waiting.done != nil {
+		waiting.done(scheduler.Report{Location: waiting.job.Location, Result: result, Err: nil})
+	}
+
+	return ok
+}
+
+// fail reports the failure to the job waiting for the assignment, on
+// whichever replica it waits.
+func (b *Broker) fail(ctx context.Context, assignmentID gocql.UUID, err error) {
+	if b.failed(assignmentID, err) || b.redis == nil {
+		return
+	}
+
+	if pubErr := b.publish(ctx, completion{AssignmentID: assignmentID, Result: checker.Result{}, Error: err.Error()}); pubErr != nil {
+		b.logger.Warn("failed to report failed check", zap.Stringer("assignment_id", assignmentID), zap.Error(pubErr))
+	}
+}
+
+// failed reports the failure to the job waiting for the assignment, it
+// reports whether the job waits on this replica.
+func (b *Broker) failed(assignmentID gocql.UUID, err error) bool {
+	b.mu.Lock()
+	waiting, ok := b.waiting[assignmentID]
+	delete(b.waiting, assignmentID)
+	b.mu.Unlock()
+
+	if ok && waiting.done != nil {
+		waiting.done(scheduler.Report{Location: waiting.job.Location, Err: err}) //nolint:exhaustruct // not run
+	}
+
+	return ok
+}
+
+// maintain refreshes the workers, moves the work of departed ones and
+// expires the jobs waiting for too long.
+func (b *Broker) maintain(ctx context.Context, now time.Time) {
+	workers, err := b.store.workers(ctx)
+	if err != nil {
+		b.logger.Warn("failed to load agents polling for work", zap.Error(err))
+		return
+	}
+
+	var departed []gocql.UUID
+	var expired []waitingJob
+
+	b.mu.Lock()
+	b.workers = make(map[gocql.UUID]worker, len(workers))
+	for _, w := range workers {
+		b.workers[w.ID] = w
+		if !now.Before(w.Until) {
+			departed = append(departed, w.ID)
+		}
+	}
+	for id := range b.gone {
+		departed = append(departed, id)
+	}
+	b.gone = map[gocql.UUID]struct{}{}
+	for id, waiting := range b.waiting {
+		if now.After(waiting.expiresAt) {
+			expired = append(expired, waiting)
+			delete(b.waiting, id)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, id := range departed {
+		b.leave(ctx, id)
+	}
+	for _, waiting := range expired {
+		// Handed to an agent that never reported, or lost with its queue.
+		b.tracker.Missed(waiting.job, scheduler.MissExpired, 1, now)
+		if waiting.done != nil {
+			waiting.done(scheduler.Report{Location: waiting.job.Location, Err: ErrAssignmentExpired}) //nolint:exhaustruct // not run
+		}
+	}
+}
+
+// leave removes the worker and hands its queued work to the others.
+func (b *Broker) leave(ctx context.Context, id gocql.UUID) {
+	removed, err := b.store.remove(ctx, id)
+	if err != nil {
+		b.logger.Warn("failed to remove agent", zap.Stringer("agent_id", id), zap.Error(err))
+		return
+	}
+
+	b.mu.Lock()
+	delete(b.workers, id)
+	delete(b.backlog, id)
+	delete(b.wakeups, id)
+	b.mu.Unlock()
+
+	if !removed {
+		// Another replica took care of it.
+		return
+	}
+
+	items, err := b.store.pop(ctx, id, -1)
+	if err != nil {
+		b.logger.Warn("failed to take work of departed agent", zap.Stringer("agent_id", id), zap.Error(err))
+		return
+	}
+
+	moved := 0
+	for _, a := range items {
+		// Canary checks and diagnostics are meant for this agent only.
+		if a.Kind != scheduler.KindCanary && a.Kind != scheduler.KindDiagnostics && b.dispatch(a, nil, false) {
+			moved++
+		}
+	}
+
+	b.logger.Info(
+		"agent left",
+		zap.Stringer("agent_id", id),
+		zap.Int("moved", moved),
+		zap.Int("dropped", len(items)-moved),
+	)
+}
@@ -0,0 +1,503 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/scheduler"
+	"github.com/pingplex/pingplex/internal/targets"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCanaryInterval = time.Minute
+	defaultAuditInterval  = 15 * time.Minute
+	// canaryWitnesses is the number of trusted agents checking the reference target with the candidate
+	canaryWitnesses = 2
+	// canaryTick is how often the answers of the running rounds are collected
+	canaryTick = time.Second
+
+	canaryLockKey   = "pingplex:agents:canary"
+	canaryKeyPrefix = "pingplex:agents:canary:"
+)
+
+// canaryAnswer is what an agent reported for a canary assignment, the result
+// is nil until it does.
+type canaryAnswer struct {
+	AgentID gocql.UUID      `json:"agentId"`
+	Result  *checker.Result `json:"result,omitempty"`
+}
+
+// round is a canary check of one candidate agent: the candidate, some
+// trusted agents and the server check the same reference target.
+type round struct {
+	candidate   Agent
+	target      checker.Target
+	assignments map[gocql.UUID]gocql.UUID // assignment ID to agent ID
+	server      atomic.Pointer[checker.Result]
+	deadline    time.Time
+}
+
+// Canary validates agents by running canary checks against reference targets
+// and comparing the results with the consensus of the server and trusted
+// agents. The outcomes are scored by the agents service, which promotes,
+// flags and suspends agents.
+//
+// Validating agents are checked every CanaryInterval and active agents every
+// AuditInterval. With Redis, one replica starts the rounds per interval and
+// agents may answer through any replica.
+type Canary struct {
+	config  Config
+	targets []gocql.UUID
+
+	agents    *Service
+	broker    *Broker
+	refs      *targets.Service
+	checks    *checker.Service
+	redis     *redis.Client
+	answersMu sync.Mutex
+	answers   map[gocql.UUID]canaryAnswer
+
+	rounds map[gocql.UUID]*round
+	wg     sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+func NewCanary(
+	config Config,
+	agents *Service,
+	broker *Broker,
+	refs *targets.Service,
+	checks *checker.Service,
+	redis *redis.Client,
+	logger *zap.Logger,
+) *Canary {
+	if config.CanaryInterval <= 0 {
+		config.CanaryInterval = defaultCanaryInterval
+	}
+	if config.AuditInterval <= 0 {
+		config.AuditInterval = defaultAuditInterval
+	}
+	if config.AssignmentTimeout <= 0 {
+		config.AssignmentTimeout = defaultAssignmentTimeout
+	}
+
+	ids := make([]gocql.UUID, 0, len(config.CanaryTargets))
+	for _, raw := range config.CanaryTargets {
+		id, err := gocql.ParseUUID(raw)
+		if err != nil {
+			logger.Warn("invalid canary target", zap.String("target_id", raw))
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return &Canary{
+		config:  config,
+		targets: ids,
+
+		agents:    agents,
+		broker:    broker,
+		refs:      refs,
+		checks:    checks,
+		redis:     redis,
+		answersMu: sync.Mutex{},
+		answers:   map[gocql.UUID]canaryAnswer{},
+
+		rounds: map[gocql.UUID]*round{},
+		wg:     sync.WaitGroup{},
+
+		logger: logger,
+	}
+}
+
+// Run starts and scores canary rounds until the context is canceled.
+func (c *Canary) Run(ctx context.Context) {
+	if len(c.targets) == 0 {
+		return
+	}
+	defer c.wg.Wait()
+
+	ticker := time.NewTicker(canaryTick)
+	defer ticker.Stop()
+
+	var next time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !now.Before(next) {
+				next = now.Add(c.config.CanaryInterval)
+				c.start(ctx, now)
+			}
+			c.score(ctx, now)
+		}
+	}
+}
+
+// Report stores the result of a canary assignment, it reports whether the
+// assignment is a canary check of the agent.
+func (c *Canary) Report(ctx context.Context, agentID, assignmentID gocql.UUID, result checker.Result) (bool, error) {
+	if c.redis == nil {
+		c.answersMu.Lock()
+		defer c.answersMu.Unlock()
+
+		answer, ok := c.answers[assignmentID]
+		if !ok || answer.AgentID != agentID {
+			return false, nil
+		}
+		answer.Result = &result
+		c.answers[assignmentID] = answer
+		return true, nil
+	}
+
+	key := canaryKeyPrefix + assignmentID.String()
+	raw, err := c.redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get canary assignment: %w", err)
+	}
+
+	var answer canaryAnswer
+	if decErr := json.Unmarshal(raw, &answer); decErr != nil || answer.AgentID != agentID {
+		return false, nil //nolint:nilerr // not a canary of the agent
+	}
+
+	answer.Result = &result
+	payload, err := json.Marshal(answer)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode canary answer: %w", err)
+	}
+	if setErr := c.redis.SetArgs(ctx, key, payload, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err(); setErr != nil &&
+		!errors.Is(setErr, redis.Nil) {
+		return false, fmt.Errorf("failed to store canary answer: %w", setErr)
+	}
+
+	return true, nil
+}
+
+// start begins a round for each agent due for a canary check.
+func (c *Canary) start(ctx context.Context, now time.Time) {
+	if c.redis != nil {
+		// The lock expires slightly before the next run of any replica.
+		locked, err := c.redis.SetNX(ctx, canaryLockKey, 1, c.config.CanaryInterval*9/10).Result() //nolint:mnd // see above
+		if err != nil {
+			c.logger.Warn("failed to lock canary checks", zap.Error(err))
+			return
+		}
+		if !locked {
+			return
+		}
+	}
+
+	validating, err := c.agents.List(ctx, StatusValidating)
+	if err != nil {
+		c.logger.Error("failed to load validating agents", zap.Error(err))
+		return
+	}
+	active, err := c.agents.List(ctx, StatusActive)
+	if err != nil {
+		c.logger.Error("failed to load active agents", zap.Error(err))
+		return
+	}
+
+	for _, agent := range validating {
+		if now.Sub(agent.Trust.CheckedAt) >= c.config.CanaryInterval {
+			c.begin(ctx, agent, active, now)
+		}
+	}
+	for _, agent := range active {
+		if now.Sub(agent.Trust.CheckedAt) >= c.config.AuditInterval {
+			c.begin(ctx, agent, active, now)
+		}
+	}
+}
+
+// begin queues the canary check for the candidate and the witnesses, and
+// runs it on the server.
+func (c *Canary) begin(ctx context.Context, candidate Agent, active []Agent, now time.Time) {
+	// Outdated agents would not pick it up.
+	if _, running := c.rounds[candidate.ID]; running || !c.broker.accepts(candidate) {
+		return
+	}
+	if c.redis != nil {
+		// The round may run on the replica that started the previous interval.
+		fresh, err := c.redis.SetNX(ctx, canaryKeyPrefix+"agent:"+candidate.ID.String(), 1, c.config.AssignmentTimeout).Result()
+		if err != nil {
+			c.logger.Warn("failed to lock canary round", zap.Stringer("agent_id", candidate.ID), zap.Error(err))
+			return
+		}
+		if !fresh {
+			return
+		}
+	}
+
+	target, ok := c.reference(ctx, candidate)
+	if !ok {
+		return
+	}
+
+	r := &round{
+		candidate:   candidate,
+		target:      target,
+		assignments: map[gocql.UUID]gocql.UUID{},
+		server:      atomic.Pointer[checker.Result]{},
+		deadline:    now.Add(c.config.AssignmentTimeout),
+	}
+
+	participants := append([]Agent{candidate}, c.witnesses(candidate, target.Type, active, now)...)
+	for _, agent := range participants {
+		a := Assignment{
+			ID:            gocql.MustRandomUUID(),
+			TargetID:      target.ID,
+			Type:          target.Type,
+			Kind:          scheduler.KindCanary,
+			ScheduledAt:   now,
+			Interval:      0,
+			Location:      "",
+			ExcludeAgents: nil,
+			Behind:        false,
+			IncidentID:    gocql.UUID{},
+			FailedAt:      time.Time{},
+		}
+		if err := c.track(ctx, a.ID, agent.ID); err != nil {
+			c.logger.Error("failed to track canary check", zap.Stringer("agent_id", agent.ID), zap.Error(err))
+			c.forget(ctx, r)
+			return
+		}
+
+		r.assignments[a.ID] = agent.ID
+		c.broker.send(ctx, agent.ID, a)
+	}
+
+	c.wg.Go(func() {
+		result := c.checks.Check(ctx, target)
+		r.server.Store(&result)
+	})
+	c.rounds[candidate.ID] = r
+
+	c.logger.Debug(
+		"canary check started",
+		zap.Stringer("agent_id", candidate.ID),
+		zap.Stringer("target_id", target.ID),
+		zap.Int("witnesses", len(participants)-1),
+	)
+}
+
+// reference picks a reference target the candidate can check.
+func (c *Canary) reference(ctx context.Context, candidate Agent) (checker.Target, bool) {
+	for _, i := range rand.Perm(len(c.targets)) { //nolint:gosec // not security sensitive
+		target, err := c.refs.CheckTarget(ctx, c.targets[i])
+		if err != nil {
+			c.logger.Warn("failed to load canary target", zap.Stringer("target_id", c.targets[i]), zap.Error(err))
+			continue
+		}
+
+		if slices.Contains(candidate.Capabilities.CheckTypes, string(target.Type)) {
+			return target.CheckTarget(), true
+		}
+	}
+
+	return checker.Target{}, false //nolint:exhaustruct // no target
+}
+
+// witnesses picks trusted agents polling for work that can check the type.
+func (c *Canary) witnesses(candidate Agent, t checker.Type, active []Agent, now time.Time) []Agent {
+	var picked []Agent
+	for _, i := range rand.Perm(len(active)) { //nolint:gosec // not security sensitive
+		agent := active[i]
+		if agent.ID == candidate.ID || agent.Trust.Flagged || agent.Trust.Streak < 0 ||
+			!slices.Contains(agent.Capabilities.CheckTypes, string(t)) || !c.broker.polling(agent.ID, now) {
+			continue
+		}
+
+		picked = append(picked, agent)
+		if len(picked) == canaryWitnesses {
+			break
+		}
+	}
+
+	return picked
+}
+
+// score scores the rounds answered by the candidate once the witnesses
+// answered too or the deadline passed.
+func (c *Canary) score(ctx context.Context, now time.Time) {
+	for id, r := range c.rounds {
+		answers, err := c.collect(ctx, r)
+		if err != nil {
+			c.logger.Warn("failed to collect canary answers", zap.Stringer("agent_id", id), zap.Error(err))
+			continue
+		}
+
+		server := r.server.Load()
+		expired := !now.Before(r.deadline)
+		candidate, answered := answers[id]
+		if (!answered || server == nil || len(answers) < len(r.assignments)) && !expired {
+			continue
+		}
+
+		delete(c.rounds, id)
+		c.forget(ctx, r)
+		if !answered || server == nil {
+			c.logger.Info("canary check not answered", zap.Stringer("agent_id", id))
+			continue
+		}
+
+		votes := []checker.Result{*server}
+		for agentID, result := range answers {
+			if agentID != id {
+				votes = append(votes, result)
+			}
+		}
+		passed := consensus(candidate, votes)
+
+		agent, scoreErr := c.agents.Score(ctx, id, passed)
+		if scoreErr != nil {
+			c.logger.Error("failed to score agent", zap.Stringer("agent_id", id), zap.Error(scoreErr))
+			continue
+		}
+
+		c.logger.Info(
+			"canary check scored",
+			zap.Stringer("agent_id", id),
+			zap.Stringer("target_id", r.target.ID),
+			zap.Bool("passed", passed),
+			zap.Int("votes", len(votes)),
+			zap.Int("streak", agent.Trust.Streak),
+		)
+	}
+}
+
+// consensus reports whether the result agrees with most of the trusted
+// votes, the first of which is the server's and breaks ties.
+func consensus(result checker.Result, votes []checker.Result) bool {
+	agreeing := 0
+	for _, vote := range votes {
+		if agree(result, vote) {
+			agreeing++
+		}
+	}
+
+	if 2*agreeing == len(votes) { //nolint:mnd // a tie
+		return agree(result, votes[0])
+	}
+
+	return 2*agreeing > len(votes) //nolint:mnd // a majority
+}
+
+// agree reports whether both results saw the target in the same state.
+func agree(a, b checker.Result) bool {
+	healthy := func(r checker.Result) bool {
+		return r.Status == checker.StatusUp || r.Status == checker.StatusDegraded
+	}
+
+	if healthy(a) != healthy(b) {
+		return false
+	}
+
+	return a.ResponseCode == 0 || b.ResponseCode == 0 || a.ResponseCode == b.ResponseCode
+}
+
+func (c *Canary) track(ctx context.Context, assignmentID, agentID gocql.UUID) error {
+	answer := canaryAnswer{AgentID: agentID, Result: nil}
+	if c.redis == nil {
+		c.answersMu.Lock()
+		defer c.answersMu.Unlock()
+
+		c.answers[assignmentID] = answer
+		return nil
+	}
+
+	payload, err := json.Marshal(answer)
+	if err != nil {
+		return fmt.Errorf("failed to encode canary assignment: %w", err)
+	}
+	// Answers may come until the deadline.
+	ttl := 2 * c.config.AssignmentTimeout //nolint:mnd // see above
+	if setErr := c.redis.Set(ctx, canaryKeyPrefix+assignmentID.String(), payload, ttl).Err(); setErr != nil {
+		return fmt.Errorf("failed to store canary assignment: %w", setErr)
+	}
+
+	return nil
+}
+
+// collect returns the results reported for the round by agent ID.
+func (c *Canary) collect(ctx context.Context, r *round) (map[gocql.UUID]checker.Result, error) {
+	results := make(map[gocql.UUID]checker.Result, len(r.assignments))
+
+	if c.redis == nil {
+		c.answersMu.Lock()
+		defer c.answersMu.Unlock()
+
+		for assignmentID, agentID := range r.assignments {
+			if answer := c.answers[assignmentID]; answer.Result != nil {
+				results[agentID] = *answer.Result
+			}
+		}
+		return results, nil
+	}
+
+	ids := make([]gocql.UUID, 0, len(r.assignments))
+	keys := make([]string, 0, len(r.assignments))
+	for assignmentID := range r.assignments {
+		ids = append(ids, assignmentID)
+		keys = append(keys, canaryKeyPrefix+assignmentID.String())
+	}
+
+	values, err := c.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get canary answers: %w", err)
+	}
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var answer canaryAnswer
+		if decErr := json.Unmarshal([]byte(raw), &answer); decErr != nil || answer.Result == nil {
+			continue
+		}
+		results[r.assignments[ids[i]]] = *answer.Result
+	}
+
+	return results, nil
+}
+
+func (c *Canary) forget(ctx context.Context, r *round) {
+	if c.redis == nil {
+		c.answersMu.Lock()
+		defer c.answersMu.Unlock()
+
+		for assignmentID := range r.assignments {
+			delete(c.answers, assignmentID)
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(r.assignments))
+	for assignmentID := range r.assignments {
+		keys = append(keys, canaryKeyPrefix+assignmentID.String())
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := c.redis.Del(ctx, keys...).Err(); err != nil {
+		c.logger.Warn("failed to forget canary check", zap.Stringer("agent_id", r.candidate.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,42 @@
+package agents
+
+import "time"
+
+// Config holds the configuration for the agents module.
+type Config struct {
+	// SignatureWindow is how far a signed request timestamp may be from the server time
+	SignatureWindow time.Duration
+	// HeartbeatTimeout is how long an active agent may go without a heartbeat before it is inactive
+	HeartbeatTimeout time.Duration
+	// AssignmentTimeout is how long an agent has to report the result of a check handed to it
+	AssignmentTimeout time.Duration
+	// GRPCAddress is where the control stream is served, empty disables it
+	GRPCAddress string
+	// GRPCTLSCert and GRPCTLSKey are the PEM files of the control stream
+	// certificate, required unless GRPCPlaintext is set
+	GRPCTLSCert string
+	GRPCTLSKey  string
+	// GRPCPlaintext serves the control stream without TLS, for a terminating proxy or local setups
+	GRPCPlaintext bool
+	// MinVersion is the oldest agent version receiving work, empty for any
+	MinVersion string
+	// RecommendedVersion is the version outdated agents are asked to upgrade to, empty for none
+	RecommendedVersion string
+	// AdminTokens maps the names of the admins to the bearer tokens of the
+	// agent admin API, empty disables the admin API
+	AdminTokens map[string]string
+
+	// CanaryTargets are the IDs of the reference targets agents are checked
+	// against, empty disables canary checks
+	CanaryTargets []string
+	// CanaryInterval is how often a validating agent runs a canary check
+	CanaryInterval time.Duration
+	// AuditInterval is how often an active agent runs a canary check
+	AuditInterval time.Duration
+	// PromoteAfter is the number of canary checks passed in a row activating a validating agent
+	PromoteAfter int
+	// FlagAfter is the number of canary checks failed in a row flagging an agent
+	FlagAfter int
+	// SuspendAfter is the number of canary checks failed in a row suspending an agent
+	SuspendAfter int
+}
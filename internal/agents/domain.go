@@ -0,0 +1,135 @@
+package agents
+
+import (
+	"net"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Status is the lifecycle state of an agent.
+type Status string
+
+const (
+	// StatusValidating agents are registered and await approval
+	StatusValidating Status = "validating"
+	StatusActive     Status = "active"
+	StatusInactive   Status = "inactive"
+	StatusSuspended  Status = "suspended"
+	StatusRejected   Status = "rejected"
+	// StatusDecommissioned agents are retired for good
+	StatusDecommissioned Status = "decommissioned"
+)
+
+// Capabilities describes the checks an agent can run.
+type Capabilities struct {
+	CheckTypes          []string
+	Regions             []string
+	MaxConcurrentChecks int
+}
+
+// Trust is the record of the canary checks of an agent.
+type Trust struct {
+	Passed int
+	Failed int
+	// Streak counts consecutive passes when positive, failures when negative
+	Streak int
+	// Flagged is set while the agent keeps diverging from the consensus
+	Flagged   bool
+	CheckedAt time.Time
+}
+
+// Agent is a remote probe running checks on behalf of the server.
+type Agent struct {
+	ID       gocql.UUID
+	Name     string
+	Version  string
+	Location string
+	IP       net.IP
+	// PublicKey is the base64 encoded Ed25519 key the agent signs requests with
+	PublicKey     string
+	Status        Status
+	Capabilities  Capabilities
+	LastHeartbeat time.Time
+	RegisteredAt  time.Time
+	Tags          []string
+	Trust         Trust
+}
+
+// Registration is the data an agent submits to register.
+type Registration struct {
+	Name         string
+	Version      string
+	Location     string
+	IP           net.IP
+	PublicKey    string
+	Capabilities Capabilities
+	Tags         []string
+}
+
+// StatusChange is the data of agent status change events.
+type StatusChange struct {
+	From     Status `json:"from"`
+	To       Status `json:"to"`
+	Location string `json:"location"`
+	// LastHeartbeat is zero when the agent never sent one
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+}
+
+// Filter selects agents, empty fields match any.
+type Filter struct {
+	Status   Status
+	Location string
+	Tag      string
+	Version  string
+}
+
+// Action is an operator action on an agent.
+type Action string
+
+const (
+	ActionApprove      Action = "approve"
+	ActionReject       Action = "reject"
+	ActionSuspend      Action = "suspend"
+	ActionResume       Action = "resume"
+	ActionRetag        Action = "retag"
+	ActionRevalidate   Action = "revalidate"
+	ActionDecommission Action = "decommission"
+)
+
+// Operator identifies who requested an action and why.
+type Operator struct {
+	Actor  string
+	Reason string
+}
+
+// AuditEntry records an action on an agent.
+type AuditEntry struct {
+	AgentID gocql.UUID
+	Action  Action
+	Operator
+	OldStatus Status
+	NewStatus Status
+	// OldTags and NewTags are set on retags
+	OldTags []string
+	NewTags []string
+	At      time.Time
+}
+
+// VersionStatus tells how an agent version compares to the supported ones.
+type VersionStatus string
+
+const (
+	VersionCurrent VersionStatus = "current"
+	// VersionOutdated agents are below the recommended version
+	VersionOutdated VersionStatus = "outdated"
+	// VersionUnsupported agents are below the minimum version and receive no work
+	VersionUnsupported VersionStatus = "unsupported"
+)
+
+// VersionCount is the number of agents running a version.
+type VersionCount struct {
+	Version string
+	Agents  int
+	Status  VersionStatus
+}
@@ -0,0 +1,348 @@
+package agents
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/scheduler"
+)
+
+// CapabilitiesDTO describes the checks an agent can run.
+type CapabilitiesDTO struct {
+	// Supported check types
+	CheckTypes []string `json:"checkTypes" validate:"required,min=1,dive,required"`
+	// Regions the agent can check from
+	Regions []string `json:"regions,omitempty"`
+	// Checks the agent runs at once
+	MaxConcurrentChecks int `json:"maxConcurrentChecks" validate:"required,min=1,max=10000"`
+}
+
+// RegisterRequest is submitted by an agent to register.
+type RegisterRequest struct {
+	// Display name
+	Name string `json:"name" validate:"required,max=255"`
+	// Agent version
+	Version string `json:"version" validate:"required,max=64"`
+	// Region or country the agent runs in
+	Location string `json:"location" validate:"required,max=64"`
+	// Check capabilities
+	Capabilities CapabilitiesDTO `json:"capabilities"`
+	// Base64 encoded Ed25519 public key
+	PublicKey string `json:"publicKey" validate:"required,base64"`
+	// Free-form tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+// ActionRequest is the optional body of an action on an agent, recorded in
+// its audit trail with the admin taking it.
+type ActionRequest struct {
+	// Why the action was taken
+	Reason string `json:"reason,omitempty" validate:"max=1024"`
+}
+
+// RetagRequest replaces the tags of an agent.
+type RetagRequest struct {
+	ActionRequest
+
+	Tags []string `json:"tags" validate:"max=50,dive,required,max=64"`
+}
+
+// AuditEntryResponse is an action taken on an agent.
+type AuditEntryResponse struct {
+	// approve, reject, suspend, resume, retag, revalidate or decommission
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	OldStatus string    `json:"oldStatus"`
+	NewStatus string    `json:"newStatus"`
+	OldTags   []string  `json:"oldTags,omitempty"`
+	NewTags   []string  `json:"newTags,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// TrustResponse is the record of the canary checks of an agent.
+type TrustResponse struct {
+	// Canary checks agreeing with the consensus
+	Passed int `json:"passed"`
+	// Canary checks diverging from the consensus
+	Failed int `json:"failed"`
+	// Consecutive passes when positive, failures when negative
+	Streak int `json:"streak"`
+	// Set while the agent keeps diverging from the consensus
+	Flagged bool `json:"flagged"`
+	// Last scored canary check
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+}
+
+// AgentResponse is a registered agent.
+type AgentResponse struct {
+	ID            string          `json:"id"`
+	Name          string          `json:"name"`
+	Version       string          `json:"version"`
+	Location      string          `json:"location"`
+	IP            string          `json:"ip,omitempty"`
+	PublicKey     string          `json:"publicKey"`
+	Status        string          `json:"status"`
+	Capabilities  CapabilitiesDTO `json:"capabilities"`
+	LastHeartbeat *time.Time      `json:"lastHeartbeat,omitempty"`
+	RegisteredAt  time.Time       `json:"registeredAt"`
+	Tags          []string        `json:"tags"`
+	Trust         TrustResponse   `json:"trust"`
+}
+
+// HeartbeatRequest is the optional body of an agent heartbeat.
+type HeartbeatRequest struct {
+	// Version the agent runs, when it changed since it registered
+	Version string `json:"version,omitempty" validate:"omitempty,max=64"`
+}
+
+// UpgradeNotice asks an agent to upgrade.
+type UpgradeNotice struct {
+	// Set when the agent is below the minimum version and receives no work
+	Required bool `json:"required"`
+	// Oldest version receiving work, empty for any
+	MinimumVersion string `json:"minimumVersion,omitempty"`
+	// Version to upgrade to
+	RecommendedVersion string `json:"recommendedVersion"`
+	Message            string `json:"message"`
+}
+
+// HeartbeatResponse acknowledges an agent heartbeat.
+type HeartbeatResponse struct {
+	// Current agent status
+	Status string `json:"status"`
+	// Server time the heartbeat was recorded at
+	ServerTime time.Time `json:"serverTime"`
+	// Set when the agent version is outdated
+	Upgrade *UpgradeNotice `json:"upgrade,omitempty"`
+}
+
+// VersionCountResponse is the number of agents running a version.
+type VersionCountResponse struct {
+	Version string `json:"version"`
+	Agents  int    `json:"agents"`
+	// current, outdated, or unsupported when below the minimum version
+	Status string `json:"status"`
+}
+
+// AgentListResponse is a list of agents with their version distribution.
+type AgentListResponse struct {
+	Agents   []AgentResponse        `json:"agents"`
+	Versions []VersionCountResponse `json:"versions"`
+}
+
+// WorkItemResponse is a check assigned to an agent. Why the check runs stays
+// on the server, so agents cannot tell canary checks from the others.
+type WorkItemResponse struct {
+	// Assignment ID, reported back with the result
+	ID string `json:"id"`
+	// Planned start of the check
+	ScheduledAt time.Time `json:"scheduledAt"`
+	// Location the check runs for, empty for any
+	Location string `json:"location,omitempty"`
+	// Target to check with its credentials, in the checker's format
+	Target checker.Target `json:"target"`
+	// Diagnose asks for the failure diagnostics of the target instead of a check
+	Diagnose bool `json:"diagnose,omitempty"`
+}
+
+// WorkResponse holds the checks assigned to an agent, empty when none were
+// available before the poll timed out.
+type WorkResponse struct {
+	Items []WorkItemResponse `json:"items"`
+}
+
+// ResultItem is a check result uploaded by an agent.
+type ResultItem struct {
+	// Client generated ID, retries must reuse it
+	ID string `json:"id" validate:"required,uuid"`
+	// Assignment the check ran for
+	AssignmentID string `json:"assignmentId" validate:"required,uuid"`
+	// Check result in the checker's format
+	Result checker.Result `json:"result"`
+	// Failure diagnostics, reported for the diagnose items instead of a check result
+	Diagnostics *checker.Diagnostics `json:"diagnostics,omitempty"`
+}
+
+// SubmitResultsRequest is a batch of check results.
+type SubmitResultsRequest struct {
+	Results []ResultItem `json:"results" validate:"required,min=1,max=500,dive"`
+}
+
+// RejectedResult is a result that was not recorded.
+type RejectedResult struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+	// Retry is set when the result may be accepted later
+	Retry bool `json:"retry"`
+}
+
+// SubmitResultsResponse reports the outcome of each uploaded result.
+// Duplicates of recorded results are accepted.
+type SubmitResultsResponse struct {
+	Accepted []string         `json:"accepted"`
+	Rejected []RejectedResult `json:"rejected"`
+}
+
+func (r RegisterRequest) toRegistration(ip net.IP) Registration {
+	return Registration{
+		Name:      r.Name,
+		Version:   r.Version,
+		Location:  r.Location,
+		IP:        ip,
+		PublicKey: r.PublicKey,
+		Capabilities: Capabilities{
+			CheckTypes:          r.Capabilities.CheckTypes,
+			Regions:             r.Capabilities.Regions,
+			MaxConcurrentChecks: r.Capabilities.MaxConcurrentChecks,
+		},
+		Tags: r.Tags,
+	}
+}
+
+func newAgentResponse(a Agent) AgentResponse {
+	resp := AgentResponse{
+		ID:        a.ID.String(),
+		Name:      a.Name,
+		Version:   a.Version,
+		Location:  a.Location,
+		IP:        "",
+		PublicKey: a.PublicKey,
+		Status:    string(a.Status),
+		Capabilities: CapabilitiesDTO{
+			CheckTypes:          a.Capabilities.CheckTypes,
+			Regions:             nonNil(a.Capabilities.Regions),
+			MaxConcurrentChecks: a.Capabilities.MaxConcurrentChecks,
+		},
+		LastHeartbeat: nil,
+		RegisteredAt:  a.RegisteredAt,
+		Tags:          nonNil(a.Tags),
+		Trust:         newTrustResponse(a.Trust),
+	}
+	if a.IP != nil {
+		resp.IP = a.IP.String()
+	}
+	if !a.LastHeartbeat.IsZero() {
+		resp.LastHeartbeat = &a.LastHeartbeat
+	}
+
+	return resp
+}
+
+func newAgentListResponse(agents []Agent, versions []VersionCount) AgentListResponse {
+	resp := AgentListResponse{
+		Agents:   make([]AgentResponse, len(agents)),
+		Versions: make([]VersionCountResponse, len(versions)),
+	}
+	for i, a := range agents {
+		resp.Agents[i] = newAgentResponse(a)
+	}
+	for i, v := range versions {
+		resp.Versions[i] = VersionCountResponse{
+			Version: v.Version,
+			Agents:  v.Agents,
+			Status:  string(v.Status),
+		}
+	}
+
+	return resp
+}
+
+func (r ActionRequest) toOperator(actor string) Operator {
+	return Operator{Actor: actor, Reason: r.Reason}
+}
+
+func newAuditResponse(entries []AuditEntry) []AuditEntryResponse {
+	resp := make([]AuditEntryResponse, len(entries))
+	for i, e := range entries {
+		resp[i] = AuditEntryResponse{
+			Action:    string(e.Action),
+			Actor:     e.Actor,
+			Reason:    e.Reason,
+			OldStatus: string(e.OldStatus),
+			NewStatus: string(e.NewStatus),
+			OldTags:   e.OldTags,
+			NewTags:   e.NewTags,
+			At:        e.At,
+		}
+	}
+
+	return resp
+}
+
+func newTrustResponse(t Trust) TrustResponse {
+	resp := TrustResponse{
+		Passed:    t.Passed,
+		Failed:    t.Failed,
+		Streak:    t.Streak,
+		Flagged:   t.Flagged,
+		CheckedAt: nil,
+	}
+	if !t.CheckedAt.IsZero() {
+		resp.CheckedAt = &t.CheckedAt
+	}
+
+	return resp
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func newWorkResponse(work []Work) WorkResponse {
+	resp := WorkResponse{Items: make([]WorkItemResponse, len(work))}
+	for i, w := range work {
+		resp.Items[i] = WorkItemResponse{
+			ID:          w.ID.String(),
+			ScheduledAt: w.ScheduledAt,
+			Location:    w.Location,
+			Target:      w.Target,
+			Diagnose:    w.Kind == scheduler.KindDiagnostics,
+		}
+	}
+
+	return resp
+}
+
+func (r SubmitResultsRequest) toSubmissions() []Submission {
+	items := make([]Submission, len(r.Results))
+	for i, item := range r.Results {
+		// Validated as UUIDs already.
+		id, _ := gocql.ParseUUID(item.ID)
+		assignmentID, _ := gocql.ParseUUID(item.AssignmentID)
+
+		items[i] = Submission{
+			ID:           id,
+			AssignmentID: assignmentID,
+			Result:       item.Result,
+			Diagnostics:  item.Diagnostics,
+		}
+	}
+
+	return items
+}
+
+func newSubmitResultsResponse(accepted []gocql.UUID, rejected []Rejection) SubmitResultsResponse {
+	resp := SubmitResultsResponse{
+		Accepted: make([]string, len(accepted)),
+		Rejected: make([]RejectedResult, len(rejected)),
+	}
+	for i, id := range accepted {
+		resp.Accepted[i] = id.String()
+	}
+	for i, r := range rejected {
+		resp.Rejected[i] = RejectedResult{
+			ID:    r.ID.String(),
+			Error: r.Err.Error(),
+			Retry: errors.Is(r.Err, ErrNotRecorded),
+		}
+	}
+
+	return resp
+}
@@ -0,0 +1,15 @@
+package agents
+
+import "errors"
+
+var (
+	ErrNotFound          = errors.New("agent not found")
+	ErrValidation        = errors.New("validation failed")
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrNotActive         = errors.New("agent is not active")
+	ErrAssignmentExpired = errors.New("assignment expired")
+	ErrNotRecorded       = errors.New("result not recorded, retry later")
+	ErrOutdated          = errors.New("agent version is not supported")
+	ErrNotPolling        = errors.New("agent is not polling for work")
+	ErrStreamInsecure    = errors.New("control stream requires a tls certificate or plaintext explicitly enabled")
+)
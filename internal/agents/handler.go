@@ -0,0 +1,542 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-core-fx/fiberfx/handler"
+	"github.com/go-playground/validator/v10"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultPollWait = 30 * time.Second
+
+type workQuery struct {
+	// Max is the number of checks wanted, defaults to the free capacity
+	Max int `query:"max" validate:"omitempty,min=1,max=10000"`
+	// Wait is the long-poll timeout in seconds
+	Wait *int `query:"wait" validate:"omitempty,min=0,max=60"`
+}
+
+type listQuery struct {
+	Status   string `query:"status" validate:"omitempty,oneof=validating active inactive suspended rejected decommissioned"`
+	Location string `query:"location" validate:"max=64"`
+	Tag      string `query:"tag" validate:"max=64"`
+	Version  string `query:"version" validate:"max=64"`
+}
+
+type Handler struct {
+	handler.Base
+
+	agents   *Service
+	broker   *Broker
+	receiver *Receiver
+	auth     *Authenticator
+}
+
+func NewHandler(
+	agents *Service,
+	broker *Broker,
+	receiver *Receiver,
+	auth *Authenticator,
+	validator *validator.Validate,
+) handler.Handler {
+	return &Handler{
+		Base: handler.Base{Validator: validator},
+
+		agents:   agents,
+		broker:   broker,
+		receiver: receiver,
+		auth:     auth,
+	}
+}
+
+func (h *Handler) Register(router fiber.Router) {
+	router = router.Group("/agents")
+
+	router.Post("register", h.register)
+	router.Get("me", h.auth.Middleware, h.me)
+	router.Post("heartbeat", h.auth.Middleware, h.heartbeat)
+	router.Get("work", h.auth.Middleware, h.work)
+	router.Post("results", h.auth.Middleware, h.results)
+	router.Get("", h.auth.Admin, h.list)
+	router.Get(":id", h.auth.Admin, h.get)
+	router.Get(":id/audit", h.auth.Admin, h.audit)
+	router.Post(":id/approve", h.auth.Admin, h.approve)
+	router.Post(":id/suspend", h.auth.Admin, h.suspend)
+	router.Post(":id/resume", h.auth.Admin, h.resume)
+	router.Post(":id/reject", h.auth.Admin, h.reject)
+	router.Post(":id/revalidate", h.auth.Admin, h.revalidate)
+	router.Post(":id/decommission", h.auth.Admin, h.decommission)
+	router.Put(":id/tags", h.auth.Admin, h.retag)
+}
+
+//	@Summary		Register agent
+//	@Description	Registers a probe agent, it only runs canary checks until it passes enough or is approved
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		RegisterRequest	true	"Agent"
+//	@Success		201		{object}	AgentResponse
+//	@Failure		400		{object}	fiberfx.ErrorResponse
+//	@Router			/agents/register [post]
+//
+// Register agent.
+func (h *Handler) register(c *fiber.Ctx) error {
+	var req RegisterRequest
+	if err := h.BodyParserValidator(c, &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	agent, err := h.agents.Register(c.Context(), req.toRegistration(net.ParseIP(c.IP())))
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newAgentResponse(agent))
+}
+
+//	@Summary		Get current agent
+//	@Description	Returns the agent signing the request
+//	@Tags			Agents
+//	@Produce		json
+//	@Param			X-Agent-Id			header		string	true	"Agent ID"
+//	@Param			X-Agent-Timestamp	header		string	true	"Unix timestamp"
+//	@Param			X-Agent-Nonce		header		string	true	"Unique request nonce"
+//	@Param			X-Agent-Signature	header		string	true	"Base64 Ed25519 signature"
+//	@Success		200					{object}	AgentResponse
+//	@Failure		401					{object}	fiberfx.ErrorResponse
+//	@Failure		403					{object}	fiberfx.ErrorResponse
+//	@Router			/agents/me [get]
+//
+// Get current agent.
+func (h *Handler) me(c *fiber.Ctx) error {
+	agent, _ := FromContext(c)
+
+	return c.JSON(newAgentResponse(agent))
+}
+
+//	@Summary		Send heartbeat
+//	@Description	Records that the signing agent is alive, reactivating it when it was inactive, and reports the version it runs
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Agent-Id			header		string				true	"Agent ID"
+//	@Param			X-Agent-Timestamp	header		string				true	"Unix timestamp"
+//	@Param			X-Agent-Nonce		header		string				true	"Unique request nonce"
+//	@Param			X-Agent-Signature	header		string				true	"Base64 Ed25519 signature"
+//	@Param			request				body		HeartbeatRequest	false	"Heartbeat"
+//	@Success		200					{object}	HeartbeatResponse
+//	@Failure		400					{object}	fiberfx.ErrorResponse
+//	@Failure		401					{object}	fiberfx.ErrorResponse
+//	@Failure		403					{object}	fiberfx.ErrorResponse
+//	@Router			/agents/heartbeat [post]
+//
+// Send heartbeat.
+func (h *Handler) heartbeat(c *fiber.Ctx) error {
+	var req HeartbeatRequest
+	if len(c.Body()) > 0 {
+		if err := h.BodyParserValidator(c, &req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	agent, _ := FromContext(c)
+
+	agent, err := h.agents.Heartbeat(c.Context(), agent, req.Version)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(HeartbeatResponse{
+		Status:     string(agent.Status),
+		ServerTime: agent.LastHeartbeat,
+		Upgrade:    h.agents.Upgrade(agent),
+	})
+}
+
+//	@Summary		Poll for work
+//	@Description	Waits for checks of the target types and locations the signing agent serves, within its free capacity
+//	@Tags			Agents
+//	@Produce		json
+//	@Param			X-Agent-Id			header		string	true	"Agent ID"
+//	@Param			X-Agent-Timestamp	header		string	true	"Unix timestamp"
+//	@Param			X-Agent-Nonce		header		string	true	"Unique request nonce"
+//	@Param			X-Agent-Signature	header		string	true	"Base64 Ed25519 signature"
+//	@Param			max					query		int		false	"Maximum number of checks"
+//	@Param			wait				query		int		false	"Seconds to wait for work, defaults to 30"
+//	@Success		200					{object}	WorkResponse
+//	@Failure		401					{object}	fiberfx.ErrorResponse
+//	@Failure		403					{object}	fiberfx.ErrorResponse
+//	@Router			/agents/work [get]
+//
+// Poll for work.
+func (h *Handler) work(c *fiber.Ctx) error {
+	var query workQuery
+	if err := h.QueryParserValidator(c, &query); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	wait := defaultPollWait
+	if query.Wait != nil {
+		wait = time.Duration(*query.Wait) * time.Second
+	}
+
+	agent, _ := FromContext(c)
+	work, err := h.broker.Poll(c.Context(), agent, query.Max, wait)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(newWorkResponse(work))
+}
+
+//	@Summary		Submit results
+//	@Description	Records a batch of check results of the signing agent, retried items are accepted once
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Agent-Id			header		string					true	"Agent ID"
+//	@Param			X-Agent-Timestamp	header		string					true	"Unix timestamp"
+//	@Param			X-Agent-Nonce		header		string					true	"Unique request nonce"
+//	@Param			X-Agent-Signature	header		string					true	"Base64 Ed25519 signature"
+//	@Param			request				body		SubmitResultsRequest	true	"Results"
+//	@Success		200					{object}	SubmitResultsResponse
+//	@Failure		400					{object}	fiberfx.ErrorResponse
+//	@Failure		401					{object}	fiberfx.ErrorResponse
+//	@Failure		403					{object}	fiberfx.ErrorResponse
+//	@Router			/agents/results [post]
+//
+// Submit results.
+func (h *Handler) results(c *fiber.Ctx) error {
+	var req SubmitResultsRequest
+	if err := h.BodyParserValidator(c, &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	agent, _ := FromContext(c)
+	accepted, rejected, err := h.receiver.Submit(c.Context(), agent, req.toSubmissions())
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(newSubmitResultsResponse(accepted, rejected))
+}
+
+//	@Summary		List agents
+//	@Description	Returns the agents matching the filters with the number of them running each version
+//	@Tags			Agents
+//	@Produce		json
+//	@Param			Authorization	header		string	true	"Bearer admin token"
+//	@Param			status			query		string	false	"Agent status"
+//	@Param			location		query		string	false	"Agent location"
+//	@Param			tag				query		string	false	"Agent tag"
+//	@Param			version			query		string	false	"Agent version"
+//	@Success		200				{object}	AgentListResponse
+//	@Failure		400				{object}	fiberfx.ErrorResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Router			/agents [get]
+//
+// List agents.
+func (h *Handler) list(c *fiber.Ctx) error {
+	var query listQuery
+	if err := h.QueryParserValidator(c, &query); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	agents, err := h.agents.Find(c.Context(), Filter{
+		Status:   Status(query.Status),
+		Location: query.Location,
+		Tag:      query.Tag,
+		Version:  query.Version,
+	})
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(newAgentListResponse(agents, h.agents.Versions(agents)))
+}
+
+//	@Summary		Get agent
+//	@Tags			Agents
+//	@Produce		json
+//	@Param			Authorization	header		string	true	"Bearer admin token"
+//	@Param			id				path		string	true	"Agent ID"
+//	@Success		200				{object}	AgentResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id} [get]
+//
+// Get agent.
+func (h *Handler) get(c *fiber.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	agent, err := h.agents.Get(c.Context(), id)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(newAgentResponse(agent))
+}
+
+//	@Summary		Get agent audit trail
+//	@Description	Returns the latest actions taken on the agent, newest first
+//	@Tags			Agents
+//	@Produce		json
+//	@Param			Authorization	header		string	true	"Bearer admin token"
+//	@Param			id				path		string	true	"Agent ID"
+//	@Success		200				{array}		AuditEntryResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id}/audit [get]
+//
+// Get agent audit trail.
+func (h *Handler) audit(c *fiber.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	entries, err := h.agents.Audit(c.Context(), id)
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(newAuditResponse(entries))
+}
+
+//	@Summary		Approve agent
+//	@Description	Activates a validating agent
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			Authorization	header		string			true	"Bearer admin token"
+//	@Param			id				path		string			true	"Agent ID"
+//	@Param			request			body		ActionRequest	false	"Reason for the audit trail"
+//	@Success		200				{object}	AgentResponse
+//	@Failure		400				{object}	fiberfx.ErrorResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Failure		409				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id}/approve [post]
+//
+// Approve agent.
+func (h *Handler) approve(c *fiber.Ctx) error {
+	return h.changeStatus(c, h.agents.Approve)
+}
+
+//	@Summary		Suspend agent
+//	@Description	Stops the agent from receiving work
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			Authorization	header		string			true	"Bearer admin token"
+//	@Param			id				path		string			true	"Agent ID"
+//	@Param			request			body		ActionRequest	false	"Reason for the audit trail"
+//	@Success		200				{object}	AgentResponse
+//	@Failure		400				{object}	fiberfx.ErrorResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Failure		409				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id}/suspend [post]
+//
+// Suspend agent.
+func (h *Handler) suspend(c *fiber.Ctx) error {
+	return h.changeStatus(c, h.agents.Suspend)
+}
+
+//	@Summary		Resume agent
+//	@Description	Activates a suspended agent, clearing its canary failures
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			Authorization	header		string			true	"Bearer admin token"
+//	@Param			id				path		string			true	"Agent ID"
+//	@Param			request			body		ActionRequest	false	"Reason for the audit trail"
+//	@Success		200				{object}	AgentResponse
+//	@Failure		400				{object}	fiberfx.ErrorResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Failure		409				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id}/resume [post]
+//
+// Resume agent.
+func (h *Handler) resume(c *fiber.Ctx) error {
+	return h.changeStatus(c, h.agents.Resume)
+}
+
+//	@Summary		Reject agent
+//	@Description	Refuses a validating agent
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			Authorization	header		string			true	"Bearer admin token"
+//	@Param			id				path		string			true	"Agent ID"
+//	@Param			request			body		ActionRequest	false	"Reason for the audit trail"
+//	@Success		200				{object}	AgentResponse
+//	@Failure		400				{object}	fiberfx.ErrorResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Failure		409				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id}/reject [post]
+//
+// Reject agent.
+func (h *Handler) reject(c *fiber.Ctx) error {
+	return h.changeStatus(c, h.agents.Reject)
+}
+
+//	@Summary		Revalidate agent
+//	@Description	Moves the agent back to validating, it receives work again once it passes canary checks
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			Authorization	header		string			true	"Bearer admin token"
+//	@Param			id				path		string			true	"Agent ID"
+//	@Param			request			body		ActionRequest	false	"Reason for the audit trail"
+//	@Success		200				{object}	AgentResponse
+//	@Failure		400				{object}	fiberfx.ErrorResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Failure		409				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id}/revalidate [post]
+//
+// Revalidate agent.
+func (h *Handler) revalidate(c *fiber.Ctx) error {
+	return h.changeStatus(c, h.agents.Revalidate)
+}
+
+//	@Summary		Decommission agent
+//	@Description	Retires the agent for good, it may no longer connect
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			Authorization	header		string			true	"Bearer admin token"
+//	@Param			id				path		string			true	"Agent ID"
+//	@Param			request			body		ActionRequest	false	"Reason for the audit trail"
+//	@Success		200				{object}	AgentResponse
+//	@Failure		400				{object}	fiberfx.ErrorResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Failure		409				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id}/decommission [post]
+//
+// Decommission agent.
+func (h *Handler) decommission(c *fiber.Ctx) error {
+	return h.changeStatus(c, h.agents.Decommission)
+}
+
+//	@Summary		Retag agent
+//	@Description	Replaces the tags of the agent
+//	@Tags			Agents
+//	@Accept			json
+//	@Produce		json
+//	@Param			Authorization	header		string			true	"Bearer admin token"
+//	@Param			id				path		string			true	"Agent ID"
+//	@Param			request			body		RetagRequest	true	"Tags"
+//	@Success		200				{object}	AgentResponse
+//	@Failure		400				{object}	fiberfx.ErrorResponse
+//	@Failure		401				{object}	fiberfx.ErrorResponse
+//	@Failure		403				{object}	fiberfx.ErrorResponse
+//	@Failure		404				{object}	fiberfx.ErrorResponse
+//	@Router			/agents/{id}/tags [put]
+//
+// Retag agent.
+func (h *Handler) retag(c *fiber.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	actor, err := adminActor(c)
+	if err != nil {
+		return err
+	}
+
+	var req RetagRequest
+	if bodyErr := h.BodyParserValidator(c, &req); bodyErr != nil {
+		return fiber.NewError(fiber.StatusBadRequest, bodyErr.Error())
+	}
+
+	agent, err := h.agents.Retag(c.Context(), id, nonNil(req.Tags), req.toOperator(actor))
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(newAgentResponse(agent))
+}
+
+func (h *Handler) changeStatus(c *fiber.Ctx, change func(context.Context, gocql.UUID, Operator) (Agent, error)) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	actor, err := adminActor(c)
+	if err != nil {
+		return err
+	}
+
+	var req ActionRequest
+	if len(c.Body()) > 0 {
+		if bodyErr := h.BodyParserValidator(c, &req); bodyErr != nil {
+			return fiber.NewError(fiber.StatusBadRequest, bodyErr.Error())
+		}
+	}
+
+	agent, err := change(c.Context(), id, req.toOperator(actor))
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	return c.JSON(newAgentResponse(agent))
+}
+
+func toHTTPError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, ErrValidation):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrInvalidTransition):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, ErrNotActive), errors.Is(err, ErrOutdated):
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	}
+
+	return err
+}
+
+// adminActor returns the admin taking the action, actions are only recorded
+// with an authenticated one.
+func adminActor(c *fiber.Ctx) (string, error) {
+	actor, ok := AdminFromContext(c)
+	if !ok || actor == "" {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "missing admin identity")
+	}
+
+	return actor, nil
+}
+
+func parseID(c *fiber.Ctx) (gocql.UUID, error) {
+	id, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return gocql.UUID{}, fiber.NewError(fiber.StatusBadRequest, "invalid agent id")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,206 @@
+package agents
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSignatureWindow = 5 * time.Minute
+	minNonceLength         = 16
+	maxNonceLength         = 128
+
+	localsAgent = "agent"
+	localsAdmin = "admin"
+)
+
+// Authenticator verifies the signatures of agent requests and the tokens of
+// admin requests.
+type Authenticator struct {
+	config Config
+	// admins maps the token hashes to the admin names
+	admins map[[sha256.Size]byte]string
+
+	agents *Service
+	nonces *NonceCache
+
+	logger *zap.Logger
+}
+
+func NewAuthenticator(config Config, agents *Service, nonces *NonceCache, logger *zap.Logger) *Authenticator {
+	if config.SignatureWindow <= 0 {
+		config.SignatureWindow = defaultSignatureWindow
+	}
+
+	admins := make(map[[sha256.Size]byte]string, len(config.AdminTokens))
+	for name, token := range config.AdminTokens {
+		if name == "" || token == "" {
+			logger.Warn("ignoring admin without a name or token", zap.String("name", name))
+			continue
+		}
+		admins[sha256.Sum256([]byte(token))] = name
+	}
+
+	return &Authenticator{
+		config: config,
+		admins: admins,
+
+		agents: agents,
+		nonces: nonces,
+
+		logger: logger,
+	}
+}
+
+// authError is an authentication failure reported to the agent.
+type authError struct {
+	message string
+	// forbidden is set when the agent is known but may not connect
+	forbidden bool
+}
+
+func (e authError) Error() string {
+	return e.message
+}
+
+// signedRequest is what the agent signed, with the authentication headers.
+type signedRequest struct {
+	header func(string) string
+	method string
+	path   string
+	body   []byte
+	ip     string
+}
+
+// Middleware authenticates the request as signed by a registered agent that
+// is not suspended or rejected. The agent is available to the next handlers
+// through FromContext.
+func (a *Authenticator) Middleware(c *fiber.Ctx) error {
+	agent, err := a.authenticate(c.Context(), signedRequest{
+		header: func(key string) string { return c.Get(key) },
+		method: c.Method(),
+		path:   c.OriginalURL(),
+		body:   c.Body(),
+		ip:     c.IP(),
+	})
+	if authErr := (authError{}); errors.As(err, &authErr) {
+		if authErr.forbidden {
+			return fiber.NewError(fiber.StatusForbidden, authErr.message)
+		}
+		return fiber.NewError(fiber.StatusUnauthorized, authErr.message)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Locals(localsAgent, agent)
+
+	return c.Next()
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, req signedRequest) (Agent, error) {
+	agentID, err := gocql.ParseUUID(req.header(HeaderAgentID))
+	if err != nil {
+		return Agent{}, authError{message: "invalid agent id", forbidden: false}
+	}
+
+	unix, err := strconv.ParseInt(req.header(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return Agent{}, authError{message: "invalid timestamp", forbidden: false}
+	}
+	timestamp := time.Unix(unix, 0)
+	if skew := time.Since(timestamp).Abs(); skew > a.config.SignatureWindow {
+		return Agent{}, authError{message: "timestamp is outside of the signature window", forbidden: false}
+	}
+
+	nonce := req.header(HeaderNonce)
+	if len(nonce) < minNonceLength || len(nonce) > maxNonceLength {
+		return Agent{}, authError{message: "invalid nonce", forbidden: false}
+	}
+
+	agent, err := a.agents.Get(ctx, agentID)
+	if errors.Is(err, ErrNotFound) {
+		return Agent{}, authError{message: "unknown agent", forbidden: false}
+	}
+	if err != nil {
+		return Agent{}, err
+	}
+
+	if !Verify(agent.PublicKey, req.header(HeaderSignature), req.method, req.path, req.body, timestamp, nonce) {
+		a.logger.Warn("invalid agent signature", zap.Stringer("agent_id", agentID), zap.String("ip", req.ip))
+		return Agent{}, authError{message: "invalid signature", forbidden: false}
+	}
+
+	// Timestamps are accepted on both sides of the server time.
+	fresh, err := a.nonces.Use(ctx, agentID, nonce, 2*a.config.SignatureWindow) //nolint:mnd // see above
+	if err != nil {
+		return Agent{}, err
+	}
+	if !fresh {
+		a.logger.Warn("replayed agent request", zap.Stringer("agent_id", agentID), zap.String("ip", req.ip))
+		return Agent{}, authError{message: "nonce already used", forbidden: false}
+	}
+
+	if !mayConnect(agent.Status) {
+		return Agent{}, authError{message: "agent is " + string(agent.Status), forbidden: true}
+	}
+
+	return agent, nil
+}
+
+// mayConnect reports whether agents with the status may use the agent API.
+func mayConnect(status Status) bool {
+	return status != StatusSuspended && status != StatusRejected && status != StatusDecommissioned
+}
+
+// Admin authenticates the request by the bearer token of a configured admin.
+// The admin name is available to the next handlers through AdminFromContext.
+func (a *Authenticator) Admin(c *fiber.Ctx) error {
+	if len(a.admins) == 0 {
+		return fiber.NewError(fiber.StatusForbidden, "admin api is disabled")
+	}
+
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "missing admin token")
+	}
+
+	// Tokens are compared by their hashes, in constant time.
+	hash := sha256.Sum256([]byte(token))
+	name := ""
+	for known, admin := range a.admins {
+		if subtle.ConstantTimeCompare(hash[:], known[:]) == 1 {
+			name = admin
+		}
+	}
+	if name == "" {
+		a.logger.Warn("invalid admin token", zap.String("ip", c.IP()))
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid admin token")
+	}
+
+	c.Locals(localsAdmin, name)
+
+	return c.Next()
+}
+
+// AdminFromContext returns the name of the admin authenticated by the
+// middleware.
+func AdminFromContext(c *fiber.Ctx) (string, bool) {
+	name, ok := c.Locals(localsAdmin).(string)
+	return name, ok
+}
+
+// FromContext returns the agent authenticated by the middleware.
+func FromContext(c *fiber.Ctx) (Agent, bool) {
+	agent, ok := c.Locals(localsAgent).(Agent)
+	return agent, ok
+}
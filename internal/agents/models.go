@@ -0,0 +1,177 @@
+package agents
+
+import (
+	"net"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v3/table"
+)
+
+//nolint:gochecknoglobals // table metadata
+var (
+	agentsTable = table.New(table.Metadata{
+		Name: "agents",
+		Columns: []string{
+			"id", "name", "version", "location", "ip", "public_key", "status", "capabilities",
+			"last_heartbeat", "registered_at", "tags", "trust",
+		},
+		PartKey: []string{"id"},
+		SortKey: []string{},
+	})
+
+	agentsByStatusTable = table.New(table.Metadata{
+		Name:    "agents_by_status",
+		Columns: []string{"status", "agent_id", "location", "last_heartbeat"},
+		PartKey: []string{"status"},
+		SortKey: []string{"agent_id"},
+	})
+
+	agentAuditTable = table.New(table.Metadata{
+		Name: "agent_audit",
+		Columns: []string{
+			"agent_id", "id", "action", "actor", "reason", "old_status", "new_status", "old_tags", "new_tags",
+		},
+		PartKey: []string{"agent_id"},
+		SortKey: []string{"id"},
+	})
+)
+
+type capabilitiesUDT struct {
+	CheckTypes          []string `cql:"check_types"`
+	Regions             []string `cql:"regions"`
+	MaxConcurrentChecks int      `cql:"max_concurrent_checks"`
+}
+
+type trustUDT struct {
+	Passed    int       `cql:"passed"`
+	Failed    int       `cql:"failed"`
+	Streak    int       `cql:"streak"`
+	Flagged   bool      `cql:"flagged"`
+	CheckedAt time.Time `cql:"checked_at"`
+}
+
+type agentModel struct {
+	ID            gocql.UUID      `db:"id"`
+	Name          string          `db:"name"`
+	Version       string          `db:"version"`
+	Location      string          `db:"location"`
+	IP            net.IP          `db:"ip"`
+	PublicKey     string          `db:"public_key"`
+	Status        string          `db:"status"`
+	Capabilities  capabilitiesUDT `db:"capabilities"`
+	LastHeartbeat time.Time       `db:"last_heartbeat"`
+	RegisteredAt  time.Time       `db:"registered_at"`
+	Tags          []string        `db:"tags"`
+	Trust         trustUDT        `db:"trust"`
+}
+
+type agentByStatusModel struct {
+	Status        string     `db:"status"`
+	AgentID       gocql.UUID `db:"agent_id"`
+	Location      string     `db:"location"`
+	LastHeartbeat time.Time  `db:"last_heartbeat"`
+}
+
+type auditModel struct {
+	AgentID gocql.UUID `db:"agent_id"`
+	// ID is a time UUID of when the action was taken
+	ID        gocql.UUID `db:"id"`
+	Action    string     `db:"action"`
+	Actor     string     `db:"actor"`
+	Reason    string     `db:"reason"`
+	OldStatus string     `db:"old_status"`
+	NewStatus string     `db:"new_status"`
+	OldTags   []string   `db:"old_tags"`
+	NewTags   []string   `db:"new_tags"`
+}
+
+func newAgentModel(a Agent) agentModel {
+	return agentModel{
+		ID:        a.ID,
+		Name:      a.Name,
+		Version:   a.Version,
+		Location:  a.Location,
+		IP:        a.IP,
+		PublicKey: a.PublicKey,
+		Status:    string(a.Status),
+		Capabilities: capabilitiesUDT{
+			CheckTypes:          a.Capabilities.CheckTypes,
+			Regions:             a.Capabilities.Regions,
+			MaxConcurrentChecks: a.Capabilities.MaxConcurrentChecks,
+		},
+		LastHeartbeat: a.LastHeartbeat,
+		RegisteredAt:  a.RegisteredAt,
+		Tags:          a.Tags,
+		Trust: trustUDT{
+			Passed:    a.Trust.Passed,
+			Failed:    a.Trust.Failed,
+			Streak:    a.Trust.Streak,
+			Flagged:   a.Trust.Flagged,
+			CheckedAt: a.Trust.CheckedAt,
+		},
+	}
+}
+
+func (m agentModel) byStatus() agentByStatusModel {
+	return agentByStatusModel{
+		Status:        m.Status,
+		AgentID:       m.ID,
+		Location:      m.Location,
+		LastHeartbeat: m.LastHeartbeat,
+	}
+}
+
+func (m agentModel) toDomain() Agent {
+	return Agent{
+		ID:        m.ID,
+		Name:      m.Name,
+		Version:   m.Version,
+		Location:  m.Location,
+		IP:        m.IP,
+		PublicKey: m.PublicKey,
+		Status:    Status(m.Status),
+		Capabilities: Capabilities{
+			CheckTypes:          m.Capabilities.CheckTypes,
+			Regions:             m.Capabilities.Regions,
+			MaxConcurrentChecks: m.Capabilities.MaxConcurrentChecks,
+		},
+		LastHeartbeat: m.LastHeartbeat,
+		RegisteredAt:  m.RegisteredAt,
+		Tags:          m.Tags,
+		Trust: Trust{
+			Passed:    m.Trust.Passed,
+			Failed:    m.Trust.Failed,
+			Streak:    m.Trust.Streak,
+			Flagged:   m.Trust.Flagged,
+			CheckedAt: m.Trust.CheckedAt,
+		},
+	}
+}
+
+func newAuditModel(e AuditEntry) auditModel {
+	return auditModel{
+		AgentID:   e.AgentID,
+		ID:        gocql.UUIDFromTime(e.At),
+		Action:    string(e.Action),
+		Actor:     e.Actor,
+		Reason:    e.Reason,
+		OldStatus: string(e.OldStatus),
+		NewStatus: string(e.NewStatus),
+		OldTags:   e.OldTags,
+		NewTags:   e.NewTags,
+	}
+}
+
+func (m auditModel) toDomain() AuditEntry {
+	return AuditEntry{
+		AgentID:   m.AgentID,
+		Action:    Action(m.Action),
+		Operator:  Operator{Actor: m.Actor, Reason: m.Reason},
+		OldStatus: Status(m.OldStatus),
+		NewStatus: Status(m.NewStatus),
+		OldTags:   m.OldTags,
+		NewTags:   m.NewTags,
+		At:        m.ID.Time(),
+	}
+}
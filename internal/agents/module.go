@@ -0,0 +1,138 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-core-fx/logger"
+	"github.com/pingplex/pingplex/internal/results"
+	"github.com/pingplex/pingplex/internal/scheduler"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// grpcKeepalive is how often idle connections are pinged to detect dead peers
+	grpcKeepalive        = 30 * time.Second
+	grpcKeepaliveTimeout = 10 * time.Second
+)
+
+func Module() fx.Option {
+	return fx.Module(
+		"agents",
+		logger.WithNamedLogger("agents"),
+		fx.Provide(NewRepository, fx.Private),
+		fx.Provide(fx.Annotate(NewNonceCache, fx.ParamTags(`optional:"true"`)), fx.Private),
+		fx.Provide(fx.Annotate(NewReaper, fx.ParamTags("", "", `optional:"true"`)), fx.Private),
+		fx.Provide(NewService),
+		fx.Provide(NewAuthenticator),
+		fx.Provide(fx.Annotate(NewCanary, fx.ParamTags("", "", "", "", "", `optional:"true"`)), fx.Private),
+		fx.Provide(fx.Annotate(NewReceiver, fx.ParamTags("", "", "", "", `optional:"true"`))),
+		fx.Provide(
+			fx.Annotate(
+				NewBroker,
+				fx.ParamTags("", "", "", "", `optional:"true"`),
+				fx.As(fx.Self()),
+				fx.As(new(scheduler.RemoteDispatcher)),
+				fx.As(new(results.RemoteDiagnoser)),
+			),
+		),
+		fx.Provide(NewStreamServer, fx.Private),
+		fx.Invoke(func(lc fx.Lifecycle, reaper *Reaper, broker *Broker, canary *Canary) {
+			ctx, cancel := context.WithCancel(context.Background())
+			var wg sync.WaitGroup
+
+			lc.Append(fx.Hook{
+				OnStart: func(_ context.Context) error {
+					wg.Go(func() { reaper.Run(ctx) })
+					wg.Go(func() { broker.Run(ctx) })
+					wg.Go(func() { canary.Run(ctx) })
+					return nil
+				},
+				OnStop: func(_ context.Context) error {
+					cancel()
+					wg.Wait()
+					return nil
+				},
+			})
+		}),
+		fx.Invoke(func(lc fx.Lifecycle, config Config, stream *StreamServer, logger *zap.Logger) error {
+			if config.GRPCAddress == "" {
+				return nil
+			}
+
+			creds, err := streamCredentials(config)
+			if err != nil {
+				return err
+			}
+			if config.GRPCPlaintext {
+				logger.Warn("grpc server runs without tls", zap.String("address", config.GRPCAddress))
+			}
+
+			server := grpc.NewServer(
+				grpc.Creds(creds),
+				grpc.ForceServerCodec(JSONCodec{}),
+				grpc.KeepaliveParams(keepalive.ServerParameters{ //nolint:exhaustruct // defaults
+					Time:    grpcKeepalive,
+					Timeout: grpcKeepaliveTimeout,
+				}),
+				grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+					MinTime:             grpcKeepalive / 2, //nolint:mnd // agents ping at grpcKeepalive
+					PermitWithoutStream: true,
+				}),
+			)
+			stream.Register(server)
+
+			lc.Append(fx.Hook{
+				OnStart: func(ctx context.Context) error {
+					listener, err := new(net.ListenConfig).Listen(ctx, "tcp", config.GRPCAddress)
+					if err != nil {
+						return fmt.Errorf("failed to listen on %s: %w", config.GRPCAddress, err)
+					}
+
+					go func() {
+						if serveErr := server.Serve(listener); serveErr != nil {
+							logger.Error("grpc server failed", zap.Error(serveErr))
+						}
+					}()
+					logger.Info("grpc server started", zap.String("address", config.GRPCAddress))
+
+					return nil
+				},
+				OnStop: func(_ context.Context) error {
+					// Streams never end on their own, agents reconnect elsewhere.
+					server.Stop()
+					return nil
+				},
+			})
+
+			return nil
+		}),
+	)
+}
+
+// streamCredentials loads the TLS certificate of the control stream. Agents
+// sign their requests but the results travel in the clear, so plaintext has
+// to be enabled explicitly.
+func streamCredentials(config Config) (credentials.TransportCredentials, error) {
+	if config.GRPCTLSCert == "" && config.GRPCTLSKey == "" {
+		if !config.GRPCPlaintext {
+			return nil, ErrStreamInsecure
+		}
+		return insecure.NewCredentials(), nil
+	}
+
+	creds, err := credentials.NewServerTLSFromFile(config.GRPCTLSCert, config.GRPCTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load grpc tls certificate: %w", err)
+	}
+
+	return creds, nil
+}
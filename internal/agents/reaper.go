@@ -0,0 +1,76 @@
+package agents
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const reaperLockKey = "pingplex:agents:reaper"
+
+// Reaper periodically moves agents that stopped sending heartbeats to inactive.
+//
+// With Redis, only one replica reaps per interval.
+type Reaper struct {
+	interval time.Duration
+
+	agents *Service
+	redis  *redis.Client
+
+	logger *zap.Logger
+}
+
+func NewReaper(config Config, agents *Service, redis *redis.Client, logger *zap.Logger) *Reaper {
+	timeout := config.HeartbeatTimeout
+	if timeout <= 0 {
+		timeout = defaultHeartbeatTimeout
+	}
+
+	return &Reaper{
+		interval: timeout / 3, //nolint:mnd // an agent goes inactive at most a third of the timeout late
+
+		agents: agents,
+		redis:  redis,
+
+		logger: logger,
+	}
+}
+
+// Run reaps the inactive agents until the context is canceled.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+func (r *Reaper) reap(ctx context.Context) {
+	if r.redis != nil {
+		// The lock expires slightly before the next run of any replica.
+		locked, err := r.redis.SetNX(ctx, reaperLockKey, 1, r.interval*9/10).Result() //nolint:mnd // see above
+		if err != nil {
+			r.logger.Warn("failed to lock agent reaper", zap.Error(err))
+			return
+		}
+		if !locked {
+			return
+		}
+	}
+
+	reaped, err := r.agents.Reap(ctx)
+	if err != nil && ctx.Err() == nil {
+		r.logger.Error("failed to reap agents", zap.Error(err))
+	}
+	if reaped > 0 {
+		r.logger.Info("agents went inactive", zap.Int("count", reaped))
+	}
+}
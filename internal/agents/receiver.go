@@ -0,0 +1,283 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/results"
+	"github.com/pingplex/pingplex/internal/scheduler"
+	"github.com/pingplex/pingplex/internal/targets"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// SubmissionTTL is how long result IDs are remembered to drop retried
+	// duplicates, agents must not retry uploads for longer
+	SubmissionTTL = 24 * time.Hour
+	// submissionLockTTL bounds how long an upload holds its assignment
+	submissionLockTTL = time.Minute
+	// maxResultAge matches the retention of check_results
+	maxResultAge = 30 * 24 * time.Hour
+	// maxClockSkew is how far in the future a check time may be
+	maxClockSkew = 5 * time.Minute
+)
+
+// Submission is a check result uploaded by an agent.
+type Submission struct {
+	// ID is generated by the agent and reused when the upload is retried
+	ID           gocql.UUID
+	AssignmentID gocql.UUID
+	Result       checker.Result
+	// Diagnostics are reported for diagnostics assignments, with the target of the result
+	Diagnostics *checker.Diagnostics
+}
+
+// Rejection is a submission that was not recorded.
+type Rejection struct {
+	ID  gocql.UUID
+	Err error
+}
+
+// Receiver records the check results uploaded by agents.
+//
+// Results are only accepted for the assignments handed to the agent, and
+// for the assigned target. Uploads are idempotent: the IDs of the recorded
+// submissions are remembered for a day and retried submissions are accepted
+// without being recorded again.
+type Receiver struct {
+	results *results.Service
+	targets *targets.Service
+	broker  *Broker
+	canary  *Canary
+	seen    *seenCache
+
+	logger *zap.Logger
+}
+
+func NewReceiver(
+	results *results.Service,
+	targets *targets.Service,
+	broker *Broker,
+	canary *Canary,
+	redis *redis.Client,
+	logger *zap.Logger,
+) *Receiver {
+	return &Receiver{
+		results: results,
+		targets: targets,
+		broker:  broker,
+		canary:  canary,
+		seen:    newSeenCache("pingplex:agents:result:", redis),
+
+		logger: logger,
+	}
+}
+
+// Submit records the results of the agent in check time order. It returns
+// the IDs of the accepted submissions, including duplicates, and the
+// rejected ones with the reason. Canary results are passed to the canary
+// checks instead, they are the only ones accepted from validating agents.
+func (r *Receiver) Submit(ctx context.Context, agent Agent, items []Submission) ([]gocql.UUID, []Rejection, error) {
+	if agent.Status != StatusActive && agent.Status != StatusInactive && agent.Status != StatusValidating {
+		return nil, nil, ErrNotActive
+	}
+
+	items = slices.Clone(items)
+	slices.SortStableFunc(items, func(a, b Submission) int {
+		return a.Result.CheckTime.Compare(b.Result.CheckTime)
+	})
+
+	accepted := make([]gocql.UUID, 0, len(items))
+	var rejected []Rejection
+	for _, item := range items {
+		if err := r.submit(ctx, agent, item); err != nil {
+			rejected = append(rejected, Rejection{ID: item.ID, Err: err})
+			continue
+		}
+		accepted = append(accepted, item.ID)
+	}
+
+	return accepted, rejected, nil
+}
+
+func (r *Receiver) submit(ctx context.Context, agent Agent, item Submission) error {
+	key := agent.ID.String() + ":" + item.ID.String()
+	recorded, err := r.seen.has(ctx, key)
+	if err != nil {
+		return err
+	}
+	if recorded {
+		return nil
+	}
+
+	// Results are only taken for the assignments handed to the agent.
+	a, ok, err := r.assignment(ctx, agent, item)
+	if err != nil {
+		r.logger.Error("failed to load assignment", zap.Stringer("agent_id", agent.ID), zap.Error(err))
+		return ErrNotRecorded
+	}
+	if !ok {
+		return fmt.Errorf("%w: unknown or completed assignment", ErrValidation)
+	}
+	if item.Result.TargetID != a.TargetID {
+		return fmt.Errorf("%w: result is not for the assigned target", ErrValidation)
+	}
+	// The per-family results are stored for the assigned target too.
+	item.Result.Families = slices.Clone(item.Result.Families)
+	for i := range item.Result.Families {
+		item.Result.Families[i].TargetID = a.TargetID
+	}
+
+	if a.Kind == scheduler.KindDiagnostics {
+		return r.attach(ctx, agent, a, item, key)
+	}
+
+	if valErr := r.validate(ctx, item.Result); valErr != nil {
+		return valErr
+	}
+
+	if a.Kind == scheduler.KindCanary {
+		return r.report(ctx, agent, item, key)
+	}
+	if agent.Status == StatusValidating {
+		return ErrNotActive
+	}
+
+	// One result per assignment is recorded, concurrent uploads retry.
+	lock := agent.ID.String() + ":" + item.AssignmentID.String() + ":pending"
+	locked, err := r.seen.add(ctx, lock, submissionLockTTL)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return ErrNotRecorded
+	}
+	defer func() {
+		if fgErr := r.seen.forget(context.WithoutCancel(ctx), lock); fgErr != nil {
+			r.logger.Warn("failed to unlock assignment", zap.Stringer("assignment_id", item.AssignmentID), zap.Error(fgErr))
+		}
+	}()
+
+	// The upload holding the lock before may have recorded it meanwhile.
+	recorded, err = r.seen.has(ctx, key)
+	if err != nil {
+		return err
+	}
+	if recorded {
+		return nil
+	}
+	if _, ok, err = r.assignment(ctx, agent, item); err != nil {
+		r.logger.Error("failed to load assignment", zap.Stringer("agent_id", agent.ID), zap.Error(err))
+		return ErrNotRecorded
+	}
+	if !ok {
+		return fmt.Errorf("%w: unknown or completed assignment", ErrValidation)
+	}
+
+	if recErr := r.results.Record(ctx, agent.ID, item.Result, a.Kind == scheduler.KindRecheck); recErr != nil {
+		r.logger.Error(
+			"failed to record agent result",
+			zap.Stringer("agent_id", agent.ID),
+			zap.Stringer("target_id", item.Result.TargetID),
+			zap.Error(recErr),
+		)
+		// Let the retry record it.
+		return ErrNotRecorded
+	}
+
+	r.complete(ctx, agent, item, key)
+
+	return nil
+}
+
+// assignment returns the assignment the result was submitted for, or the
+// stand-in for an assignment the server forgot in a restart.
+func (r *Receiver) assignment(ctx context.Context, agent Agent, item Submission) (Assignment, bool, error) {
+	a, ok, err := r.broker.assignment(ctx, agent.ID, item.AssignmentID)
+	if err != nil || ok {
+		return a, ok, err
+	}
+
+	return r.broker.orphan(ctx, agent, item.AssignmentID, item.Result)
+}
+
+// attach stores the diagnostics of a diagnostics assignment with its incident.
+func (r *Receiver) attach(ctx context.Context, agent Agent, a Assignment, item Submission, key string) error {
+	if item.Diagnostics == nil {
+		return fmt.Errorf("%w: diagnostics are missing", ErrValidation)
+	}
+
+	if err := r.results.AttachDiagnostics(ctx, agent.ID, a.IncidentID, a.TargetID, a.FailedAt, *item.Diagnostics); err != nil {
+		r.logger.Error("failed to store agent diagnostics", zap.Stringer("agent_id", agent.ID), zap.Error(err))
+		return ErrNotRecorded
+	}
+
+	if err := r.seen.set(ctx, key, SubmissionTTL); err != nil {
+		r.logger.Warn("failed to remember result", zap.Stringer("id", item.ID), zap.Error(err))
+	}
+	if err := r.broker.release(ctx, agent.ID, item.AssignmentID); err != nil {
+		r.logger.Warn("failed to complete assignment", zap.Stringer("assignment_id", item.AssignmentID), zap.Error(err))
+	}
+
+	return nil
+}
+
+// report passes the result of a canary assignment to the canary checks.
+func (r *Receiver) report(ctx context.Context, agent Agent, item Submission, key string) error {
+	if _, err := r.canary.Report(ctx, agent.ID, item.AssignmentID, item.Result); err != nil {
+		r.logger.Error("failed to report canary result", zap.Stringer("agent_id", agent.ID), zap.Error(err))
+		return ErrNotRecorded
+	}
+
+	if err := r.seen.set(ctx, key, SubmissionTTL); err != nil {
+		r.logger.Warn("failed to remember result", zap.Stringer("id", item.ID), zap.Error(err))
+	}
+	if err := r.broker.release(ctx, agent.ID, item.AssignmentID); err != nil {
+		r.logger.Warn("failed to complete assignment", zap.Stringer("assignment_id", item.AssignmentID), zap.Error(err))
+	}
+
+	return nil
+}
+
+// complete remembers the recorded result, so retries are accepted as
+// duplicates, and completes its assignment.
+func (r *Receiver) complete(ctx context.Context, agent Agent, item Submission, key string) {
+	if err := r.seen.set(ctx, key, SubmissionTTL); err != nil {
+		r.logger.Warn("failed to remember result", zap.Stringer("id", item.ID), zap.Error(err))
+	}
+
+	if err := r.broker.Complete(ctx, agent.ID, item.AssignmentID, item.Result); err != nil {
+		r.logger.Warn("failed to complete assignment", zap.Stringer("assignment_id", item.AssignmentID), zap.Error(err))
+	}
+}
+
+func (r *Receiver) validate(ctx context.Context, result checker.Result) error {
+	switch result.Status {
+	case checker.StatusUp, checker.StatusDegraded, checker.StatusDown, checker.StatusTimeout, checker.StatusError:
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrValidation, result.Status)
+	}
+
+	now := time.Now()
+	if result.CheckTime.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("%w: check time is in the future", ErrValidation)
+	}
+	if result.CheckTime.Before(now.Add(-maxResultAge)) {
+		return fmt.Errorf("%w: check time is past the retention", ErrValidation)
+	}
+
+	if _, err := r.targets.Get(ctx, result.TargetID); err != nil {
+		if errors.Is(err, targets.ErrNotFound) {
+			return fmt.Errorf("%w: %w", ErrValidation, err)
+		}
+		return ErrNotRecorded
+	}
+
+	return nil
+}
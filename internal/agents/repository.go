@@ -0,0 +1,182 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v3"
+	"github.com/scylladb/gocqlx/v3/qb"
+)
+
+const maxListedAudit = 100
+
+// Repository keeps agents and the agents_by_status index in sync.
+type Repository struct {
+	db gocqlx.Session
+}
+
+func NewRepository(db gocqlx.Session) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Save inserts or replaces the agent.
+func (r *Repository) Save(ctx context.Context, m agentModel) error {
+	batch := r.db.ContextBatch(ctx, gocql.LoggedBatch)
+
+	if err := batch.BindStruct(agentsTable.InsertQueryContext(ctx, r.db), m); err != nil {
+		return fmt.Errorf("failed to bind agent: %w", err)
+	}
+	if err := batch.BindStruct(agentsByStatusTable.InsertQueryContext(ctx, r.db), m.byStatus()); err != nil {
+		return fmt.Errorf("failed to bind agent index: %w", err)
+	}
+
+	if err := r.db.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("failed to save agent: %w", err)
+	}
+
+	return nil
+}
+
+// Touch stores the last heartbeat of the agent and its index entry. The
+// status of the agent may have changed since it was read, the index entry is
+// only updated while it exists, so a moved agent leaves no stale entry behind.
+func (r *Repository) Touch(ctx context.Context, m agentModel) error {
+	if err := agentsTable.UpdateQueryContext(ctx, r.db, "last_heartbeat").BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to store heartbeat: %w", err)
+	}
+
+	_, err := agentsByStatusTable.UpdateBuilder("last_heartbeat").
+		Existing().
+		QueryContext(ctx, r.db).
+		BindStruct(m.byStatus()).
+		ExecCASRelease()
+	if err != nil {
+		return fmt.Errorf("failed to store heartbeat in index: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStatus moves the agent from the previous status to its status,
+// storing its last heartbeat, then moves the index entry and stores the audit
+// entries of the change. The status is compared and set in a lightweight
+// transaction, ErrInvalidTransition is returned when it changed meanwhile.
+func (r *Repository) UpdateStatus(ctx context.Context, m agentModel, previous Status, audit ...auditModel) error {
+	applied, err := agentsTable.UpdateBuilder("status", "last_heartbeat").
+		If(qb.EqNamed("status", "previous_status")).
+		QueryContext(ctx, r.db).
+		BindStructMap(m, qb.M{"previous_status": string(previous)}).
+		ExecCASRelease()
+	if err != nil {
+		return fmt.Errorf("failed to update agent status: %w", err)
+	}
+	if !applied {
+		return fmt.Errorf("%w: status changed from %s meanwhile", ErrInvalidTransition, previous)
+	}
+
+	batch := r.db.ContextBatch(ctx, gocql.LoggedBatch)
+	if Status(m.Status) != previous {
+		stale := m.byStatus()
+		stale.Status = string(previous)
+		if err := batch.BindStruct(agentsByStatusTable.DeleteQueryContext(ctx, r.db), stale); err != nil {
+			return fmt.Errorf("failed to bind stale agent index: %w", err)
+		}
+	}
+	if err := batch.BindStruct(agentsByStatusTable.InsertQueryContext(ctx, r.db), m.byStatus()); err != nil {
+		return fmt.Errorf("failed to bind agent index: %w", err)
+	}
+	for _, a := range audit {
+		if err := batch.BindStruct(agentAuditTable.InsertQueryContext(ctx, r.db), a); err != nil {
+			return fmt.Errorf("failed to bind agent audit: %w", err)
+		}
+	}
+
+	if err := r.db.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("failed to update agent index: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTags stores the tags of the agent with the audit entry of the change.
+func (r *Repository) UpdateTags(ctx context.Context, m agentModel, audit auditModel) error {
+	batch := r.db.ContextBatch(ctx, gocql.LoggedBatch)
+
+	if err := batch.BindStruct(agentsTable.UpdateQueryContext(ctx, r.db, "tags"), m); err != nil {
+		return fmt.Errorf("failed to bind agent: %w", err)
+	}
+	if err := batch.BindStruct(agentAuditTable.InsertQueryContext(ctx, r.db), audit); err != nil {
+		return fmt.Errorf("failed to bind agent audit: %w", err)
+	}
+
+	if err := r.db.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("failed to update agent tags: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateVersion stores the version the agent runs.
+func (r *Repository) UpdateVersion(ctx context.Context, m agentModel) error {
+	if err := agentsTable.UpdateQueryContext(ctx, r.db, "version").BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to update agent version: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTrust stores the canary record of the agent.
+func (r *Repository) UpdateTrust(ctx context.Context, m agentModel) error {
+	if err := agentsTable.UpdateQueryContext(ctx, r.db, "trust").BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to update agent trust: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) Get(ctx context.Context, id gocql.UUID) (agentModel, error) {
+	var m agentModel
+	err := agentsTable.GetQueryContext(ctx, r.db).
+		BindStruct(agentModel{ID: id}). //nolint:exhaustruct // primary key only
+		GetRelease(&m)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return agentModel{}, ErrNotFound
+	}
+	if err != nil {
+		return agentModel{}, fmt.Errorf("failed to get agent: %w", err)
+	}
+
+	return m, nil
+}
+
+// ListByStatus returns the index entries of the agents with the status.
+func (r *Repository) ListByStatus(ctx context.Context, status Status) ([]agentByStatusModel, error) {
+	var items []agentByStatusModel
+	err := agentsByStatusTable.SelectQueryContext(ctx, r.db).
+		BindStruct(agentByStatusModel{Status: string(status)}). //nolint:exhaustruct // partition key only
+		SelectRelease(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agents: %w", err)
+	}
+
+	return items, nil
+}
+
+// ListAudit returns the latest audit entries of the agent, newest first.
+func (r *Repository) ListAudit(ctx context.Context, agentID gocql.UUID) ([]auditModel, error) {
+	var items []auditModel
+	err := agentAuditTable.SelectBuilder(agentAuditTable.Metadata().Columns...).
+		Limit(maxListedAudit).
+		QueryContext(ctx, r.db).
+		Bind(agentID).
+		SelectRelease(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent audit: %w", err)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,143 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/redis/go-redis/v9"
+)
+
+// seenCache remembers keys for a while, shared between replicas through
+// Redis or kept in memory without it.
+type seenCache struct {
+	prefix string
+	redis  *redis.Client
+
+	mu       sync.Mutex
+	seen     map[string]time.Time
+	prunedAt time.Time
+}
+
+func newSeenCache(prefix string, redis *redis.Client) *seenCache {
+	return &seenCache{
+		prefix: prefix,
+		redis:  redis,
+
+		mu:       sync.Mutex{},
+		seen:     map[string]time.Time{},
+		prunedAt: time.Time{},
+	}
+}
+
+// add remembers the key and reports whether it was not seen yet.
+func (c *seenCache) add(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	key = c.prefix + key
+
+	if c.redis != nil {
+		ok, err := c.redis.SetNX(ctx, key, 1, ttl).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to store key: %w", err)
+		}
+		return ok, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.prunedAt) > ttl {
+		for k, expiresAt := range c.seen {
+			if now.After(expiresAt) {
+				delete(c.seen, k)
+			}
+		}
+		c.prunedAt = now
+	}
+
+	if expiresAt, ok := c.seen[key]; ok && now.Before(expiresAt) {
+		return false, nil
+	}
+	c.seen[key] = now.Add(ttl)
+
+	return true, nil
+}
+
+// has reports whether the key is remembered.
+func (c *seenCache) has(ctx context.Context, key string) (bool, error) {
+	key = c.prefix + key
+
+	if c.redis != nil {
+		n, err := c.redis.Exists(ctx, key).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to look up key: %w", err)
+		}
+		return n > 0, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt, ok := c.seen[key]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// set remembers the key, whether it was seen or not.
+func (c *seenCache) set(ctx context.Context, key string, ttl time.Duration) error {
+	key = c.prefix + key
+
+	if c.redis != nil {
+		if err := c.redis.Set(ctx, key, 1, ttl).Err(); err != nil {
+			return fmt.Errorf("failed to store key: %w", err)
+		}
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen[key] = time.Now().Add(ttl)
+
+	return nil
+}
+
+// forget drops the key, so it is accepted again.
+func (c *seenCache) forget(ctx context.Context, key string) error {
+	key = c.prefix + key
+
+	if c.redis != nil {
+		if err := c.redis.Del(ctx, key).Err(); err != nil {
+			return fmt.Errorf("failed to delete key: %w", err)
+		}
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.seen, key)
+
+	return nil
+}
+
+// NonceCache remembers the nonces of accepted requests until their timestamps
+// fall out of the signature window, so a captured request cannot be replayed.
+//
+// Nonces are shared between replicas through Redis, without it they are kept
+// in memory.
+type NonceCache struct {
+	seen *seenCache
+}
+
+func NewNonceCache(redis *redis.Client) *NonceCache {
+	return &NonceCache{
+		seen: newSeenCache("pingplex:agents:nonce:", redis),
+	}
+}
+
+// Use records the nonce of the agent and reports whether it was unused.
+func (n *NonceCache) Use(ctx context.Context, agentID gocql.UUID, nonce string, ttl time.Duration) (bool, error) {
+	return n.seen.add(ctx, agentID.String()+":"+nonce, ttl)
+}
@@ -0,0 +1,518 @@
+package agents
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/events"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHeartbeatTimeout = 90 * time.Second
+	defaultPromoteAfter     = 5
+	defaultFlagAfter        = 2
+	defaultSuspendAfter     = 5
+)
+
+// Service manages agent registration, the approval workflow and liveness.
+//
+// Every status change is published as an event.
+type Service struct {
+	config   Config
+	versions versionPolicy
+
+	agents *Repository
+	events *events.Service
+
+	logger *zap.Logger
+}
+
+func NewService(config Config, agents *Repository, events *events.Service, logger *zap.Logger) *Service {
+	if config.HeartbeatTimeout <= 0 {
+		config.HeartbeatTimeout = defaultHeartbeatTimeout
+	}
+	if config.PromoteAfter <= 0 {
+		config.PromoteAfter = defaultPromoteAfter
+	}
+	if config.FlagAfter <= 0 {
+		config.FlagAfter = defaultFlagAfter
+	}
+	if config.SuspendAfter <= 0 {
+		config.SuspendAfter = defaultSuspendAfter
+	}
+
+	return &Service{
+		config:   config,
+		versions: newVersionPolicy(config),
+
+		agents: agents,
+		events: events,
+
+		logger: logger,
+	}
+}
+
+// Register stores a new agent awaiting approval.
+func (s *Service) Register(ctx context.Context, input Registration) (Agent, error) {
+	if err := validatePublicKey(input.PublicKey); err != nil {
+		return Agent{}, err
+	}
+
+	agent := Agent{
+		ID:            gocql.MustRandomUUID(),
+		Name:          input.Name,
+		Version:       input.Version,
+		Location:      input.Location,
+		IP:            input.IP,
+		PublicKey:     input.PublicKey,
+		Status:        StatusValidating,
+		Capabilities:  input.Capabilities,
+		LastHeartbeat: time.Time{},
+		RegisteredAt:  time.Now().UTC().Truncate(time.Millisecond),
+		Tags:          input.Tags,
+		Trust:         Trust{Passed: 0, Failed: 0, Streak: 0, Flagged: false, CheckedAt: time.Time{}},
+	}
+
+	if err := s.agents.Save(ctx, newAgentModel(agent)); err != nil {
+		return Agent{}, err
+	}
+
+	s.logger.Info(
+		"agent registered",
+		zap.Stringer("agent_id", agent.ID),
+		zap.String("name", agent.Name),
+		zap.String("location", agent.Location),
+	)
+
+	return agent, nil
+}
+
+func (s *Service) Get(ctx context.Context, id gocql.UUID) (Agent, error) {
+	m, err := s.agents.Get(ctx, id)
+	if err != nil {
+		return Agent{}, err
+	}
+
+	return m.toDomain(), nil
+}
+
+// List returns the agents with the status.
+func (s *Service) List(ctx context.Context, status Status) ([]Agent, error) {
+	items, err := s.agents.ListByStatus(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]Agent, 0, len(items))
+	for _, item := range items {
+		m, getErr := s.agents.Get(ctx, item.AgentID)
+		if errors.Is(getErr, ErrNotFound) {
+			continue
+		}
+		if getErr != nil {
+			return nil, getErr
+		}
+		// The index may lag behind.
+		if Status(m.Status) == status {
+			agents = append(agents, m.toDomain())
+		}
+	}
+
+	return agents, nil
+}
+
+// ListAll returns the agents in every status.
+func (s *Service) ListAll(ctx context.Context) ([]Agent, error) {
+	var agents []Agent
+	for _, status := range statuses() {
+		items, err := s.List(ctx, status)
+		if err != nil {
+			return nil, err
+		}
+		agents = append(agents, items...)
+	}
+
+	return agents, nil
+}
+
+// Find returns the agents matching the filter.
+func (s *Service) Find(ctx context.Context, filter Filter) ([]Agent, error) {
+	var (
+		agents []Agent
+		err    error
+	)
+	if filter.Status != "" {
+		agents, err = s.List(ctx, filter.Status)
+	} else {
+		agents, err = s.ListAll(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(agents, func(a Agent) bool {
+		return (filter.Location != "" && a.Location != filter.Location) ||
+			(filter.Tag != "" && !slices.Contains(a.Tags, filter.Tag)) ||
+			(filter.Version != "" && a.Version != filter.Version)
+	}), nil
+}
+
+// Audit returns the latest actions on the agent, newest first.
+func (s *Service) Audit(ctx context.Context, id gocql.UUID) ([]AuditEntry, error) {
+	if _, err := s.agents.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	items, err := s.agents.ListAudit(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, len(items))
+	for i, item := range items {
+		entries[i] = item.toDomain()
+	}
+
+	return entries, nil
+}
+
+// Versions returns how many of the agents run each version, newest first.
+func (s *Service) Versions(agents []Agent) []VersionCount {
+	counts := map[string]int{}
+	for _, agent := range agents {
+		counts[agent.Version]++
+	}
+
+	versions := make([]VersionCount, 0, len(counts))
+	for version, n := range counts {
+		versions = append(versions, VersionCount{
+			Version: version,
+			Agents:  n,
+			Status:  s.versions.status(version),
+		})
+	}
+	slices.SortFunc(versions, func(a, b VersionCount) int {
+		if c, ok := compareVersions(b.Version, a.Version); ok {
+			return c
+		}
+
+		// Versions that cannot be compared come last.
+		_, _, okA := parseVersion(a.Version)
+		_, _, okB := parseVersion(b.Version)
+		switch {
+		case okA && !okB:
+			return -1
+		case !okA && okB:
+			return 1
+		}
+		return strings.Compare(a.Version, b.Version)
+	})
+
+	return versions
+}
+
+// Approve activates a validating agent.
+func (s *Service) Approve(ctx context.Context, id gocql.UUID, op Operator) (Agent, error) {
+	return s.transition(ctx, id, ActionApprove, op, StatusActive, StatusValidating)
+}
+
+// Suspend stops the agent from receiving work until it is resumed.
+func (s *Service) Suspend(ctx context.Context, id gocql.UUID, op Operator) (Agent, error) {
+	return s.transition(ctx, id, ActionSuspend, op, StatusSuspended, StatusValidating, StatusActive, StatusInactive)
+}
+
+// Resume activates a suspended agent, clearing its canary failures. Revalidate
+// it instead to have it pass canary checks first.
+func (s *Service) Resume(ctx context.Context, id gocql.UUID, op Operator) (Agent, error) {
+	return s.transition(ctx, id, ActionResume, op, StatusActive, StatusSuspended)
+}
+
+// Reject refuses a validating agent.
+func (s *Service) Reject(ctx context.Context, id gocql.UUID, op Operator) (Agent, error) {
+	return s.transition(ctx, id, ActionReject, op, StatusRejected, StatusValidating)
+}
+
+// Revalidate moves the agent back to validating, it receives work again once
+// it passes enough canary checks in a row.
+func (s *Service) Revalidate(ctx context.Context, id gocql.UUID, op Operator) (Agent, error) {
+	return s.transition(ctx, id, ActionRevalidate, op, StatusValidating, StatusActive, StatusInactive, StatusSuspended)
+}
+
+// Decommission retires the agent for good, it may no longer connect.
+func (s *Service) Decommission(ctx context.Context, id gocql.UUID, op Operator) (Agent, error) {
+	return s.transition(
+		ctx, id, ActionDecommission, op, StatusDecommissioned,
+		StatusValidating, StatusActive, StatusInactive, StatusSuspended, StatusRejected,
+	)
+}
+
+// Retag replaces the tags of the agent.
+func (s *Service) Retag(ctx context.Context, id gocql.UUID, tags []string, op Operator) (Agent, error) {
+	m, err := s.agents.Get(ctx, id)
+	if err != nil {
+		return Agent{}, err
+	}
+
+	audit := newAuditModel(AuditEntry{
+		AgentID:   m.ID,
+		Action:    ActionRetag,
+		Operator:  op,
+		OldStatus: Status(m.Status),
+		NewStatus: Status(m.Status),
+		OldTags:   m.Tags,
+		NewTags:   tags,
+		At:        time.Now(),
+	})
+	m.Tags = tags
+	if updErr := s.agents.UpdateTags(ctx, m, audit); updErr != nil {
+		return Agent{}, updErr
+	}
+
+	s.logger.Info("agent retagged", zap.Stringer("agent_id", m.ID), zap.Strings("tags", tags), zap.String("actor", op.Actor))
+
+	return m.toDomain(), nil
+}
+
+// Heartbeat records that the agent is alive, reactivating it when it was
+// inactive. A non empty version replaces the one the agent registered with.
+func (s *Service) Heartbeat(ctx context.Context, agent Agent, version string) (Agent, error) {
+	if version != "" && version != agent.Version {
+		s.logger.Info(
+			"agent version changed",
+			zap.Stringer("agent_id", agent.ID),
+			zap.String("from", agent.Version),
+			zap.String("to", version),
+		)
+		agent.Version = version
+		if err := s.agents.UpdateVersion(ctx, newAgentModel(agent)); err != nil {
+			return Agent{}, err
+		}
+	}
+
+	agent.LastHeartbeat = time.Now().UTC().Truncate(time.Millisecond)
+	m := newAgentModel(agent)
+
+	if agent.Status != StatusInactive {
+		if err := s.agents.Touch(ctx, m); err != nil {
+			return Agent{}, err
+		}
+		return agent, nil
+	}
+
+	m.Status = string(StatusActive)
+	reactivated, err := s.changeStatus(ctx, m, agent.Status)
+	if !errors.Is(err, ErrInvalidTransition) {
+		return reactivated, err
+	}
+
+	// Changed meanwhile, by another heartbeat or an admin.
+	current, err := s.Get(ctx, agent.ID)
+	if err != nil {
+		return Agent{}, err
+	}
+	current.LastHeartbeat = agent.LastHeartbeat
+	if touchErr := s.agents.Touch(ctx, newAgentModel(current)); touchErr != nil {
+		return Agent{}, touchErr
+	}
+
+	return current, nil
+}
+
+// Score records the outcome of a canary check of the agent. Validating
+// agents passing enough in a row are activated. Agents failing in a row are
+// flagged, then suspended.
+func (s *Service) Score(ctx context.Context, id gocql.UUID, passed bool) (Agent, error) {
+	m, err := s.agents.Get(ctx, id)
+	if err != nil {
+		return Agent{}, err
+	}
+
+	trust := &m.Trust
+	trust.CheckedAt = time.Now().UTC().Truncate(time.Millisecond)
+	if passed {
+		trust.Passed++
+		trust.Streak = max(trust.Streak, 0) + 1
+		trust.Flagged = false
+	} else {
+		trust.Failed++
+		trust.Streak = min(trust.Streak, 0) - 1
+	}
+	flagged := !passed && !trust.Flagged && -trust.Streak >= s.config.FlagAfter
+	trust.Flagged = trust.Flagged || flagged
+
+	if updErr := s.agents.UpdateTrust(ctx, m); updErr != nil {
+		return Agent{}, updErr
+	}
+
+	if flagged {
+		s.logger.Warn("agent diverges from consensus", zap.Stringer("agent_id", m.ID), zap.Int("streak", trust.Streak))
+		event := events.NewAgent(events.TypeAgentFlagged, m.ID, time.Now(), newTrustResponse(m.toDomain().Trust))
+		if pubErr := s.events.Publish(ctx, event); pubErr != nil {
+			s.logger.Warn("failed to publish agent flag", zap.Stringer("agent_id", m.ID), zap.Error(pubErr))
+		}
+	}
+
+	previous := Status(m.Status)
+	switch {
+	case previous == StatusValidating && trust.Streak >= s.config.PromoteAfter:
+		m.Status = string(StatusActive)
+	case (previous == StatusValidating || previous == StatusActive || previous == StatusInactive) &&
+		-trust.Streak >= s.config.SuspendAfter:
+		m.Status = string(StatusSuspended)
+	default:
+		return m.toDomain(), nil
+	}
+
+	return s.changeStatus(ctx, m, previous)
+}
+
+// Reap moves the active agents without a heartbeat within the timeout to
+// inactive and returns their number.
+func (s *Service) Reap(ctx context.Context) (int, error) {
+	items, err := s.agents.ListByStatus(ctx, StatusActive)
+	if err != nil {
+		return 0, err
+	}
+
+	reaped := 0
+	for _, item := range items {
+		if !s.stale(item.LastHeartbeat) {
+			continue
+		}
+
+		// The index may lag behind, check the agent itself.
+		m, getErr := s.agents.Get(ctx, item.AgentID)
+		if errors.Is(getErr, ErrNotFound) {
+			continue
+		}
+		if getErr != nil {
+			return reaped, getErr
+		}
+		if Status(m.Status) != StatusActive || !s.stale(m.LastHeartbeat) {
+			continue
+		}
+
+		m.Status = string(StatusInactive)
+		_, chErr := s.changeStatus(ctx, m, StatusActive)
+		if errors.Is(chErr, ErrInvalidTransition) {
+			// It changed since it was read, a heartbeat may have arrived.
+			continue
+		}
+		if chErr != nil {
+			return reaped, chErr
+		}
+		reaped++
+	}
+
+	return reaped, nil
+}
+
+// Upgrade returns the upgrade notice of the agent, nil when its version is
+// up to date.
+func (s *Service) Upgrade(agent Agent) *UpgradeNotice {
+	return s.versions.notice(agent.Version)
+}
+
+func (s *Service) stale(lastHeartbeat time.Time) bool {
+	return time.Since(lastHeartbeat) > s.config.HeartbeatTimeout
+}
+
+// transition moves the agent to the status when it is in one of the allowed
+// ones, recording the action in the audit trail.
+func (s *Service) transition(
+	ctx context.Context,
+	id gocql.UUID,
+	action Action,
+	op Operator,
+	to Status,
+	from ...Status,
+) (Agent, error) {
+	m, err := s.agents.Get(ctx, id)
+	if err != nil {
+		return Agent{}, err
+	}
+
+	previous := Status(m.Status)
+	if !slices.Contains(from, previous) {
+		return Agent{}, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, previous, to)
+	}
+
+	if action == ActionResume || action == ActionRevalidate {
+		// A fresh start, past canary failures no longer count.
+		m.Trust.Streak = 0
+		m.Trust.Flagged = false
+		if updErr := s.agents.UpdateTrust(ctx, m); updErr != nil {
+			return Agent{}, updErr
+		}
+	}
+
+	m.Status = string(to)
+	audit := newAuditModel(AuditEntry{
+		AgentID:   m.ID,
+		Action:    action,
+		Operator:  op,
+		OldStatus: previous,
+		NewStatus: to,
+		OldTags:   nil,
+		NewTags:   nil,
+		At:        time.Now(),
+	})
+
+	return s.changeStatus(ctx, m, previous, audit)
+}
+
+// changeStatus stores the new status of the agent with the audit entries of
+// the change and publishes it.
+func (s *Service) changeStatus(ctx context.Context, m agentModel, previous Status, audit ...auditModel) (Agent, error) {
+	if err := s.agents.UpdateStatus(ctx, m, previous, audit...); err != nil {
+		return Agent{}, err
+	}
+
+	agent := m.toDomain()
+	s.logger.Info(
+		"agent status changed",
+		zap.Stringer("agent_id", agent.ID),
+		zap.String("location", agent.Location),
+		zap.String("from", string(previous)),
+		zap.String("to", string(agent.Status)),
+	)
+
+	change := StatusChange{
+		From:          previous,
+		To:            agent.Status,
+		Location:      agent.Location,
+		LastHeartbeat: agent.LastHeartbeat,
+	}
+	if err := s.events.Publish(ctx, events.NewAgent(events.TypeAgentStatusChanged, agent.ID, time.Now(), change)); err != nil {
+		s.logger.Warn("failed to publish agent status change", zap.Stringer("agent_id", agent.ID), zap.Error(err))
+	}
+
+	return agent, nil
+}
+
+// statuses returns every agent status.
+func statuses() []Status {
+	return []Status{
+		StatusValidating, StatusActive, StatusInactive, StatusSuspended, StatusRejected, StatusDecommissioned,
+	}
+}
+
+func validatePublicKey(key string) error {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("%w: public key must be base64 encoded", ErrValidation)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: public key must be a %d byte Ed25519 key", ErrValidation, ed25519.PublicKeySize)
+	}
+
+	return nil
+}
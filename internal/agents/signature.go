@@ -0,0 +1,55 @@
+package agents
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of signed agent requests.
+const (
+	HeaderAgentID   = "X-Agent-Id"
+	HeaderTimestamp = "X-Agent-Timestamp"
+	HeaderNonce     = "X-Agent-Nonce"
+	HeaderSignature = "X-Agent-Signature"
+)
+
+// SigningString returns the message signed for an agent request: the method,
+// the path with the query, the hex encoded SHA-256 of the body, the unix
+// timestamp and the nonce, separated by newlines.
+func SigningString(method, path string, body []byte, timestamp time.Time, nonce string) []byte {
+	digest := sha256.Sum256(body)
+
+	return []byte(strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		hex.EncodeToString(digest[:]),
+		strconv.FormatInt(timestamp.Unix(), 10),
+		nonce,
+	}, "\n"))
+}
+
+// Sign returns the base64 encoded signature of the request.
+func Sign(key ed25519.PrivateKey, method, path string, body []byte, timestamp time.Time, nonce string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, SigningString(method, path, body, timestamp, nonce)))
+}
+
+// Verify reports whether the signature of the request is valid for the
+// base64 encoded public key.
+func Verify(publicKey, signature, method, path string, body []byte, timestamp time.Time, nonce string) bool {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	return ed25519.Verify(key, SigningString(method, path, body, timestamp, nonce), sig)
+}
@@ -0,0 +1,373 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	workKeyPrefix = "pingplex:agents:"
+	workersKey    = workKeyPrefix + "workers"
+)
+
+// workStore holds the polling workers, their queued assignments and the
+// assignments handed to them but not completed yet.
+type workStore interface {
+	// announce stores the worker, replacing its previous state
+	announce(ctx context.Context, w worker) error
+	// workers returns the stored workers
+	workers(ctx context.Context) ([]worker, error)
+	// remove deletes the worker, it reports whether the worker was stored
+	remove(ctx context.Context, id gocql.UUID) (bool, error)
+	// push queues the assignment and returns the number of queued ones
+	push(ctx context.Context, id gocql.UUID, a Assignment, ttl time.Duration) (int, error)
+	// pop dequeues up to n assignments, all of them when n is negative
+	pop(ctx context.Context, id gocql.UUID, n int) ([]Assignment, error)
+	// assign records assignments handed to the worker until the deadline,
+	// their tickets are kept until the result is reported or SubmissionTTL passes
+	assign(ctx context.Context, id gocql.UUID, assignments []Assignment, deadline time.Time) error
+	// ticket returns the assignment handed to the worker, until its result is reported
+	ticket(ctx context.Context, id, assignmentID gocql.UUID) (Assignment, bool, error)
+	// complete removes a handed out assignment and its ticket, it reports whether it was outstanding
+	complete(ctx context.Context, id, assignmentID gocql.UUID) (bool, error)
+	// outstanding returns the number of assignments handed to the worker before their deadline
+	outstanding(ctx context.Context, id gocql.UUID, now time.Time) (int, error)
+}
+
+// redisStore shares the work between replicas, so agents may poll any of them.
+type redisStore struct {
+	redis *redis.Client
+}
+
+func queueKey(id gocql.UUID) string {
+	return workKeyPrefix + "queue:" + id.String()
+}
+
+func assignedKey(id gocql.UUID) string {
+	return workKeyPrefix + "assigned:" + id.String()
+}
+
+func ticketKey(id, assignmentID gocql.UUID) string {
+	return workKeyPrefix + "ticket:" + id.String() + ":" + assignmentID.String()
+}
+
+func (s *redisStore) announce(ctx context.Context, w worker) error {
+	payload, err := json.Marshal(w)
+	if err != nil {
+		return fmt.Errorf("failed to encode worker: %w", err)
+	}
+
+	if setErr := s.redis.HSet(ctx, workersKey, w.ID.String(), payload).Err(); setErr != nil {
+		return fmt.Errorf("failed to store worker: %w", setErr)
+	}
+
+	return nil
+}
+
+func (s *redisStore) workers(ctx context.Context) ([]worker, error) {
+	items, err := s.redis.HGetAll(ctx, workersKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workers: %w", err)
+	}
+
+	workers := make([]worker, 0, len(items))
+	for _, payload := range items {
+		var w worker
+		if jsonErr := json.Unmarshal([]byte(payload), &w); jsonErr != nil {
+			return nil, fmt.Errorf("failed to decode worker: %w", jsonErr)
+		}
+		workers = append(workers, w)
+	}
+
+	return workers, nil
+}
+
+func (s *redisStore) remove(ctx context.Context, id gocql.UUID) (bool, error) {
+	removed, err := s.redis.HDel(ctx, workersKey, id.String()).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove worker: %w", err)
+	}
+
+	return removed > 0, nil
+}
+
+func (s *redisStore) push(ctx context.Context, id gocql.UUID, a Assignment, ttl time.Duration) (int, error) {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode assignment: %w", err)
+	}
+
+	var length *redis.IntCmd
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		length = pipe.RPush(ctx, queueKey(id), payload)
+		// Queues of agents that are gone for good expire.
+		pipe.PExpire(ctx, queueKey(id), ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue assignment: %w", err)
+	}
+
+	return int(length.Val()), nil
+}
+
+func (s *redisStore) pop(ctx context.Context, id gocql.UUID, n int) ([]Assignment, error) {
+	var (
+		items []string
+		err   error
+	)
+	if n < 0 {
+		var all *redis.StringSliceCmd
+		_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			all = pipe.LRange(ctx, queueKey(id), 0, -1)
+			pipe.Del(ctx, queueKey(id))
+			return nil
+		})
+		items = all.Val()
+	} else {
+		items, err = s.redis.LPopCount(ctx, queueKey(id), n).Result()
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to dequeue assignments: %w", err)
+	}
+
+	assignments := make([]Assignment, 0, len(items))
+	for _, payload := range items {
+		var a Assignment
+		if jsonErr := json.Unmarshal([]byte(payload), &a); jsonErr != nil {
+			return nil, fmt.Errorf("failed to decode assignment: %w", jsonErr)
+		}
+		assignments = append(assignments, a)
+	}
+
+	return assignments, nil
+}
+
+func (s *redisStore) assign(ctx context.Context, id gocql.UUID, assignments []Assignment, deadline time.Time) error {
+	members := make([]redis.Z, len(assignments))
+	tickets := make([][]byte, len(assignments))
+	for i, a := range assignments {
+		members[i] = redis.Z{Score: float64(deadline.UnixMilli()), Member: a.ID.String()}
+
+		payload, err := json.Marshal(a)
+		if err != nil {
+			return fmt.Errorf("failed to encode assignment: %w", err)
+		}
+		tickets[i] = payload
+	}
+
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, assignedKey(id), members...)
+		pipe.PExpireAt(ctx, assignedKey(id), deadline)
+		for i, a := range assignments {
+			pipe.Set(ctx, ticketKey(id, a.ID), tickets[i], SubmissionTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record assignments: %w", err)
+	}
+
+	return nil
+}
+
+func (s *redisStore) ticket(ctx context.Context, id, assignmentID gocql.UUID) (Assignment, bool, error) {
+	payload, err := s.redis.Get(ctx, ticketKey(id, assignmentID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Assignment{}, false, nil //nolint:exhaustruct // not found
+	}
+	if err != nil {
+		return Assignment{}, false, fmt.Errorf("failed to load assignment: %w", err) //nolint:exhaustruct // error
+	}
+
+	var a Assignment
+	if jsonErr := json.Unmarshal(payload, &a); jsonErr != nil {
+		return Assignment{}, false, fmt.Errorf("failed to decode assignment: %w", jsonErr) //nolint:exhaustruct // error
+	}
+
+	return a, true, nil
+}
+
+func (s *redisStore) complete(ctx context.Context, id, assignmentID gocql.UUID) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.ZRem(ctx, assignedKey(id), assignmentID.String())
+		pipe.Del(ctx, ticketKey(id, assignmentID))
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to complete assignment: %w", err)
+	}
+
+	return removed.Val() > 0, nil
+}
+
+func (s *redisStore) outstanding(ctx context.Context, id gocql.UUID, now time.Time) (int, error) {
+	var count *redis.IntCmd
+	_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, assignedKey(id), "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		count = pipe.ZCard(ctx, assignedKey(id))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count assignments: %w", err)
+	}
+
+	return int(count.Val()), nil
+}
+
+// ticket is an assignment handed to a worker, kept in memory until its
+// result is reported.
+type ticket struct {
+	workerID   gocql.UUID
+	assignment Assignment
+	expiresAt  time.Time
+}
+
+// memoryStore keeps the work of a single replica.
+type memoryStore struct {
+	mu       sync.Mutex
+	all      map[gocql.UUID]worker
+	queues   map[gocql.UUID][]Assignment
+	assigned map[gocql.UUID]map[gocql.UUID]time.Time
+	tickets  map[gocql.UUID]ticket
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		mu:       sync.Mutex{},
+		all:      map[gocql.UUID]worker{},
+		queues:   map[gocql.UUID][]Assignment{},
+		assigned: map[gocql.UUID]map[gocql.UUID]time.Time{},
+		tickets:  map[gocql.UUID]ticket{},
+	}
+}
+
+func (s *memoryStore) announce(_ context.Context, w worker) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.all[w.ID] = w
+	return nil
+}
+
+func (s *memoryStore) workers(_ context.Context) ([]worker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workers := make([]worker, 0, len(s.all))
+	for _, w := range s.all {
+		workers = append(workers, w)
+	}
+
+	return workers, nil
+}
+
+func (s *memoryStore) remove(_ context.Context, id gocql.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.all[id]
+	delete(s.all, id)
+	delete(s.assigned, id)
+
+	return ok, nil
+}
+
+func (s *memoryStore) push(_ context.Context, id gocql.UUID, a Assignment, _ time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queues[id] = append(s.queues[id], a)
+	return len(s.queues[id]), nil
+}
+
+func (s *memoryStore) pop(_ context.Context, id gocql.UUID, n int) ([]Assignment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queued := s.queues[id]
+	if n < 0 || n > len(queued) {
+		n = len(queued)
+	}
+
+	items := queued[:n:n]
+	if n == len(queued) {
+		delete(s.queues, id)
+	} else {
+		s.queues[id] = queued[n:]
+	}
+
+	return items, nil
+}
+
+func (s *memoryStore) assign(_ context.Context, id gocql.UUID, assignments []Assignment, deadline time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for assignmentID, t := range s.tickets {
+		if !now.Before(t.expiresAt) {
+			delete(s.tickets, assignmentID)
+		}
+	}
+
+	assigned, ok := s.assigned[id]
+	if !ok {
+		assigned = map[gocql.UUID]time.Time{}
+		s.assigned[id] = assigned
+	}
+	for _, a := range assignments {
+		assigned[a.ID] = deadline
+		s.tickets[a.ID] = ticket{workerID: id, assignment: a, expiresAt: now.Add(SubmissionTTL)}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) ticket(_ context.Context, id, assignmentID gocql.UUID) (Assignment, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tickets[assignmentID]
+	if !ok || t.workerID != id || !time.Now().Before(t.expiresAt) {
+		return Assignment{}, false, nil //nolint:exhaustruct // not found
+	}
+
+	return t.assignment, true, nil
+}
+
+func (s *memoryStore) complete(_ context.Context, id, assignmentID gocql.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.assigned[id][assignmentID]
+	delete(s.assigned[id], assignmentID)
+	if t, found := s.tickets[assignmentID]; found && t.workerID == id {
+		delete(s.tickets, assignmentID)
+	}
+
+	return ok, nil
+}
+
+func (s *memoryStore) outstanding(_ context.Context, id gocql.UUID, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assigned := s.assigned[id]
+	for assignmentID, deadline := range assigned {
+		if !now.Before(deadline) {
+			delete(assigned, assignmentID)
+		}
+	}
+
+	return len(assigned), nil
+}
@@ -0,0 +1,469 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pingplex/pingplex/internal/events"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// StreamService is the gRPC service of the control stream.
+	StreamService = "pingplex.agents.v1.AgentControl"
+	// StreamMethod is the full name of the control stream method, the path
+	// agents sign when opening it.
+	StreamMethod = "/" + StreamService + "/Connect"
+
+	// streamPollWait is how long a stream waits for work before announcing itself again
+	streamPollWait = 30 * time.Second
+	streamOutbox   = 16
+)
+
+// Frame is a message of the control stream, exactly one payload is set.
+//
+// Agents send Ready, Heartbeat and Results frames. The server pushes Config
+// on connect, on heartbeats and on status changes, Work as soon as it is
+// assigned, and Ack for each Results frame.
+type Frame struct {
+	// Seq pairs a Results frame with its Ack
+	Seq uint64 `json:"seq,omitempty"`
+
+	Ready     *StreamReady           `json:"ready,omitempty"`
+	Heartbeat *StreamHeartbeat       `json:"heartbeat,omitempty"`
+	Results   *SubmitResultsRequest  `json:"results,omitempty"`
+	Config    *StreamConfig          `json:"config,omitempty"`
+	Work      *WorkResponse          `json:"work,omitempty"`
+	Ack       *SubmitResultsResponse `json:"ack,omitempty"`
+}
+
+// StreamReady grants the server more checks to push.
+type StreamReady struct {
+	// Checks the agent can take on top of the ones granted before
+	Slots int `json:"slots"`
+}
+
+// StreamHeartbeat records that the agent is alive.
+type StreamHeartbeat struct {
+	// Version the agent runs, when it changed since it registered
+	Version string `json:"version,omitempty" validate:"omitempty,max=64"`
+}
+
+// StreamConfig is the server side configuration of an agent.
+type StreamConfig struct {
+	HeartbeatResponse
+
+	// Seconds between heartbeats
+	HeartbeatInterval int `json:"heartbeatInterval"`
+}
+
+// JSONCodec encodes the control stream messages as JSON, so they share the
+// DTOs of the HTTP API.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+// StreamServer serves the control stream, an alternative to polling the HTTP
+// API: work is pushed as soon as it is assigned and results are streamed
+// back. The stream authenticates with the same signature headers as the HTTP
+// API, sent as metadata and signed over StreamMethod.
+type StreamServer struct {
+	config Config
+
+	agents    *Service
+	auth      *Authenticator
+	broker    *Broker
+	receiver  *Receiver
+	events    *events.Service
+	validator *validator.Validate
+
+	logger *zap.Logger
+}
+
+func NewStreamServer(
+	config Config,
+	agents *Service,
+	auth *Authenticator,
+	broker *Broker,
+	receiver *Receiver,
+	events *events.Service,
+	logger *zap.Logger,
+) *StreamServer {
+	if config.HeartbeatTimeout <= 0 {
+		config.HeartbeatTimeout = defaultHeartbeatTimeout
+	}
+
+	return &StreamServer{
+		config: config,
+
+		agents:    agents,
+		auth:      auth,
+		broker:    broker,
+		receiver:  receiver,
+		events:    events,
+		validator: validator.New(validator.WithRequiredStructEnabled()),
+
+		logger: logger,
+	}
+}
+
+// Register adds the control stream service to the gRPC server.
+func (s *StreamServer) Register(server *grpc.Server) {
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: StreamService,
+		HandlerType: (*interface{ connect(grpc.ServerStream) error })(nil),
+		Methods:     []grpc.MethodDesc{},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName: "Connect",
+				Handler: func(srv any, stream grpc.ServerStream) error {
+					return srv.(*StreamServer).connect(stream) //nolint:forcetypeassert // registered above
+				},
+				ServerStreams: true,
+				ClientStreams: true,
+			},
+		},
+		Metadata: "",
+	}, s)
+}
+
+func (s *StreamServer) connect(stream grpc.ServerStream) error {
+	agent, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	session := &session{
+		server: s,
+		stream: stream,
+		out:    make(chan Frame, streamOutbox),
+		slots:  make(chan int, 1),
+		wake:   make(chan struct{}, 1),
+
+		mu:    sync.Mutex{},
+		agent: agent,
+	}
+
+	s.logger.Info("agent connected", zap.Stringer("agent_id", agent.ID))
+	defer s.logger.Info("agent disconnected", zap.Stringer("agent_id", agent.ID))
+
+	return session.run()
+}
+
+func (s *StreamServer) authenticate(ctx context.Context) (Agent, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = p.Addr.String()
+	}
+
+	agent, err := s.auth.authenticate(ctx, signedRequest{
+		header: func(key string) string {
+			if values := md.Get(key); len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		},
+		method: http.MethodPost,
+		path:   StreamMethod,
+		body:   nil,
+		ip:     ip,
+	})
+	if authErr := (authError{}); errors.As(err, &authErr) {
+		if authErr.forbidden {
+			return Agent{}, status.Error(codes.PermissionDenied, authErr.message)
+		}
+		return Agent{}, status.Error(codes.Unauthenticated, authErr.message)
+	}
+	if err != nil {
+		return Agent{}, status.Error(codes.Internal, err.Error())
+	}
+
+	return agent, nil
+}
+
+func (s *StreamServer) streamConfig(agent Agent) StreamConfig {
+	return StreamConfig{
+		HeartbeatResponse: HeartbeatResponse{
+			Status:     string(agent.Status),
+			ServerTime: time.Now(),
+			Upgrade:    s.agents.Upgrade(agent),
+		},
+		HeartbeatInterval: int(s.config.HeartbeatTimeout / time.Second / 3), //nolint:mnd // three heartbeats per timeout
+	}
+}
+
+// session is an open control stream of one agent.
+type session struct {
+	server *StreamServer
+	stream grpc.ServerStream
+	out    chan Frame
+	// slots receives the checks granted by the agent
+	slots chan int
+	wake  chan struct{}
+
+	mu    sync.Mutex
+	agent Agent
+}
+
+// run serves the stream until the agent disconnects. Frames are received
+// here, sent by a single writer and work is pushed by its own goroutine.
+func (s *session) run() error {
+	ctx, cancel := context.WithCancel(s.stream.Context())
+
+	changed := make(chan struct{}, 1)
+	agentID := s.current().ID
+	unsubscribe := s.server.events.Subscribe(func(event events.Event) {
+		if event.Type != events.TypeAgentStatusChanged || event.AgentID != agentID {
+			return
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	wg.Go(func() { s.write(ctx, cancel) })
+	wg.Go(func() { s.push(ctx) })
+	wg.Go(func() { s.watch(ctx, cancel, changed) })
+
+	s.sendConfig(ctx, s.current())
+
+	for {
+		var frame Frame
+		err := s.stream.RecvMsg(&frame)
+		if agent := s.current(); !mayConnect(agent.Status) {
+			return status.Error(codes.PermissionDenied, "agent is "+string(agent.Status))
+		}
+		if errors.Is(err, io.EOF) || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if handleErr := s.handle(ctx, frame); handleErr != nil {
+			return handleErr
+		}
+	}
+}
+
+func (s *session) handle(ctx context.Context, frame Frame) error {
+	switch {
+	case frame.Ready != nil:
+		s.grant(frame.Ready.Slots)
+	case frame.Heartbeat != nil:
+		if err := s.server.validator.Struct(frame.Heartbeat); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		agent, err := s.server.agents.Heartbeat(ctx, s.current(), frame.Heartbeat.Version)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		s.update(agent)
+		s.sendConfig(ctx, agent)
+	case frame.Results != nil:
+		if err := s.server.validator.Struct(frame.Results); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		accepted, rejected, err := s.server.receiver.Submit(ctx, s.current(), frame.Results.toSubmissions())
+		if errors.Is(err, ErrNotActive) {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		ack := newSubmitResultsResponse(accepted, rejected)
+		s.send(ctx, Frame{Seq: frame.Seq, Ack: &ack})
+	}
+
+	return nil
+}
+
+func (s *session) grant(slots int) {
+	if slots <= 0 {
+		return
+	}
+
+	// Grants not taken by the pusher yet are merged.
+	for {
+		select {
+		case s.slots <- slots:
+			return
+		case pending := <-s.slots:
+			slots += pending
+		}
+	}
+}
+
+func (s *session) current() Agent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.agent
+}
+
+// update replaces the agent and wakes the pusher, which may now be allowed to push.
+func (s *session) update(agent Agent) {
+	s.mu.Lock()
+	s.agent = agent
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) sendConfig(ctx context.Context, agent Agent) {
+	config := s.server.streamConfig(agent)
+	s.send(ctx, Frame{Config: &config})
+}
+
+func (s *session) send(ctx context.Context, frame Frame) {
+	select {
+	case s.out <- frame:
+	case <-ctx.Done():
+	}
+}
+
+// write is the only sender on the stream, it ends the session when sending fails.
+func (s *session) write(ctx context.Context, cancel context.CancelFunc) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame := <-s.out:
+			if err := s.stream.SendMsg(&frame); err != nil {
+				s.server.logger.Warn(
+					"failed to send to agent",
+					zap.Stringer("agent_id", s.current().ID),
+					zap.Error(err),
+				)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// watch pushes the configuration when the agent status changes, it ends the
+// session once the agent may no longer connect, at its next frame.
+func (s *session) watch(ctx context.Context, cancel context.CancelFunc, changed <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+
+		agent, err := s.server.agents.Get(ctx, s.current().ID)
+		if err != nil {
+			s.server.logger.Error("failed to reload agent", zap.Stringer("agent_id", s.current().ID), zap.Error(err))
+			continue
+		}
+		s.update(agent)
+		s.sendConfig(ctx, agent)
+		if !mayConnect(agent.Status) {
+			cancel()
+			return
+		}
+	}
+}
+
+// push sends work within the slots granted by the agent. While the agent is
+// busy, not active or outdated, it is still announced, so its queued work
+// stays with it.
+func (s *session) push(ctx context.Context) {
+	ticker := time.NewTicker(streamPollWait)
+	defer ticker.Stop()
+
+	slots := 0
+	for {
+		if slots <= 0 || !s.server.broker.accepts(s.current()) {
+			select {
+			case <-ctx.Done():
+				return
+			case granted := <-s.slots:
+				slots += granted
+			case <-s.wake:
+			case <-ticker.C:
+				s.announce(ctx)
+			}
+			continue
+		}
+
+		// Slots granted meanwhile are taken by the next poll.
+		select {
+		case granted := <-s.slots:
+			slots += granted
+		default:
+		}
+
+		work, err := s.server.broker.Poll(ctx, s.current(), slots, streamPollWait)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !errors.Is(err, ErrNotActive) {
+			s.server.logger.Error("failed to poll work", zap.Stringer("agent_id", s.current().ID), zap.Error(err))
+			sleepCtx(ctx, pollInterval)
+			continue
+		}
+		if len(work) == 0 {
+			continue
+		}
+
+		slots -= len(work)
+		resp := newWorkResponse(work)
+		s.send(ctx, Frame{Work: &resp})
+	}
+}
+
+func (s *session) announce(ctx context.Context) {
+	agent := s.current()
+	if agent.Status != StatusActive || !s.server.broker.accepts(agent) {
+		return
+	}
+
+	if err := s.server.broker.announce(ctx, newWorker(agent, time.Now().Add(streamPollWait+workerGrace))); err != nil {
+		s.server.logger.Error("failed to announce agent", zap.Stringer("agent_id", agent.ID), zap.Error(err))
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
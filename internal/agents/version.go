@@ -0,0 +1,156 @@
+package agents
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// versionCore is the number of numeric version components compared.
+const versionCore = 3
+
+// versionPolicy is the agent versions the server works with.
+type versionPolicy struct {
+	// Minimum is the oldest version receiving work, empty for any
+	Minimum string
+	// Recommended is the version agents are asked to upgrade to, empty for none
+	Recommended string
+}
+
+func newVersionPolicy(config Config) versionPolicy {
+	return versionPolicy{Minimum: config.MinVersion, Recommended: config.RecommendedVersion}
+}
+
+// check refuses agents below the minimum version, including the ones
+// reporting a version that cannot be compared.
+func (p versionPolicy) check(version string) error {
+	if p.Minimum == "" {
+		return nil
+	}
+
+	if c, ok := compareVersions(version, p.Minimum); !ok || c < 0 {
+		return fmt.Errorf("%w: %q, upgrade to %s or later", ErrOutdated, version, p.Minimum)
+	}
+
+	return nil
+}
+
+// notice returns the upgrade notice of an agent running the version, nil
+// when it is up to date.
+func (p versionPolicy) notice(version string) *UpgradeNotice {
+	if err := p.check(version); err != nil {
+		return &UpgradeNotice{
+			Required:           true,
+			MinimumVersion:     p.Minimum,
+			RecommendedVersion: cmp.Or(p.Recommended, p.Minimum),
+			Message:            err.Error(),
+		}
+	}
+
+	if p.Recommended == "" {
+		return nil
+	}
+	if c, ok := compareVersions(version, p.Recommended); ok && c >= 0 {
+		return nil
+	}
+
+	return &UpgradeNotice{
+		Required:           false,
+		MinimumVersion:     p.Minimum,
+		RecommendedVersion: p.Recommended,
+		Message:            fmt.Sprintf("version %q is outdated, upgrade to %s", version, p.Recommended),
+	}
+}
+
+// status classifies the version against the policy.
+func (p versionPolicy) status(version string) VersionStatus {
+	switch notice := p.notice(version); {
+	case notice == nil:
+		return VersionCurrent
+	case notice.Required:
+		return VersionUnsupported
+	}
+
+	return VersionOutdated
+}
+
+// compareVersions compares versions like v1.2.3 or 1.2.3-rc.1 by their
+// numeric components, a pre-release sorting before its release and after
+// its lower pre-releases. It reports false when either version cannot be
+// parsed.
+func compareVersions(a, b string) (int, bool) {
+	coreA, preA, okA := parseVersion(a)
+	coreB, preB, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+
+	for i := range versionCore {
+		if c := cmp.Compare(coreA[i], coreB[i]); c != 0 {
+			return c, true
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0, true
+	case preA == "":
+		return 1, true
+	case preB == "":
+		return -1, true
+	}
+
+	return comparePrerelease(preA, preB), true
+}
+
+// comparePrerelease compares pre-releases like SemVer: dot separated
+// identifiers in order, numeric ones by value and before alphanumeric ones,
+// a shorter list of equal identifiers first.
+func comparePrerelease(a, b string) int {
+	idsA, idsB := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := range min(len(idsA), len(idsB)) {
+		numA, errA := strconv.ParseUint(idsA[i], 10, 64)
+		numB, errB := strconv.ParseUint(idsB[i], 10, 64)
+
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = cmp.Compare(numA, numB)
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(idsA[i], idsB[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(idsA), len(idsB))
+}
+
+func parseVersion(version string) ([versionCore]int, string, bool) {
+	var core [versionCore]int
+
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	version, _, _ = strings.Cut(version, "+")
+	version, pre, _ := strings.Cut(version, "-")
+
+	parts := strings.Split(version, ".")
+	if len(parts) > versionCore {
+		return core, "", false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return core, "", false
+		}
+		core[i] = n
+	}
+
+	return core, pre, true
+}
@@ -0,0 +1,94 @@
+package agents
+
+import (
+	"slices"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/scheduler"
+)
+
+// Assignment is a check queued for or handed to an agent.
+type Assignment struct {
+	ID            gocql.UUID        `json:"id"`
+	TargetID      gocql.UUID        `json:"targetId"`
+	Type          checker.Type      `json:"type"`
+	Kind          scheduler.JobKind `json:"kind"`
+	ScheduledAt   time.Time         `json:"scheduledAt"`
+	Interval      time.Duration     `json:"interval"`
+	Location      string            `json:"location"`
+	ExcludeAgents []gocql.UUID      `json:"excludeAgents,omitempty"`
+	Behind        bool              `json:"behind,omitempty"`
+	// IncidentID and FailedAt identify the failure diagnostics are collected for
+	IncidentID gocql.UUID `json:"incidentId,omitzero"`
+	FailedAt   time.Time  `json:"failedAt,omitzero"`
+}
+
+// Work is an assignment with the target to check, including its credentials.
+type Work struct {
+	Assignment
+	Target checker.Target
+}
+
+func newAssignment(job scheduler.Job) Assignment {
+	return Assignment{
+		ID:            gocql.MustRandomUUID(),
+		TargetID:      job.TargetID,
+		Type:          job.Type,
+		Kind:          job.Kind,
+		ScheduledAt:   job.ScheduledAt,
+		Interval:      job.Interval,
+		Location:      job.Location,
+		ExcludeAgents: job.ExcludeAgents,
+		Behind:        job.Behind,
+		IncidentID:    gocql.UUID{},
+		FailedAt:      time.Time{},
+	}
+}
+
+// job returns the scheduler job of the assignment, without its callback.
+func (a Assignment) job() scheduler.Job {
+	return scheduler.Job{
+		TargetID:      a.TargetID,
+		Type:          a.Type,
+		Kind:          a.Kind,
+		ScheduledAt:   a.ScheduledAt,
+		Interval:      a.Interval,
+		Location:      a.Location,
+		ExcludeAgents: a.ExcludeAgents,
+		Behind:        a.Behind,
+		Done:          nil,
+	}
+}
+
+// worker is an agent polling for work, as seen by the broker.
+type worker struct {
+	ID                  gocql.UUID `json:"id"`
+	Location            string     `json:"location"`
+	Regions             []string   `json:"regions"`
+	CheckTypes          []string   `json:"checkTypes"`
+	MaxConcurrentChecks int        `json:"maxConcurrentChecks"`
+	// Until is when the worker is considered gone without another poll
+	Until time.Time `json:"until"`
+}
+
+func newWorker(a Agent, until time.Time) worker {
+	return worker{
+		ID:                  a.ID,
+		Location:            a.Location,
+		Regions:             a.Capabilities.Regions,
+		CheckTypes:          a.Capabilities.CheckTypes,
+		MaxConcurrentChecks: a.Capabilities.MaxConcurrentChecks,
+		Until:               until,
+	}
+}
+
+// accepts reports whether the worker can run the assignment.
+func (w worker) accepts(a Assignment) bool {
+	if !slices.Contains(w.CheckTypes, string(a.Type)) || slices.Contains(a.ExcludeAgents, w.ID) {
+		return false
+	}
+
+	return a.Location == "" || a.Location == w.Location || slices.Contains(w.Regions, a.Location)
+}
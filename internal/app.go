@@ -7,9 +7,18 @@ import (
 	"github.com/go-core-fx/healthfx"
 	"github.com/go-core-fx/logger"
 	"github.com/go-core-fx/redisfx"
+	"github.com/pingplex/pingplex/internal/agents"
+	"github.com/pingplex/pingplex/internal/checker"
 	"github.com/pingplex/pingplex/internal/config"
 	"github.com/pingplex/pingplex/internal/db"
+	"github.com/pingplex/pingplex/internal/events"
+	"github.com/pingplex/pingplex/internal/incidents"
+	"github.com/pingplex/pingplex/internal/probe"
+	"github.com/pingplex/pingplex/internal/results"
+	"github.com/pingplex/pingplex/internal/scheduler"
+	"github.com/pingplex/pingplex/internal/secrets"
 	"github.com/pingplex/pingplex/internal/server"
+	"github.com/pingplex/pingplex/internal/targets"
 	"github.com/pingplex/pingplex/pkg/gocqlfx"
 	"github.com/pingplex/pingplex/pkg/gocqlxfx"
 	"go.uber.org/fx"
@@ -35,6 +44,14 @@ func Run(version healthfx.Version) {
 		//
 		// BUSINESS MODULES
 		// example.Module(),
+		checker.Module(),
+		secrets.Module(),
+		targets.Module(),
+		events.Module(),
+		incidents.Module(),
+		results.Module(),
+		scheduler.Module(),
+		agents.Module(),
 		//
 		fx.Supply(version),
 		fx.Invoke(func(lc fx.Lifecycle, logger *zap.Logger) {
@@ -51,3 +68,22 @@ func Run(version healthfx.Version) {
 		}),
 	).Run()
 }
+
+// RunAgent runs the binary as a remote probe agent: only the checks run
+// locally, work and results are exchanged with the server API.
+func RunAgent(version healthfx.Version) {
+	fx.New(
+		// CORE MODULES
+		logger.Module(),
+		logger.WithFxDefaultLogger(),
+		//
+		// APP MODULES
+		config.Module(),
+		//
+		// BUSINESS MODULES
+		checker.Module(),
+		probe.Module(),
+		//
+		fx.Supply(version),
+	).Run()
+}
@@ -0,0 +1,14 @@
+package checker
+
+import "context"
+
+// Checker probes targets of a single Type.
+//
+// Probe failures are reported through the Result status and message, so Check
+// never returns an error.
+type Checker interface {
+	// Type returns the target type handled by the checker.
+	Type() Type
+	// Check probes the target. The context carries the check deadline.
+	Check(ctx context.Context, target Target) Result
+}
@@ -0,0 +1,35 @@
+package checker
+
+import "time"
+
+// Config holds the configuration for the checker service.
+type Config struct {
+	// DefaultTimeout is used for targets without an explicit timeout
+	DefaultTimeout time.Duration
+	// Exec holds the configuration of the exec checker
+	Exec ExecConfig
+	// Diagnostics holds the configuration of failure diagnostics
+	Diagnostics DiagnosticsConfig
+}
+
+// ExecConfig holds the configuration of the Nagios-compatible exec checker.
+type ExecConfig struct {
+	// PluginDir is the only directory plugins are executed from
+	PluginDir string
+	// AllowedCommands lists plugin names that may be executed, an empty list disables exec checks
+	AllowedCommands []string
+	// MaxOutputBytes limits the captured plugin output
+	MaxOutputBytes int
+}
+
+// DiagnosticsConfig holds the limits of failure diagnostics.
+type DiagnosticsConfig struct {
+	// Timeout limits the whole diagnostics run
+	Timeout time.Duration
+	// MaxHops limits the traced network path
+	MaxHops int
+	// HopTimeout is how long to wait for a reply from each hop
+	HopTimeout time.Duration
+	// MaxBodyBytes limits the captured response body
+	MaxBodyBytes int
+}
@@ -0,0 +1,170 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/ohler55/ojg/jp"
+	"github.com/ohler55/ojg/oj"
+	"golang.org/x/net/html"
+)
+
+const maxSnapshotBytes = 64 * 1024
+
+// contentChecker fetches a page like the HTTP checker and fingerprints the
+// normalized response, so changes can be detected between checks.
+type contentChecker struct {
+	http *httpChecker
+}
+
+func newContentChecker(oauth2 *oauth2Client) Checker {
+	return &contentChecker{
+		http: &httpChecker{
+			oauth2:       oauth2,
+			maxBodyBytes: defaultMaxBodyBytes,
+		},
+	}
+}
+
+func (c *contentChecker) Type() Type {
+	return TypeContentChange
+}
+
+func (c *contentChecker) Check(ctx context.Context, target Target) Result {
+	result, body, _ := c.http.probe(ctx, target, true)
+	if result.Status != StatusUp {
+		return result
+	}
+
+	normalized, err := normalizeContent(body, target.Config)
+	if err != nil {
+		result.Status = StatusError
+		result.Message = err.Error()
+		return result
+	}
+	if normalized == "" && (target.Config.Selector != "" || target.Config.JSONPath != "") {
+		result.Status = StatusDown
+		result.Message = ErrNoContent.Error()
+		return result
+	}
+
+	sum := sha256.Sum256([]byte(normalized))
+	result.Content = &Content{
+		Hash:     hex.EncodeToString(sum[:]),
+		Snapshot: truncateUTF8(normalized, maxSnapshotBytes),
+	}
+
+	return result
+}
+
+// normalizeContent reduces the body to the content that matters for change
+// detection: the selected elements text, the selected JSON values or the
+// whole body with whitespace noise removed.
+func normalizeContent(body []byte, config CheckConfig) (string, error) {
+	switch {
+	case config.JSONPath != "":
+		return selectJSON(body, config.JSONPath)
+	case config.Selector != "":
+		return selectHTML(body, config.Selector)
+	}
+
+	if value, err := oj.Parse(body); err == nil {
+		// Canonical form, so key order and formatting changes are not reported.
+		return oj.JSON(value, &oj.Options{Sort: true, Indent: 2}), nil //nolint:exhaustruct // defaults
+	}
+
+	return normalizeText(string(body)), nil
+}
+
+func selectJSON(body []byte, path string) (string, error) {
+	expr, err := jp.ParseString(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidSelector, err)
+	}
+
+	value, err := oj.Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("%w: response is not json: %w", ErrInvalidSelector, err)
+	}
+
+	matches := expr.Get(value)
+	if len(matches) == 0 {
+		return "", nil
+	}
+
+	lines := make([]string, len(matches))
+	for i, m := range matches {
+		lines[i] = oj.JSON(m, &oj.Options{Sort: true, Indent: 2}) //nolint:exhaustruct // defaults
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func selectHTML(body []byte, selector string) (string, error) {
+	sel, err := cascadia.Parse(selector)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidSelector, err)
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse html: %w", err)
+	}
+
+	var sb strings.Builder
+	for _, node := range cascadia.QueryAll(doc, sel) {
+		writeText(&sb, node)
+		sb.WriteByte('\n')
+	}
+
+	return normalizeText(sb.String()), nil
+}
+
+// writeText writes the text content of the node, skipping scripts and styles.
+func writeText(sb *strings.Builder, node *html.Node) {
+	if node.Type == html.ElementNode && (node.Data == "script" || node.Data == "style") {
+		return
+	}
+	if node.Type == html.TextNode {
+		sb.WriteString(node.Data)
+		sb.WriteByte('\n')
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeText(sb, child)
+	}
+}
+
+// normalizeText collapses whitespace within lines and drops empty lines.
+func normalizeText(text string) string {
+	lines := strings.Split(text, "\n")
+
+	kept := lines[:0]
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			kept = append(kept, line)
+		}
+	}
+
+	return strings.Join(kept, "\n")
+}
+
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+
+	s = s[:limit]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
@@ -0,0 +1,324 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	defaultCrawlLimit = 100
+	maxCrawlLimit     = 1000
+	maxCrawlDepth     = 3
+	crawlConcurrency  = 8
+)
+
+// linkAttrs maps elements to the attribute holding the linked resource.
+//
+//nolint:gochecknoglobals // lookup table
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"link":   "href",
+	"script": "src",
+	"img":    "src",
+	"iframe": "src",
+	"source": "src",
+	"video":  "src",
+	"audio":  "src",
+}
+
+// crawlLink is a resource found on a crawled page.
+type crawlLink struct {
+	url  string
+	page string
+	// anchor marks page links, which may be crawled further
+	anchor bool
+}
+
+// crawlChecker fetches a page and checks the resources it links to.
+type crawlChecker struct {
+	http *httpChecker
+}
+
+func newCrawlChecker(oauth2 *oauth2Client) Checker {
+	return &crawlChecker{
+		http: &httpChecker{
+			oauth2:       oauth2,
+			maxBodyBytes: defaultMaxBodyBytes,
+		},
+	}
+}
+
+func (c *crawlChecker) Type() Type {
+	return TypeCrawl
+}
+
+func (c *crawlChecker) Check(ctx context.Context, target Target) Result {
+	start := time.Now()
+
+	result, body, page := c.http.probe(ctx, target, true)
+	if result.Status != StatusUp {
+		return result
+	}
+
+	root, err := url.Parse(target.URL)
+	if err != nil {
+		return Result{Status: StatusError, Message: fmt.Sprintf("%s: %s", ErrInvalidRequest, err)}
+	}
+
+	d, err := newDialer(target.Config.ProxyURL, target.Family)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}
+	}
+
+	client, err := c.http.newClient(d, target.Config)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}
+	}
+	defer client.CloseIdleConnections()
+
+	w := &crawler{
+		checker: c,
+		client:  client,
+		target:  target,
+		// A redirect to https or another host keeps the site the same.
+		origins: []*url.URL{page, root},
+		limit:   crawlLimit(target.Config.CrawlLimit),
+		seen:    map[string]struct{}{root.String(): {}, page.String(): {}},
+		checked: 0,
+		broken:  nil,
+		mu:      sync.Mutex{},
+	}
+	// Relative links are relative to the page the target redirected to.
+	w.run(ctx, extractLinks(page, body), min(target.Config.CrawlDepth, maxCrawlDepth))
+
+	result.ResponseTime = time.Since(start)
+	result.BrokenLinks = w.broken
+	result.Message = fmt.Sprintf("%d of %d resources broken", len(w.broken), w.checked)
+
+	switch {
+	case len(w.broken) > target.Config.CrawlThreshold:
+		result.Status = StatusDown
+	case len(w.broken) > 0:
+		result.Status = StatusDegraded
+	}
+
+	return result
+}
+
+func crawlLimit(limit int) int {
+	if limit <= 0 {
+		return defaultCrawlLimit
+	}
+	return min(limit, maxCrawlLimit)
+}
+
+// crawler holds the state of a single crawl check.
+type crawler struct {
+	checker *crawlChecker
+	client  *http.Client
+	target  Target
+	origins []*url.URL
+	limit   int
+
+	seen    map[string]struct{}
+	checked int
+	broken  []BrokenLink
+	mu      sync.Mutex
+}
+
+// run checks the links level by level, descending into same-origin pages
+// until the depth is exhausted.
+func (w *crawler) run(ctx context.Context, links []crawlLink, depth int) {
+	for level := 0; len(links) > 0 && ctx.Err() == nil; level++ {
+		batch := w.admit(links)
+		descend := level < depth
+
+		var (
+			next []crawlLink
+			wg   sync.WaitGroup
+		)
+		sem := make(chan struct{}, crawlConcurrency)
+
+		for _, link := range batch {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				found := w.check(ctx, link, descend && link.anchor && w.sameOrigin(link.url))
+
+				w.mu.Lock()
+				next = append(next, found...)
+				w.mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		links = next
+	}
+}
+
+// admit filters out seen and out-of-scope links, up to the crawl limit.
+func (w *crawler) admit(links []crawlLink) []crawlLink {
+	admitted := make([]crawlLink, 0, len(links))
+	for _, link := range links {
+		if w.checked >= w.limit {
+			break
+		}
+		if _, ok := w.seen[link.url]; ok {
+			continue
+		}
+		if !w.target.Config.CrawlExternal && !w.sameOrigin(link.url) {
+			continue
+		}
+
+		w.seen[link.url] = struct{}{}
+		w.checked++
+		admitted = append(admitted, link)
+	}
+
+	return admitted
+}
+
+// check requests the resource, records it when broken and returns the links
+// of the page when descend is set.
+func (w *crawler) check(ctx context.Context, link crawlLink, descend bool) []crawlLink {
+	method := http.MethodHead
+	if descend {
+		method = http.MethodGet
+	}
+
+	resp, err := w.request(ctx, method, link.url)
+	if err == nil && method == http.MethodHead &&
+		(resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		_ = resp.Body.Close()
+		resp, err = w.request(ctx, http.MethodGet, link.url)
+	}
+	if err != nil {
+		w.record(BrokenLink{URL: link.url, Page: link.page, Status: 0, Error: err.Error()})
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		w.record(BrokenLink{URL: link.url, Page: link.page, Status: resp.StatusCode, Error: ""})
+		return nil
+	}
+
+	if !descend || !isHTML(resp.Header.Get("Content-Type")) {
+		return nil
+	}
+
+	var body bytes.Buffer
+	if _, copyErr := io.Copy(&body, io.LimitReader(resp.Body, w.checker.http.maxBodyBytes)); copyErr != nil {
+		return nil
+	}
+
+	return extractLinks(resp.Request.URL, body.Bytes())
+}
+
+func (w *crawler) request(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	if w.sameOrigin(rawURL) {
+		// Credentials are only sent to the target origin.
+		for k, v := range w.target.Config.Headers {
+			req.Header.Set(k, v)
+		}
+		if authErr := w.checker.http.authorize(ctx, req, w.target.Config.Auth); authErr != nil {
+			return nil, authErr
+		}
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (w *crawler) record(link BrokenLink) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.broken = append(w.broken, link)
+}
+
+func (w *crawler) sameOrigin(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	return slices.ContainsFunc(w.origins, func(origin *url.URL) bool {
+		return u.Scheme == origin.Scheme && u.Host == origin.Host
+	})
+}
+
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/html"
+}
+
+// extractLinks returns the absolute http(s) links of the page, without fragments.
+func extractLinks(base *url.URL, body []byte) []crawlLink {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	var links []crawlLink
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			if attr, ok := linkAttrs[node.Data]; ok {
+				if link, found := resolveLink(base, node, attr); found {
+					links = append(links, link)
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return links
+}
+
+func resolveLink(base *url.URL, node *html.Node, attr string) (crawlLink, bool) {
+	for _, a := range node.Attr {
+		if a.Key != attr || strings.TrimSpace(a.Val) == "" {
+			continue
+		}
+
+		ref, err := base.Parse(strings.TrimSpace(a.Val))
+		if err != nil || (ref.Scheme != "http" && ref.Scheme != "https") {
+			return crawlLink{}, false //nolint:exhaustruct // not found
+		}
+		ref.Fragment = ""
+
+		return crawlLink{url: ref.String(), page: base.String(), anchor: node.Data == "a"}, true
+	}
+
+	return crawlLink{}, false //nolint:exhaustruct // not found
+}
@@ -0,0 +1,194 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDiagnosticsTimeout = 30 * time.Second
+	defaultMaxHops            = 20
+	defaultHopTimeout         = time.Second
+	defaultSnapshotBytes      = 8 * 1024
+)
+
+// diagnoser collects the state of failing targets.
+type diagnoser struct {
+	config DiagnosticsConfig
+	http   *httpChecker
+}
+
+func newDiagnoser(config Config, oauth2 *oauth2Client) *diagnoser {
+	diag := config.Diagnostics
+	if diag.Timeout <= 0 {
+		diag.Timeout = defaultDiagnosticsTimeout
+	}
+	if diag.MaxHops <= 0 {
+		diag.MaxHops = defaultMaxHops
+	}
+	if diag.HopTimeout <= 0 {
+		diag.HopTimeout = defaultHopTimeout
+	}
+	if diag.MaxBodyBytes <= 0 {
+		diag.MaxBodyBytes = defaultSnapshotBytes
+	}
+
+	return &diagnoser{
+		config: diag,
+		http: &httpChecker{
+			oauth2:       oauth2,
+			maxBodyBytes: int64(diag.MaxBodyBytes),
+		},
+	}
+}
+
+// Diagnose resolves the target host, traces the network path to it and, for
+// HTTP based targets, captures a response snapshot. Failures of each step are
+// reported in the result.
+func (d *diagnoser) Diagnose(ctx context.Context, target Target) Diagnostics {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	diag := Diagnostics{
+		CollectedAt:     time.Now(),
+		ResolvedIPs:     nil,
+		DNSError:        "",
+		Path:            nil,
+		PathError:       "",
+		ResponseCode:    0,
+		ResponseHeaders: nil,
+		ResponseBody:    "",
+		ResponseError:   "",
+	}
+
+	var wg sync.WaitGroup
+	if isHTTPType(target.Type) {
+		wg.Go(func() {
+			d.snapshot(ctx, target, &diag)
+		})
+	}
+
+	d.network(ctx, target, &diag)
+	wg.Wait()
+
+	return diag
+}
+
+// network fills in the resolved addresses and the network path.
+func (d *diagnoser) network(ctx context.Context, target Target, diag *Diagnostics) {
+	host, port, err := targetHostPort(target)
+	if err != nil {
+		diag.DNSError = err.Error()
+		diag.PathError = err.Error()
+		return
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		diag.DNSError = err.Error()
+		diag.PathError = "no address to trace"
+		return
+	}
+
+	diag.ResolvedIPs = make([]string, len(addrs))
+	for i, addr := range addrs {
+		diag.ResolvedIPs[i] = addr.IP.String()
+	}
+
+	if target.Config.ProxyURL != "" {
+		diag.PathError = "skipped, the target is checked through a proxy"
+		return
+	}
+
+	path, err := tracePath(ctx, addrs[0].IP, port, d.config.MaxHops, d.config.HopTimeout)
+	diag.Path = path
+	if err != nil {
+		diag.PathError = err.Error()
+	}
+}
+
+// snapshot fills in the response status, headers and the beginning of the body.
+func (d *diagnoser) snapshot(ctx context.Context, target Target, diag *Diagnostics) {
+	dialer, err := newDialer(target.Config.ProxyURL, target.Family)
+	if err != nil {
+		diag.ResponseError = err.Error()
+		return
+	}
+
+	client, err := d.http.newClient(dialer, target.Config)
+	if err != nil {
+		diag.ResponseError = err.Error()
+		return
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := d.http.do(ctx, client, target)
+	if err != nil {
+		diag.ResponseError = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+
+	diag.ResponseCode = resp.StatusCode
+	diag.ResponseHeaders = make(map[string]string, len(resp.Header))
+	for k, v := range resp.Header {
+		diag.ResponseHeaders[k] = strings.Join(v, ", ")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, d.http.maxBodyBytes))
+	diag.ResponseBody = strings.ToValidUTF8(string(body), "")
+	if err != nil {
+		diag.ResponseError = err.Error()
+	}
+}
+
+func isHTTPType(t Type) bool {
+	return t == TypeHTTP || t == TypeContentChange || t == TypeCrawl
+}
+
+// targetHostPort extracts the network address probed by the target.
+func targetHostPort(target Target) (string, int, error) {
+	addr := ""
+	switch {
+	case target.URL == "":
+		return "", 0, ErrNoAddress
+	case target.Type == TypeTCP:
+		tcp, err := tcpAddr(target.URL)
+		if err != nil {
+			return "", 0, err
+		}
+		addr = tcp
+	default:
+		u, err := url.Parse(target.URL)
+		if err != nil || u.Hostname() == "" {
+			return "", 0, fmt.Errorf("%w: %q", ErrNoAddress, target.URL)
+		}
+		addr = proxyAddr(u, defaultPort(u.Scheme))
+	}
+
+	host, rawPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %w", ErrNoAddress, err)
+	}
+
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: invalid port %q", ErrNoAddress, rawPort)
+	}
+
+	return host, port, nil
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" || scheme == "wss" {
+		return "443"
+	}
+	return "80"
+}
@@ -0,0 +1,223 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const (
+	defaultHTTPProxyPort  = "80"
+	defaultHTTPSProxyPort = "443"
+	defaultSOCKSProxyPort = "1080"
+)
+
+// dialer opens connections to targets, optionally through an HTTP CONNECT or
+// SOCKS5 proxy. It records how long it took to reach the proxy itself, so the
+// proxy hop can be reported separately from the target latency.
+type dialer struct {
+	proxy *url.URL
+	// network overrides the dialed network to restrict direct connections to one address family
+	network string
+
+	// proxyConnect is the total of the proxy connect times in nanoseconds, dials
+	// run on transport goroutines that may outlive a canceled request
+	proxyConnect atomic.Int64
+}
+
+func newDialer(proxyURL string, family IPFamily) (*dialer, error) {
+	d := &dialer{proxy: nil, network: family.network(), proxyConnect: atomic.Int64{}}
+	if proxyURL == "" {
+		return d, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		// The parse error quotes the URL, credentials included.
+		return nil, fmt.Errorf("%w: malformed url", ErrInvalidProxy)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidProxy, u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: missing host", ErrInvalidProxy)
+	}
+
+	d.proxy = u
+	return d, nil
+}
+
+// ProxyConnectTime returns the time spent connecting to the proxy by all dials
+// so far, redirects included, as they all count towards the elapsed time.
+func (d *dialer) ProxyConnectTime() time.Duration {
+	return time.Duration(d.proxyConnect.Load())
+}
+
+// DialContext connects to addr, tunneling through the proxy when one is configured.
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.proxy == nil {
+		if d.network != "" {
+			network = d.network
+		}
+
+		conn, err := new(net.Dialer).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, fmt.Errorf("dial %s: %w", addr, err)
+		}
+		return conn, nil
+	}
+
+	switch d.proxy.Scheme {
+	case "socks5", "socks5h":
+		return d.dialSOCKS5(ctx, network, addr)
+	default:
+		return d.dialConnect(ctx, addr)
+	}
+}
+
+func (d *dialer) dialSOCKS5(ctx context.Context, network, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if d.proxy.User != nil {
+		password, _ := d.proxy.User.Password()
+		auth = &proxy.Auth{User: d.proxy.User.Username(), Password: password}
+	}
+
+	forward := &timedDialer{dialer: new(net.Dialer), elapsed: 0, connected: false}
+	socks, err := proxy.SOCKS5("tcp", proxyAddr(d.proxy, defaultSOCKSProxyPort), auth, forward)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxy, err)
+	}
+
+	conn, err := socks.(proxy.ContextDialer).DialContext(ctx, network, addr) //nolint:errcheck // SOCKS5 dialer implements ContextDialer
+	d.proxyConnect.Add(int64(forward.elapsed))
+	if err != nil {
+		if !forward.connected {
+			return nil, fmt.Errorf("%w: %w", ErrProxyConnect, err)
+		}
+		return nil, fmt.Errorf("%w: socks5 %s: %w", ErrProxyTunnel, addr, err)
+	}
+
+	return conn, nil
+}
+
+func (d *dialer) dialConnect(ctx context.Context, addr string) (net.Conn, error) {
+	start := time.Now()
+
+	port := defaultHTTPProxyPort
+	if d.proxy.Scheme == "https" {
+		port = defaultHTTPSProxyPort
+	}
+
+	conn, err := new(net.Dialer).DialContext(ctx, "tcp", proxyAddr(d.proxy, port))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProxyConnect, err)
+	}
+
+	if d.proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.proxy.Hostname(), MinVersion: tls.VersionTLS12})
+		if hsErr := tlsConn.HandshakeContext(ctx); hsErr != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%w: tls handshake: %w", ErrProxyConnect, hsErr)
+		}
+		conn = tlsConn
+	}
+	d.proxyConnect.Add(int64(time.Since(start)))
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.proxy.User != nil {
+		password, _ := d.proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(d.proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if wErr := req.Write(conn); wErr != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: write CONNECT: %w", ErrProxyConnect, wErr)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: read CONNECT response: %w", ErrProxyConnect, err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: CONNECT %s: %s", ErrProxyConnect, addr, resp.Status)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: CONNECT %s: %s", ErrProxyTunnel, addr, resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		// The target spoke first (e.g. a banner), keep the already read bytes.
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+func proxyAddr(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// timedDialer measures the time spent connecting to the proxy.
+type timedDialer struct {
+	dialer    *net.Dialer
+	elapsed   time.Duration
+	connected bool
+}
+
+func (d *timedDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *timedDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	d.elapsed = time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy: %w", err)
+	}
+	d.connected = true
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads are served from a bufio.Reader first.
+type bufferedConn struct {
+	net.Conn
+
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p) //nolint:wrapcheck // transparent wrapper
+}
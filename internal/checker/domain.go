@@ -0,0 +1,297 @@
+package checker
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Type identifies the kind of probe executed for a target.
+type Type string
+
+const (
+	TypeHTTP      Type = "http"
+	TypeTCP       Type = "tcp"
+	TypeWebSocket Type = "websocket"
+	TypeExec      Type = "exec"
+	// TypeContentChange fetches a page like TypeHTTP and fingerprints its content
+	TypeContentChange Type = "content_change"
+	// TypeCrawl fetches a page and checks the resources it links to
+	TypeCrawl Type = "crawl"
+)
+
+// Status is the outcome of a single check.
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+	StatusTimeout  Status = "timeout"
+	StatusError    Status = "error"
+	// StatusPending marks a target whose failure is being confirmed, it is
+	// never reported by checkers
+	StatusPending Status = "pending"
+)
+
+// IPFamily is an IP address family.
+type IPFamily string
+
+const (
+	FamilyAny  IPFamily = ""
+	FamilyIPv4 IPFamily = "ipv4"
+	FamilyIPv6 IPFamily = "ipv6"
+)
+
+func (f IPFamily) network() string {
+	switch f {
+	case FamilyIPv4:
+		return "tcp4"
+	case FamilyIPv6:
+		return "tcp6"
+	case FamilyAny:
+	}
+	return ""
+}
+
+// FamilyRule derives the status of dual-stack checks from the per-family results.
+type FamilyRule string
+
+const (
+	// FamilyRuleAll requires every address family to be up
+	FamilyRuleAll FamilyRule = "all"
+	// FamilyRuleAny requires at least one address family to be up
+	FamilyRuleAny FamilyRule = "any"
+)
+
+// Target is the checker's view of a monitored target.
+type Target struct {
+	// ID is the target identifier
+	ID gocql.UUID
+	// Type selects the checker used to probe the target
+	Type Type
+	// URL is the probe address, its meaning depends on the Type
+	URL string
+	// Config holds type-specific probe settings
+	Config CheckConfig
+	// Family restricts the probe to one address family, set for each probe of dual-stack checks
+	Family IPFamily
+}
+
+// AuthType selects the authentication scheme of HTTP checks.
+type AuthType string
+
+const (
+	AuthNone   AuthType = ""
+	AuthBasic  AuthType = "basic"
+	AuthBearer AuthType = "bearer"
+	AuthOAuth2 AuthType = "oauth2"
+)
+
+// Auth holds HTTP check credentials, mirroring the check_auth UDT.
+type Auth struct {
+	// Type selects the authentication scheme
+	Type AuthType
+	// Username is the basic auth user name
+	Username string
+	// Password is the basic auth password
+	Password string
+	// Token is the static bearer token
+	Token string
+	// TokenURL is the OAuth2 token endpoint for the client credentials grant
+	TokenURL string
+	// ClientID is the OAuth2 client identifier
+	ClientID string
+	// ClientSecret is the OAuth2 client secret
+	ClientSecret string
+	// Scopes are requested with the OAuth2 token
+	Scopes []string
+}
+
+// CheckConfig holds per-target probe settings, mirroring the check_config UDT.
+type CheckConfig struct {
+	// Timeout limits a single check, zero means the service default
+	Timeout time.Duration
+	// Method is the HTTP request method
+	Method string
+	// Headers are sent with HTTP requests
+	Headers map[string]string
+	// Body is sent with HTTP requests
+	Body string
+	// FollowRedirects enables following HTTP redirects
+	FollowRedirects bool
+	// VerifySSL enables TLS certificate verification
+	VerifySSL bool
+	// ProxyURL routes HTTP, TCP and WebSocket checks through an HTTP CONNECT
+	// (http://, https://) or SOCKS5 (socks5://) proxy, credentials go into the userinfo
+	ProxyURL string
+	// Auth holds credentials for HTTP checks
+	Auth Auth
+	// ClientCert is a PEM encoded client certificate for mTLS
+	ClientCert string
+	// ClientKey is the PEM encoded private key of ClientCert
+	ClientKey string
+
+	// Command is the plugin name for exec checks, relative to the plugin directory
+	Command string
+	// Args are passed to the plugin as-is
+	Args []string
+
+	// Selector is a CSS selector limiting content_change checks to the text of the matched elements
+	Selector string
+	// JSONPath limits content_change checks to the matched JSON values
+	JSONPath string
+
+	// CrawlDepth is how many levels of linked pages crawl checks follow, zero checks the start page links only
+	CrawlDepth int
+	// CrawlLimit caps the number of resources checked by crawl checks, zero means the default
+	CrawlLimit int
+	// CrawlExternal makes crawl checks include resources of other origins
+	CrawlExternal bool
+	// CrawlThreshold is the number of broken resources tolerated before the target is down
+	CrawlThreshold int
+
+	// DualStack probes the IPv4 and IPv6 addresses of the target separately
+	DualStack bool
+	// FamilyRule derives the dual-stack check status, empty means FamilyRuleAll
+	FamilyRule FamilyRule
+}
+
+// Metric is a single performance data item reported by a check.
+type Metric struct {
+	// Label is the metric name
+	Label string `json:"label"`
+	// Value is the measured value
+	Value float64 `json:"value"`
+	// Unit is the unit of measurement, e.g. "ms", "%" or "B"
+	Unit string `json:"unit,omitempty"`
+	// Warn is the warning threshold range in Nagios range format
+	Warn string `json:"warn,omitempty"`
+	// Crit is the critical threshold range in Nagios range format
+	Crit string `json:"crit,omitempty"`
+	// Min is the minimal possible value
+	Min *float64 `json:"min,omitempty"`
+	// Max is the maximal possible value
+	Max *float64 `json:"max,omitempty"`
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	// TargetID is the checked target
+	TargetID gocql.UUID
+	// CheckTime is the time the check started
+	CheckTime time.Time
+	// Status is the check outcome
+	Status Status
+	// ResponseTime is the check duration, excluding ProxyConnectTime
+	ResponseTime time.Duration
+	// ProxyConnectTime is the time spent connecting to the outbound proxy
+	ProxyConnectTime time.Duration
+	// ResponseCode is a protocol-specific code, e.g. HTTP status or plugin exit code
+	ResponseCode int
+	// Message is a human-readable description of the outcome
+	Message string
+	// SSLExpiry is the expiration time of the target TLS certificate, if any
+	SSLExpiry time.Time
+	// Metrics is the structured performance data reported by the check
+	Metrics []Metric
+	// Content is the fingerprint of content_change checks
+	Content *Content
+	// BrokenLinks are the failed resources found by crawl checks
+	BrokenLinks []BrokenLink
+	// Family is the probed address family of a per-family result
+	Family IPFamily
+	// Families are the per-family results of dual-stack checks
+	Families []Result
+}
+
+// Content is the normalized content of a content_change check.
+type Content struct {
+	// Hash is the hex encoded SHA-256 of the normalized content
+	Hash string
+	// Snapshot is the normalized content, truncated to the snapshot limit
+	Snapshot string
+}
+
+// BrokenLink is a resource that failed to load during a crawl check.
+type BrokenLink struct {
+	// URL is the absolute resource address
+	URL string `json:"url"`
+	// Page is the page linking to the resource
+	Page string `json:"page"`
+	// Status is the HTTP status code, zero when the request failed
+	Status int `json:"status,omitempty"`
+	// Error is the request error, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Hop is a single step of a traced network path.
+type Hop struct {
+	// TTL is the probe time-to-live, starting at 1
+	TTL int
+	// Addr is the address of the replying router, empty when no reply arrived
+	Addr string
+	// RTT is the probe round-trip time
+	RTT time.Duration
+}
+
+// Diagnostics is the state of a failing target captured for troubleshooting.
+type Diagnostics struct {
+	// CollectedAt is the time the collection started
+	CollectedAt time.Time
+	// ResolvedIPs are the addresses of the target host
+	ResolvedIPs []string
+	// DNSError is the host resolution error, if any
+	DNSError string
+	// Path is the network path to the target, traced with TCP probes
+	Path []Hop
+	// PathError is the path tracing error, if any
+	PathError string
+	// ResponseCode is the HTTP status of the response snapshot
+	ResponseCode int
+	// ResponseHeaders are the headers of the response snapshot
+	ResponseHeaders map[string]string
+	// ResponseBody is the beginning of the response snapshot body
+	ResponseBody string
+	// ResponseError is the response snapshot error, if any
+	ResponseError string
+}
+
+// RedactedHeader replaces the values of sensitive response headers in
+// diagnostics.
+const RedactedHeader = "[redacted]"
+
+// sensitiveHeaders are response headers carrying credentials or sessions.
+//
+//nolint:gochecknoglobals // lookup table
+var sensitiveHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Cookie":              {},
+	"Proxy-Authorization": {},
+	"Set-Cookie":          {},
+	"Set-Cookie2":         {},
+	"X-Api-Key":           {},
+	"X-Auth-Token":        {},
+	"X-Csrf-Token":        {},
+	"X-Xsrf-Token":        {},
+}
+
+// Redacted returns the diagnostics with the values of sensitive response
+// headers replaced, they are stored and shown to every user of the target.
+func (d Diagnostics) Redacted() Diagnostics {
+	if len(d.ResponseHeaders) == 0 {
+		return d
+	}
+
+	headers := make(map[string]string, len(d.ResponseHeaders))
+	for k, v := range d.ResponseHeaders {
+		if _, ok := sensitiveHeaders[http.CanonicalHeaderKey(k)]; ok {
+			v = RedactedHeader
+		}
+		headers[k] = v
+	}
+	d.ResponseHeaders = headers
+
+	return d
+}
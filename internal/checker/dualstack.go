@@ -0,0 +1,108 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+//nolint:gochecknoglobals // lookup table
+var statusSeverity = map[Status]int{
+	StatusUp:       0,
+	StatusDegraded: 1,
+	StatusTimeout:  2,
+	StatusDown:     3,
+	StatusError:    4,
+}
+
+func supportsDualStack(t Type) bool {
+	return t != TypeExec
+}
+
+// checkDualStack probes the IPv4 and IPv6 addresses of the target separately
+// and combines the results according to the target family rule.
+func checkDualStack(ctx context.Context, c Checker, target Target) Result {
+	host, _, err := targetHostPort(target)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}
+	}
+
+	if net.ParseIP(host) != nil {
+		// An address literal has a single family.
+		return c.Check(ctx, target)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return Result{Status: StatusDown, Message: err.Error()}
+	}
+
+	resolved := map[IPFamily]bool{}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			resolved[FamilyIPv4] = true
+		} else {
+			resolved[FamilyIPv6] = true
+		}
+	}
+
+	families := []IPFamily{FamilyIPv4, FamilyIPv6}
+	results := make([]Result, len(families))
+
+	var wg sync.WaitGroup
+	for i, family := range families {
+		if !resolved[family] {
+			results[i] = Result{
+				Status:  StatusDown,
+				Message: fmt.Sprintf("no %s records for %s", recordType(family), host),
+				Family:  family,
+			}
+			continue
+		}
+
+		wg.Go(func() {
+			probe := target
+			probe.Family = family
+
+			results[i] = c.Check(ctx, probe)
+			results[i].Family = family
+		})
+	}
+	wg.Wait()
+
+	return combineFamilies(target.Config.FamilyRule, results)
+}
+
+// combineFamilies reports the best per-family result with FamilyRuleAny and
+// the worst one otherwise, keeping all of them in Families.
+func combineFamilies(rule FamilyRule, results []Result) Result {
+	pick := results[0]
+	for _, r := range results[1:] {
+		better := statusSeverity[r.Status] < statusSeverity[pick.Status]
+		worse := statusSeverity[r.Status] > statusSeverity[pick.Status]
+		if (rule == FamilyRuleAny && better) || (rule != FamilyRuleAny && worse) {
+			pick = r
+		}
+	}
+
+	messages := make([]string, len(results))
+	for i, r := range results {
+		messages[i] = fmt.Sprintf("%s: %s", r.Family, r.Message)
+	}
+
+	combined := pick
+	combined.Family = FamilyAny
+	combined.Message = strings.Join(messages, "; ")
+	combined.Families = results
+
+	return combined
+}
+
+func recordType(family IPFamily) string {
+	if family == FamilyIPv6 {
+		return "AAAA"
+	}
+	return "A"
+}
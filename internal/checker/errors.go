@@ -0,0 +1,22 @@
+package checker
+
+import "errors"
+
+var (
+	ErrUnsupportedType   = errors.New("unsupported check type")
+	ErrCommandNotAllowed = errors.New("command is not allowed")
+	ErrInvalidPerfdata   = errors.New("invalid perfdata")
+	ErrInvalidProxy      = errors.New("invalid proxy")
+	ErrProxyConnect      = errors.New("proxy connection failed")
+	ErrProxyTunnel       = errors.New("proxy tunnel failed")
+
+	ErrWebSocketHandshake = errors.New("websocket handshake failed")
+	ErrInvalidRequest     = errors.New("invalid request")
+	ErrOAuth2Token        = errors.New("failed to obtain oauth2 token")
+
+	ErrInvalidSelector = errors.New("invalid content selector")
+	ErrNoContent       = errors.New("selector matched no content")
+
+	ErrNoAddress             = errors.New("target has no network address")
+	ErrTracerouteUnsupported = errors.New("path tracing is not supported on this platform")
+)
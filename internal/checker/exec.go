@@ -0,0 +1,204 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Nagios plugin return codes.
+const (
+	pluginOK       = 0
+	pluginWarning  = 1
+	pluginCritical = 2
+	pluginUnknown  = 3
+)
+
+const (
+	execWaitDelay         = time.Second
+	defaultMaxOutputBytes = 16 * 1024
+)
+
+// execChecker runs Nagios-compatible plugins from the configured plugin directory.
+type execChecker struct {
+	config ExecConfig
+	logger *zap.Logger
+}
+
+func newExecChecker(config Config, logger *zap.Logger) Checker {
+	if config.Exec.MaxOutputBytes <= 0 {
+		config.Exec.MaxOutputBytes = defaultMaxOutputBytes
+	}
+
+	return &execChecker{
+		config: config.Exec,
+		logger: logger,
+	}
+}
+
+func (c *execChecker) Type() Type {
+	return TypeExec
+}
+
+func (c *execChecker) Check(ctx context.Context, target Target) Result {
+	path, err := c.resolve(target.Config.Command)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}
+	}
+
+	stdout := &limitedBuffer{limit: c.config.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: c.config.MaxOutputBytes}
+
+	cmd := exec.CommandContext(ctx, path, expandMacros(target.Config.Args, target)...)
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = []string{"PATH=/usr/local/bin:/usr/bin:/bin", "LC_ALL=C"}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = execWaitDelay
+
+	start := time.Now()
+	runErr := cmd.Run()
+	elapsed := time.Since(start)
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return Result{
+			Status:       StatusTimeout,
+			ResponseTime: elapsed,
+			Message:      fmt.Sprintf("plugin %s timed out", target.Config.Command),
+		}
+	}
+
+	if cmd.ProcessState == nil {
+		return Result{
+			Status:       StatusError,
+			ResponseTime: elapsed,
+			Message:      fmt.Sprintf("failed to run plugin %s: %s", target.Config.Command, runErr),
+		}
+	}
+
+	output := stdout.String()
+	if strings.TrimSpace(output) == "" {
+		output = stderr.String()
+	}
+
+	message, perf := parsePluginOutput(output)
+	metrics, err := parsePerfdata(perf)
+	if err != nil {
+		c.logger.Debug(
+			"invalid plugin perfdata",
+			zap.Stringer("target_id", target.ID),
+			zap.String("command", target.Config.Command),
+			zap.Error(err),
+		)
+	}
+
+	exitCode := cmd.ProcessState.ExitCode()
+
+	return Result{
+		Status:       exitCodeStatus(exitCode),
+		ResponseTime: elapsed,
+		ResponseCode: exitCode,
+		Message:      message,
+		Metrics:      metrics,
+	}
+}
+
+// resolve returns the absolute path of an allow-listed plugin, making sure it
+// does not escape the plugin directory through relative paths or symlinks.
+func (c *execChecker) resolve(command string) (string, error) {
+	if command == "" || filepath.Base(command) != command || command == "." || command == ".." {
+		return "", fmt.Errorf("%w: %q", ErrCommandNotAllowed, command)
+	}
+
+	if !slices.Contains(c.config.AllowedCommands, command) {
+		return "", fmt.Errorf("%w: %q", ErrCommandNotAllowed, command)
+	}
+
+	dir, err := filepath.Abs(c.config.PluginDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve plugin directory: %w", err)
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return "", fmt.Errorf("failed to resolve plugin directory: %w", err)
+	}
+
+	path, err := filepath.EvalSymlinks(filepath.Join(dir, command))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve plugin %q: %w", command, err)
+	}
+
+	if rel, relErr := filepath.Rel(dir, path); relErr != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w: %q resolves outside of the plugin directory", ErrCommandNotAllowed, command)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat plugin %q: %w", command, err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return "", fmt.Errorf("%w: %q is not an executable file", ErrCommandNotAllowed, command)
+	}
+
+	return path, nil
+}
+
+// expandMacros substitutes the supported Nagios-style macros in plugin arguments.
+func expandMacros(args []string, target Target) []string {
+	host := target.URL
+	if u, err := url.Parse(target.URL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	r := strings.NewReplacer("$URL$", target.URL, "$HOSTADDRESS$", host)
+
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = r.Replace(arg)
+	}
+
+	return expanded
+}
+
+func exitCodeStatus(code int) Status {
+	switch code {
+	case pluginOK:
+		return StatusUp
+	case pluginWarning:
+		return StatusDegraded
+	case pluginCritical:
+		return StatusDown
+	case pluginUnknown:
+		return StatusError
+	default:
+		return StatusError
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written and silently drops the rest,
+// so a chatty plugin is never blocked or failed by the output cap.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining > 0 {
+		b.buf.Write(p[:min(len(p), remaining)])
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
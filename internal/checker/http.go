@@ -0,0 +1,223 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	userAgent           = "pingplex-checker/1.0"
+	maxRedirects        = 10
+	defaultMaxBodyBytes = 1 << 20
+)
+
+// httpChecker performs HTTP(S) requests and reports the response status.
+type httpChecker struct {
+	oauth2       *oauth2Client
+	maxBodyBytes int64
+}
+
+func newHTTPChecker(oauth2 *oauth2Client) Checker {
+	return &httpChecker{
+		oauth2:       oauth2,
+		maxBodyBytes: defaultMaxBodyBytes,
+	}
+}
+
+func (c *httpChecker) Type() Type {
+	return TypeHTTP
+}
+
+func (c *httpChecker) Check(ctx context.Context, target Target) Result {
+	result, _, _ := c.probe(ctx, target, false)
+	return result
+}
+
+// probe sends the target request and returns the result, along with the
+// response body when keepBody is set and the URL it was read from after
+// redirects.
+func (c *httpChecker) probe(ctx context.Context, target Target, keepBody bool) (Result, []byte, *url.URL) {
+	d, err := newDialer(target.Config.ProxyURL, target.Family)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}, nil, nil
+	}
+
+	client, err := c.newClient(d, target.Config)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}, nil, nil
+	}
+	defer client.CloseIdleConnections()
+
+	if target.Config.Auth.Type == AuthOAuth2 {
+		// Warm up the token cache, so the token request does not count towards the response time.
+		if _, tokenErr := c.oauth2.Token(ctx, target.Config.Auth); tokenErr != nil {
+			return Result{Status: StatusError, Message: tokenErr.Error()}, nil, nil
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.do(ctx, client, target)
+	if errors.Is(err, ErrOAuth2Token) || errors.Is(err, ErrInvalidRequest) {
+		return Result{Status: StatusError, Message: err.Error()}, nil, nil
+	}
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && target.Config.Auth.Type == AuthOAuth2 {
+		// The cached token may have been revoked before its expiry, retry once with a fresh one.
+		_ = resp.Body.Close()
+		c.oauth2.Invalidate(ctx, target.Config.Auth)
+		resp, err = c.do(ctx, client, target)
+	}
+	if err != nil {
+		return networkErrorResult(err, time.Since(start), d.ProxyConnectTime()), nil, nil
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	sink := io.Discard
+	if keepBody {
+		sink = &body
+	}
+
+	_, err = io.Copy(sink, io.LimitReader(resp.Body, c.maxBodyBytes))
+	elapsed := time.Since(start)
+	if err != nil {
+		return networkErrorResult(err, elapsed, d.ProxyConnectTime()), nil, nil
+	}
+
+	result := Result{
+		Status:           StatusUp,
+		ResponseTime:     elapsed - d.ProxyConnectTime(),
+		ProxyConnectTime: d.ProxyConnectTime(),
+		ResponseCode:     resp.StatusCode,
+		Message:          resp.Status,
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		result.Status = StatusDown
+	}
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.SSLExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+
+	return result, body.Bytes(), resp.Request.URL
+}
+
+// do builds the request for the target, authorizes it and sends it.
+func (c *httpChecker) do(ctx context.Context, client *http.Client, target Target) (*http.Response, error) {
+	method := target.Config.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if target.Config.Body != "" {
+		body = strings.NewReader(target.Config.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	for k, v := range target.Config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if authErr := c.authorize(ctx, req, target.Config.Auth); authErr != nil {
+		return nil, authErr
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (c *httpChecker) authorize(ctx context.Context, req *http.Request, auth Auth) error {
+	switch auth.Type {
+	case AuthNone:
+	case AuthBasic:
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	case AuthOAuth2:
+		token, err := c.oauth2.Token(ctx, auth)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	default:
+		return fmt.Errorf("%w: unsupported auth type %q", ErrInvalidRequest, auth.Type)
+	}
+
+	return nil
+}
+
+func (c *httpChecker) newClient(d *dialer, config CheckConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !config.VerifySSL, //nolint:gosec // opt-out is a per-target setting
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if config.ClientCert != "" || config.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(config.ClientCert), []byte(config.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid client certificate: %w", ErrInvalidRequest, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := &http.Transport{
+		Proxy:             nil,
+		DialContext:       d.DialContext,
+		DisableKeepAlives: true,
+		ForceAttemptHTTP2: true,
+		TLSClientConfig:   tlsConfig,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if !config.FollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects) //nolint:err113 // message only
+			}
+			return nil
+		},
+	}, nil
+}
+
+// networkErrorResult maps a connection level error to a check result.
+func networkErrorResult(err error, elapsed, proxyConnect time.Duration) Result {
+	status := StatusDown
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		status = StatusTimeout
+	}
+
+	if errors.Is(err, ErrProxyConnect) || errors.Is(err, ErrInvalidProxy) {
+		status = StatusError
+	}
+
+	return Result{
+		Status:           status,
+		ResponseTime:     elapsed - proxyConnect,
+		ProxyConnectTime: proxyConnect,
+		Message:          err.Error(),
+	}
+}
@@ -0,0 +1,29 @@
+package checker
+
+import (
+	"github.com/go-core-fx/logger"
+	"go.uber.org/fx"
+)
+
+func Module() fx.Option {
+	return fx.Module(
+		"checker",
+		logger.WithNamedLogger("checker"),
+		fx.Provide(
+			fx.Annotate(NewTokenCache, fx.ParamTags(`optional:"true"`)), fx.Private,
+		),
+		fx.Provide(newOAuth2Client, fx.Private),
+		fx.Provide(newDiagnoser, fx.Private),
+		fx.Provide(
+			fx.Annotate(newHTTPChecker, fx.ResultTags(`group:"checkers"`)), fx.Private,
+			fx.Annotate(newTCPChecker, fx.ResultTags(`group:"checkers"`)), fx.Private,
+			fx.Annotate(newWebSocketChecker, fx.ResultTags(`group:"checkers"`)), fx.Private,
+			fx.Annotate(newExecChecker, fx.ResultTags(`group:"checkers"`)), fx.Private,
+			fx.Annotate(newContentChecker, fx.ResultTags(`group:"checkers"`)), fx.Private,
+			fx.Annotate(newCrawlChecker, fx.ResultTags(`group:"checkers"`)), fx.Private,
+		),
+		fx.Provide(
+			fx.Annotate(NewService, fx.ParamTags("", `group:"checkers"`)),
+		),
+	)
+}
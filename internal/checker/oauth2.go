@@ -0,0 +1,189 @@
+package checker
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	oauth2ExpirySkew       = 30 * time.Second
+	oauth2DefaultExpiresIn = 5 * time.Minute
+	oauth2MaxResponseBytes = 64 * 1024
+)
+
+type oauth2TokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+// oauth2Client obtains access tokens with the client credentials grant and
+// caches them until shortly before they expire.
+//
+// Token requests do not share the target client: the client secret is only
+// sent over verified TLS, whatever the target's SSL, proxy and client
+// certificate settings, and never follows a redirect.
+type oauth2Client struct {
+	client *http.Client
+	cache  TokenCache
+
+	logger *zap.Logger
+}
+
+func newOAuth2Client(cache TokenCache, logger *zap.Logger) *oauth2Client {
+	transport := &http.Transport{
+		Proxy:             nil,
+		DisableKeepAlives: true,
+		ForceAttemptHTTP2: true,
+		TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	return &oauth2Client{
+		client: &http.Client{ //nolint:exhaustruct // defaults
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cache: cache,
+
+		logger: logger,
+	}
+}
+
+// Token returns a cached access token or requests a new one.
+func (c *oauth2Client) Token(ctx context.Context, auth Auth) (string, error) {
+	key := oauth2CacheKey(auth)
+
+	token, err := c.cache.Get(ctx, key)
+	if err != nil {
+		c.logger.Warn("failed to read cached oauth2 token", zap.Error(err))
+	}
+	if token != "" {
+		return token, nil
+	}
+
+	token, ttl, err := c.fetch(ctx, auth)
+	if err != nil {
+		return "", err
+	}
+
+	if setErr := c.cache.Set(ctx, key, token, ttl); setErr != nil {
+		c.logger.Warn("failed to cache oauth2 token", zap.Error(setErr))
+	}
+
+	return token, nil
+}
+
+// Invalidate evicts the cached token, e.g. after it was rejected by the target.
+func (c *oauth2Client) Invalidate(ctx context.Context, auth Auth) {
+	if err := c.cache.Delete(ctx, oauth2CacheKey(auth)); err != nil {
+		c.logger.Warn("failed to evict oauth2 token", zap.Error(err))
+	}
+}
+
+func (c *oauth2Client) fetch(ctx context.Context, auth Auth) (string, time.Duration, error) {
+	if u, err := url.Parse(auth.TokenURL); err != nil || u.Scheme != "https" {
+		return "", 0, fmt.Errorf("%w: token url must use https", ErrOAuth2Token)
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(auth.Scopes) > 0 {
+		form.Set("scope", strings.Join(auth.Scopes, " "))
+	}
+
+	// Try client_secret_basic first and fall back to client_secret_post,
+	// as token endpoints tend to support only one of them.
+	resp, err := c.request(ctx, auth, form, true)
+	if err == nil && (resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized) {
+		_ = resp.Body.Close()
+		resp, err = c.request(ctx, auth, form, false)
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %w", ErrOAuth2Token, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("%w: token endpoint returned %s", ErrOAuth2Token, resp.Status)
+	}
+
+	var token oauth2TokenResponse
+	if decErr := json.NewDecoder(io.LimitReader(resp.Body, oauth2MaxResponseBytes)).Decode(&token); decErr != nil {
+		return "", 0, fmt.Errorf("%w: invalid token response: %w", ErrOAuth2Token, decErr)
+	}
+
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("%w: empty access token", ErrOAuth2Token)
+	}
+
+	ttl := oauth2DefaultExpiresIn
+	if seconds, convErr := token.ExpiresIn.Int64(); convErr == nil && seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	ttl = max(ttl-oauth2ExpirySkew, time.Second)
+
+	return token.AccessToken, ttl, nil
+}
+
+func (c *oauth2Client) request(
+	ctx context.Context,
+	auth Auth,
+	form url.Values,
+	basic bool,
+) (*http.Response, error) {
+	body := url.Values{}
+	for k, v := range form {
+		body[k] = v
+	}
+	if !basic {
+		body.Set("client_id", auth.ClientID)
+		body.Set("client_secret", auth.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.TokenURL, strings.NewReader(body.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(auth.ClientID), url.QueryEscape(auth.ClientSecret))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+
+	return resp, nil
+}
+
+// oauth2CacheKey identifies a token by everything that affects its issuance.
+// The secret is part of the key so rotated credentials never reuse old tokens.
+func oauth2CacheKey(auth Auth) string {
+	scopes := slices.Clone(auth.Scopes)
+	slices.Sort(scopes)
+
+	h := sha256.New()
+	for _, part := range []string{auth.TokenURL, auth.ClientID, auth.ClientSecret, strings.Join(scopes, " ")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
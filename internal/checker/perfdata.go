@@ -0,0 +1,173 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const perfdataFields = 5
+
+//nolint:gochecknoglobals // compiled once
+var perfValueRe = regexp.MustCompile(`^([-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)([a-zA-Z%]*)$`)
+
+// parsePluginOutput splits Nagios plugin output into the human-readable text
+// and the performance data section.
+//
+// The first line holds the short text optionally followed by "| perfdata".
+// Subsequent lines hold the long text; the first pipe found there starts the
+// multi-line perfdata section which lasts until the end of the output.
+func parsePluginOutput(output string) (string, string) {
+	lines := strings.Split(strings.TrimRight(output, "\r\n"), "\n")
+
+	text := make([]string, 0, len(lines))
+	perf := make([]string, 0, len(lines))
+
+	short, shortPerf, _ := strings.Cut(lines[0], "|")
+	text = append(text, strings.TrimSpace(short))
+	perf = append(perf, shortPerf)
+
+	inPerf := false
+	for _, line := range lines[1:] {
+		if inPerf {
+			perf = append(perf, line)
+			continue
+		}
+
+		long, longPerf, found := strings.Cut(line, "|")
+		text = append(text, strings.TrimRight(long, " \r"))
+		if found {
+			perf = append(perf, longPerf)
+			inPerf = true
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(text, "\n")), strings.TrimSpace(strings.Join(perf, " "))
+}
+
+// parsePerfdata parses space separated `'label'=value[UOM];[warn];[crit];[min];[max]` items.
+//
+// Items with an undetermined ("U") value are skipped. Malformed items are
+// skipped too and reported through the returned error, so callers can keep
+// the valid part.
+func parsePerfdata(s string) ([]Metric, error) {
+	metrics := make([]Metric, 0)
+	var errs []error
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		var (
+			label string
+			err   error
+		)
+
+		label, s, err = readPerfLabel(s)
+		if err != nil {
+			return metrics, errors.Join(append(errs, err)...)
+		}
+
+		var spec string
+		if i := strings.IndexAny(s, " \t\r\n"); i >= 0 {
+			spec, s = s[:i], s[i:]
+		} else {
+			spec, s = s, ""
+		}
+
+		metric, ok, err := parsePerfSpec(label, spec)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+func readPerfLabel(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "'") {
+		label, rest, found := strings.Cut(s, "=")
+		if !found || label == "" || strings.ContainsAny(label, " \t") {
+			return "", "", fmt.Errorf("%w: missing label near %q", ErrInvalidPerfdata, s)
+		}
+		return label, rest, nil
+	}
+
+	// Quoted labels may contain spaces and '=', a doubled quote is a literal one.
+	var label strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '\'' {
+			label.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '\'' {
+			label.WriteByte('\'')
+			i++
+			continue
+		}
+		if i+1 >= len(s) || s[i+1] != '=' {
+			return "", "", fmt.Errorf("%w: missing '=' after label %q", ErrInvalidPerfdata, label.String())
+		}
+		return label.String(), s[i+2:], nil
+	}
+
+	return "", "", fmt.Errorf("%w: unterminated label near %q", ErrInvalidPerfdata, s)
+}
+
+func parsePerfSpec(label, spec string) (Metric, bool, error) {
+	// Fields past max are not part of the format, they are ignored.
+	fields := strings.Split(spec, ";")
+	for len(fields) < perfdataFields {
+		fields = append(fields, "")
+	}
+
+	if fields[0] == "U" {
+		return Metric{}, false, nil
+	}
+
+	m := perfValueRe.FindStringSubmatch(fields[0])
+	if m == nil {
+		return Metric{}, false, fmt.Errorf("%w: invalid value %q for %q", ErrInvalidPerfdata, fields[0], label)
+	}
+
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return Metric{}, false, fmt.Errorf("%w: invalid value %q for %q", ErrInvalidPerfdata, fields[0], label)
+	}
+
+	minValue, err := parseOptionalFloat(fields[3])
+	if err != nil {
+		return Metric{}, false, fmt.Errorf("%w: invalid min %q for %q", ErrInvalidPerfdata, fields[3], label)
+	}
+
+	maxValue, err := parseOptionalFloat(fields[4])
+	if err != nil {
+		return Metric{}, false, fmt.Errorf("%w: invalid max %q for %q", ErrInvalidPerfdata, fields[4], label)
+	}
+
+	return Metric{
+		Label: label,
+		Value: value,
+		Unit:  m[2],
+		Warn:  fields[1],
+		Crit:  fields[2],
+		Min:   minValue,
+		Max:   maxValue,
+	}, true, nil
+}
+
+func parseOptionalFloat(s string) (*float64, error) {
+	if s == "" {
+		return nil, nil //nolint:nilnil // absent value is not an error
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse float: %w", err)
+	}
+
+	return &v, nil
+}
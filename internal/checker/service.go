@@ -0,0 +1,122 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Service dispatches checks to the checker registered for the target type.
+type Service struct {
+	config    Config
+	checkers  map[Type]Checker
+	diagnoser *diagnoser
+
+	logger *zap.Logger
+}
+
+func NewService(config Config, checkers []Checker, diagnoser *diagnoser, logger *zap.Logger) *Service {
+	if config.DefaultTimeout <= 0 {
+		config.DefaultTimeout = defaultTimeout
+	}
+
+	byType := make(map[Type]Checker, len(checkers))
+	for _, c := range checkers {
+		byType[c.Type()] = c
+	}
+
+	return &Service{
+		config:    config,
+		checkers:  byType,
+		diagnoser: diagnoser,
+
+		logger: logger,
+	}
+}
+
+// Supports reports whether the target type has a registered checker.
+func (s *Service) Supports(t Type) bool {
+	_, ok := s.checkers[t]
+	return ok
+}
+
+// Types returns the target types with a registered checker.
+func (s *Service) Types() []Type {
+	types := make([]Type, 0, len(s.checkers))
+	for t := range s.checkers {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+
+	return types
+}
+
+// Check probes the target within its timeout and returns the result.
+func (s *Service) Check(ctx context.Context, target Target) Result {
+	start := time.Now()
+
+	c, ok := s.checkers[target.Type]
+	if !ok {
+		return Result{
+			TargetID:  target.ID,
+			CheckTime: start,
+			Status:    StatusError,
+			Message:   fmt.Sprintf("%s: %s", ErrUnsupportedType, target.Type),
+		}
+	}
+
+	timeout := target.Config.Timeout
+	if timeout <= 0 {
+		timeout = s.config.DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var result Result
+	if target.Config.DualStack && supportsDualStack(target.Type) {
+		result = checkDualStack(ctx, c, target)
+	} else {
+		result = c.Check(ctx, target)
+	}
+
+	result.TargetID = target.ID
+	result.CheckTime = start
+	if result.ResponseTime == 0 {
+		result.ResponseTime = time.Since(start)
+	}
+	for i := range result.Families {
+		result.Families[i].TargetID = target.ID
+		result.Families[i].CheckTime = start
+	}
+
+	s.logger.Debug(
+		"check completed",
+		zap.Stringer("target_id", target.ID),
+		zap.String("type", string(target.Type)),
+		zap.String("status", string(result.Status)),
+		zap.Duration("response_time", result.ResponseTime),
+	)
+
+	return result
+}
+
+// Diagnose collects troubleshooting data about the failing target, without
+// the values of sensitive response headers.
+func (s *Service) Diagnose(ctx context.Context, target Target) Diagnostics {
+	diag := s.diagnoser.Diagnose(ctx, target).Redacted()
+
+	s.logger.Debug(
+		"diagnostics collected",
+		zap.Stringer("target_id", target.ID),
+		zap.Strings("resolved_ips", diag.ResolvedIPs),
+		zap.Int("hops", len(diag.Path)),
+	)
+
+	return diag
+}
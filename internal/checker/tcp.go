@@ -0,0 +1,65 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// tcpChecker reports whether a TCP connection can be established.
+type tcpChecker struct{}
+
+func newTCPChecker() Checker {
+	return &tcpChecker{}
+}
+
+func (c *tcpChecker) Type() Type {
+	return TypeTCP
+}
+
+func (c *tcpChecker) Check(ctx context.Context, target Target) Result {
+	addr, err := tcpAddr(target.URL)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}
+	}
+
+	d, err := newDialer(target.Config.ProxyURL, target.Family)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}
+	}
+
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	elapsed := time.Since(start)
+	if err != nil {
+		return networkErrorResult(err, elapsed, d.ProxyConnectTime())
+	}
+	_ = conn.Close()
+
+	return Result{
+		Status:           StatusUp,
+		ResponseTime:     elapsed - d.ProxyConnectTime(),
+		ProxyConnectTime: d.ProxyConnectTime(),
+		Message:          "connected to " + addr,
+	}
+}
+
+// tcpAddr accepts both "host:port" and "tcp://host:port" target URLs.
+func tcpAddr(target string) (string, error) {
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return "", fmt.Errorf("invalid target address: %w", err)
+		}
+		target = u.Host
+	}
+
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		return "", fmt.Errorf("invalid target address: %w", err)
+	}
+
+	return target, nil
+}
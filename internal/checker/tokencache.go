@@ -0,0 +1,117 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const tokenCachePrefix = "pingplex:oauth2:token:"
+
+// TokenCache stores OAuth2 access tokens until they expire.
+type TokenCache interface {
+	// Get returns the cached token, an empty string means a cache miss.
+	Get(ctx context.Context, key string) (string, error)
+	// Set caches the token for ttl.
+	Set(ctx context.Context, key, token string, ttl time.Duration) error
+	// Delete evicts the token.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewTokenCache returns a Redis backed cache shared by all replicas, or an
+// in-memory one when Redis is not available, e.g. on remote agents.
+func NewTokenCache(client *redis.Client) TokenCache {
+	if client == nil {
+		return newMemoryTokenCache()
+	}
+
+	return &redisTokenCache{client: client}
+}
+
+type redisTokenCache struct {
+	client *redis.Client
+}
+
+func (c *redisTokenCache) Get(ctx context.Context, key string) (string, error) {
+	token, err := c.client.Get(ctx, tokenCachePrefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (c *redisTokenCache) Set(ctx context.Context, key, token string, ttl time.Duration) error {
+	if err := c.client.Set(ctx, tokenCachePrefix+key, token, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set token: %w", err)
+	}
+
+	return nil
+}
+
+func (c *redisTokenCache) Delete(ctx context.Context, key string) error {
+	if err := c.client.Del(ctx, tokenCachePrefix+key).Err(); err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+
+	return nil
+}
+
+type memoryToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+type memoryTokenCache struct {
+	tokens map[string]memoryToken
+	mu     sync.Mutex
+}
+
+func newMemoryTokenCache() *memoryTokenCache {
+	return &memoryTokenCache{
+		tokens: make(map[string]memoryToken),
+		mu:     sync.Mutex{},
+	}
+}
+
+func (c *memoryTokenCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, ok := c.tokens[key]
+	if !ok {
+		return "", nil
+	}
+
+	if time.Now().After(t.expiresAt) {
+		delete(c.tokens, key)
+		return "", nil
+	}
+
+	return t.token, nil
+}
+
+func (c *memoryTokenCache) Set(_ context.Context, key, token string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokens[key] = memoryToken{token: token, expiresAt: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (c *memoryTokenCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.tokens, key)
+
+	return nil
+}
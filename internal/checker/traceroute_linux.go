@@ -0,0 +1,182 @@
+//go:build linux
+
+package checker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// sockExtendedErrLen is the size of struct sock_extended_err, which precedes
+// the offender address in IP_RECVERR messages.
+const sockExtendedErrLen = 16
+
+// tracePath traces the network path to the address with TCP SYN probes of
+// increasing TTL. Routers dropping a probe report themselves with an ICMP
+// time exceeded message, which is read from the socket error queue, so no
+// raw socket privileges are needed.
+func tracePath(ctx context.Context, ip net.IP, port, maxHops int, hopTimeout time.Duration) ([]Hop, error) {
+	hops := make([]Hop, 0, maxHops)
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		if err := ctx.Err(); err != nil {
+			return hops, fmt.Errorf("path tracing interrupted: %w", err)
+		}
+
+		hop, reached, err := probeHop(ip, port, ttl, hopTimeout)
+		if err != nil {
+			return hops, err
+		}
+
+		hops = append(hops, hop)
+		if reached {
+			break
+		}
+	}
+
+	return hops, nil
+}
+
+// probeHop sends a single probe and reports the replying hop and whether it
+// is the destination.
+func probeHop(ip net.IP, port, ttl int, timeout time.Duration) (Hop, bool, error) {
+	hop := Hop{TTL: ttl, Addr: "", RTT: 0}
+
+	fd, err := openProbeSocket(ip, ttl)
+	if err != nil {
+		return hop, false, err
+	}
+	defer unix.Close(fd)
+
+	start := time.Now()
+	err = unix.Connect(fd, probeSockaddr(ip, port))
+	if errors.Is(err, unix.EINPROGRESS) {
+		err = waitConnect(fd, timeout)
+	}
+	rtt := time.Since(start)
+
+	switch {
+	case err == nil, errors.Is(err, unix.ECONNREFUSED), errors.Is(err, unix.ECONNRESET):
+		// Any answer from the destination itself ends the trace.
+		hop.Addr = ip.String()
+		hop.RTT = rtt
+		return hop, true, nil
+	case errors.Is(err, unix.ETIMEDOUT):
+		return hop, false, nil
+	}
+
+	if offender := readOffender(fd); offender != nil {
+		hop.Addr = offender.String()
+		hop.RTT = rtt
+		return hop, offender.Equal(ip), nil
+	}
+
+	return hop, false, nil
+}
+
+func openProbeSocket(ip net.IP, ttl int) (int, error) {
+	family, level, ttlOpt, recvErrOpt := unix.AF_INET, unix.IPPROTO_IP, unix.IP_TTL, unix.IP_RECVERR
+	if ip.To4() == nil {
+		family, level, ttlOpt, recvErrOpt = unix.AF_INET6, unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS, unix.IPV6_RECVERR
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, unix.IPPROTO_TCP)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open probe socket: %w", err)
+	}
+
+	if optErr := unix.SetsockoptInt(fd, level, ttlOpt, ttl); optErr != nil {
+		_ = unix.Close(fd)
+		return -1, fmt.Errorf("failed to set probe ttl: %w", optErr)
+	}
+	if optErr := unix.SetsockoptInt(fd, level, recvErrOpt, 1); optErr != nil {
+		_ = unix.Close(fd)
+		return -1, fmt.Errorf("failed to enable probe error queue: %w", optErr)
+	}
+
+	return fd, nil
+}
+
+func probeSockaddr(ip net.IP, port int) unix.Sockaddr {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &unix.SockaddrInet4{Port: port, Addr: [4]byte(ip4)}
+	}
+	return &unix.SockaddrInet6{Port: port, ZoneId: 0, Addr: [16]byte(ip.To16())}
+}
+
+// waitConnect waits for the non-blocking connect to complete and returns its
+// result, ETIMEDOUT when no answer arrived in time.
+func waitConnect(fd int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return unix.ETIMEDOUT
+		}
+
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLOUT, Revents: 0}} //nolint:gosec // fd fits int32
+		n, err := unix.Poll(fds, int(remaining.Milliseconds())+1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to poll probe socket: %w", err)
+		}
+		if n == 0 {
+			return unix.ETIMEDOUT
+		}
+
+		soErr, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ERROR)
+		if err != nil {
+			return fmt.Errorf("failed to read probe result: %w", err)
+		}
+		if soErr != 0 {
+			return unix.Errno(soErr) //nolint:gosec // errno fits uintptr
+		}
+
+		return nil
+	}
+}
+
+// readOffender returns the address of the router that reported the probe error.
+func readOffender(fd int) net.IP {
+	buf := make([]byte, 128)
+	oob := make([]byte, 512)
+
+	_, oobn, _, _, err := unix.Recvmsg(fd, buf, oob, unix.MSG_ERRQUEUE)
+	if err != nil {
+		return nil
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil
+	}
+
+	for _, m := range msgs {
+		isRecvErr := (m.Header.Level == unix.SOL_IP && m.Header.Type == unix.IP_RECVERR) ||
+			(m.Header.Level == unix.SOL_IPV6 && m.Header.Type == unix.IPV6_RECVERR)
+		if !isRecvErr || len(m.Data) < sockExtendedErrLen+2 {
+			continue
+		}
+
+		offender := m.Data[sockExtendedErrLen:]
+		switch binary.NativeEndian.Uint16(offender) {
+		case unix.AF_INET:
+			if len(offender) >= 8 {
+				return net.IP(offender[4:8])
+			}
+		case unix.AF_INET6:
+			if len(offender) >= 24 {
+				return net.IP(offender[8:24])
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package checker
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+func tracePath(_ context.Context, _ net.IP, _, _ int, _ time.Duration) ([]Hop, error) {
+	return nil, ErrTracerouteUnsupported
+}
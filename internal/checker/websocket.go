@@ -0,0 +1,175 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // mandated by RFC 6455
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	websocketGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	websocketKeyLen      = 16
+	websocketCloseNormal = 1000
+)
+
+// websocketChecker performs a WebSocket opening handshake and closes the
+// connection gracefully.
+type websocketChecker struct{}
+
+func newWebSocketChecker() Checker {
+	return &websocketChecker{}
+}
+
+func (c *websocketChecker) Type() Type {
+	return TypeWebSocket
+}
+
+func (c *websocketChecker) Check(ctx context.Context, target Target) Result {
+	u, err := url.Parse(target.URL)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") {
+		return Result{Status: StatusError, Message: fmt.Sprintf("invalid websocket url %q", target.URL)}
+	}
+
+	d, err := newDialer(target.Config.ProxyURL, target.Family)
+	if err != nil {
+		return Result{Status: StatusError, Message: err.Error()}
+	}
+
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", websocketAddr(u))
+	if err != nil {
+		return networkErrorResult(err, time.Since(start), d.ProxyConnectTime())
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	var sslExpiry time.Time
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: !target.Config.VerifySSL, //nolint:gosec // opt-out is a per-target setting
+			MinVersion:         tls.VersionTLS12,
+		})
+		if hsErr := tlsConn.HandshakeContext(ctx); hsErr != nil {
+			return networkErrorResult(hsErr, time.Since(start), d.ProxyConnectTime())
+		}
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			sslExpiry = certs[0].NotAfter
+		}
+		conn = tlsConn
+	}
+
+	code, err := websocketHandshake(conn, u, target.Config.Headers)
+	elapsed := time.Since(start)
+	if err != nil {
+		result := networkErrorResult(err, elapsed, d.ProxyConnectTime())
+		result.ResponseCode = code
+		return result
+	}
+
+	_ = websocketClose(conn)
+
+	return Result{
+		Status:           StatusUp,
+		ResponseTime:     elapsed - d.ProxyConnectTime(),
+		ProxyConnectTime: d.ProxyConnectTime(),
+		ResponseCode:     code,
+		Message:          "websocket handshake completed",
+		SSLExpiry:        sslExpiry,
+	}
+}
+
+func websocketAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "wss" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// websocketHandshake sends the opening handshake and validates the server response.
+func websocketHandshake(conn net.Conn, u *url.URL, headers map[string]string) (int, error) {
+	nonce := make([]byte, websocketKeyLen)
+	_, _ = rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	httpURL := *u
+	httpURL.Scheme = "http"
+	if u.Scheme == "wss" {
+		httpURL.Scheme = "https"
+	}
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &httpURL,
+		Host:   u.Host,
+		Header: make(http.Header),
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := req.Write(conn); err != nil {
+		return 0, fmt.Errorf("write handshake: %w", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return 0, fmt.Errorf("read handshake response: %w", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return resp.StatusCode, fmt.Errorf("%w: unexpected status %s", ErrWebSocketHandshake, resp.Status)
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID)) //nolint:gosec // mandated by RFC 6455
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return resp.StatusCode, fmt.Errorf("%w: invalid Sec-WebSocket-Accept", ErrWebSocketHandshake)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// websocketClose sends a masked close frame with the normal closure status.
+func websocketClose(conn net.Conn) error {
+	const (
+		finClose    = 0x88
+		maskedLen2  = 0x82
+		maskKeySize = 4
+	)
+
+	payload := binary.BigEndian.AppendUint16(nil, websocketCloseNormal)
+
+	mask := make([]byte, maskKeySize)
+	_, _ = rand.Read(mask)
+
+	frame := append([]byte{finClose, maskedLen2}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%maskKeySize])
+	}
+
+	if _, err := conn.Write(frame); err != nil {
+		return fmt.Errorf("write close frame: %w", err)
+	}
+
+	return nil
+}
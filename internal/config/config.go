@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/go-core-fx/config"
 )
@@ -24,10 +25,91 @@ type redis struct {
 	URL string `koanf:"url"`
 }
 
+type checksExec struct {
+	PluginDir       string   `koanf:"plugin_dir"`
+	AllowedCommands []string `koanf:"allowed_commands"`
+	MaxOutputBytes  int      `koanf:"max_output_bytes"`
+}
+
+type checksDiagnostics struct {
+	Timeout      time.Duration `koanf:"timeout"`
+	MaxHops      int           `koanf:"max_hops"`
+	HopTimeout   time.Duration `koanf:"hop_timeout"`
+	MaxBodyBytes int           `koanf:"max_body_bytes"`
+}
+
+type checks struct {
+	DefaultTimeout time.Duration     `koanf:"default_timeout"`
+	Exec           checksExec        `koanf:"exec"`
+	Diagnostics    checksDiagnostics `koanf:"diagnostics"`
+}
+
+type secretKeys struct {
+	Keys      map[string]string `koanf:"keys"`
+	ActiveKey string            `koanf:"active_key"`
+}
+
+type targetLimits struct {
+	MinIntervalSeconds     int `koanf:"min_interval_seconds"`
+	DefaultIntervalSeconds int `koanf:"default_interval_seconds"`
+}
+
+type schedule struct {
+	Workers        int           `koanf:"workers"`
+	QueueSize      int           `koanf:"queue_size"`
+	ResyncInterval time.Duration `koanf:"resync_interval"`
+	Shards         int           `koanf:"shards"`
+	LeaseTTL       time.Duration `koanf:"lease_ttl"`
+}
+
+type agentFleet struct {
+	SignatureWindow    time.Duration     `koanf:"signature_window"`
+	HeartbeatTimeout   time.Duration     `koanf:"heartbeat_timeout"`
+	AssignmentTimeout  time.Duration     `koanf:"assignment_timeout"`
+	GRPCAddress        string            `koanf:"grpc_address"`
+	GRPCTLSCert        string            `koanf:"grpc_tls_cert"`
+	GRPCTLSKey         string            `koanf:"grpc_tls_key"`
+	GRPCPlaintext      bool              `koanf:"grpc_plaintext"`
+	MinVersion         string            `koanf:"min_version"`
+	RecommendedVersion string            `koanf:"recommended_version"`
+	AdminTokens        map[string]string `koanf:"admin_tokens"`
+	CanaryTargets      []string          `koanf:"canary_targets"`
+	CanaryInterval     time.Duration     `koanf:"canary_interval"`
+	AuditInterval      time.Duration     `koanf:"audit_interval"`
+	PromoteAfter       int               `koanf:"promote_after"`
+	FlagAfter          int               `koanf:"flag_after"`
+	SuspendAfter       int               `koanf:"suspend_after"`
+}
+
+type agentMode struct {
+	ServerURL           string        `koanf:"server_url"`
+	GRPCAddress         string        `koanf:"grpc_address"`
+	GRPCPlaintext       bool          `koanf:"grpc_plaintext"`
+	DataDir             string        `koanf:"data_dir"`
+	Name                string        `koanf:"name"`
+	Location            string        `koanf:"location"`
+	Regions             []string      `koanf:"regions"`
+	CheckTypes          []string      `koanf:"check_types"`
+	MaxConcurrentChecks int           `koanf:"max_concurrent_checks"`
+	Tags                []string      `koanf:"tags"`
+	PollWait            time.Duration `koanf:"poll_wait"`
+	HeartbeatInterval   time.Duration `koanf:"heartbeat_interval"`
+	UploadInterval      time.Duration `koanf:"upload_interval"`
+	UploadBatchSize     int           `koanf:"upload_batch_size"`
+	SpoolMaxBytes       int64         `koanf:"spool_max_bytes"`
+	SpoolMaxAge         time.Duration `koanf:"spool_max_age"`
+}
+
 type Config struct {
-	HTTP     http     `koanf:"http"`
-	Database database `koanf:"database"`
-	Redis    redis    `koanf:"redis"`
+	HTTP      http         `koanf:"http"`
+	Database  database     `koanf:"database"`
+	Redis     redis        `koanf:"redis"`
+	Checks    checks       `koanf:"checks"`
+	Secrets   secretKeys   `koanf:"secrets"`
+	Targets   targetLimits `koanf:"targets"`
+	Scheduler schedule     `koanf:"scheduler"`
+	Agents    agentFleet   `koanf:"agents"`
+	Agent     agentMode    `koanf:"agent"`
 }
 
 func Default() Config {
@@ -46,6 +128,71 @@ func Default() Config {
 		Redis: redis{
 			URL: "redis://localhost:6379/0",
 		},
+		Checks: checks{
+			DefaultTimeout: 30 * time.Second,
+			Exec: checksExec{
+				PluginDir:       "/usr/lib/nagios/plugins",
+				AllowedCommands: []string{},
+				MaxOutputBytes:  16 * 1024,
+			},
+			Diagnostics: checksDiagnostics{
+				Timeout:      30 * time.Second,
+				MaxHops:      20,
+				HopTimeout:   time.Second,
+				MaxBodyBytes: 8 * 1024,
+			},
+		},
+		Secrets: secretKeys{
+			Keys:      map[string]string{},
+			ActiveKey: "",
+		},
+		Targets: targetLimits{
+			MinIntervalSeconds:     10,
+			DefaultIntervalSeconds: 60,
+		},
+		Scheduler: schedule{
+			Workers:        16,
+			QueueSize:      1000,
+			ResyncInterval: time.Minute,
+			Shards:         64,
+			LeaseTTL:       10 * time.Second,
+		},
+		Agents: agentFleet{
+			SignatureWindow:    5 * time.Minute,
+			HeartbeatTimeout:   90 * time.Second,
+			AssignmentTimeout:  2 * time.Minute,
+			GRPCAddress:        "",
+			GRPCTLSCert:        "",
+			GRPCTLSKey:         "",
+			GRPCPlaintext:      false,
+			MinVersion:         "",
+			RecommendedVersion: "",
+			AdminTokens:        map[string]string{},
+			CanaryTargets:      []string{},
+			CanaryInterval:     time.Minute,
+			AuditInterval:      15 * time.Minute,
+			PromoteAfter:       5,
+			FlagAfter:          2,
+			SuspendAfter:       5,
+		},
+		Agent: agentMode{
+			ServerURL:           "http://127.0.0.1:3000",
+			GRPCAddress:         "",
+			GRPCPlaintext:       false,
+			DataDir:             "data",
+			Name:                "",
+			Location:            "",
+			Regions:             []string{},
+			CheckTypes:          []string{},
+			MaxConcurrentChecks: 10,
+			Tags:                []string{},
+			PollWait:            30 * time.Second,
+			HeartbeatInterval:   30 * time.Second,
+			UploadInterval:      5 * time.Second,
+			UploadBatchSize:     100,
+			SpoolMaxBytes:       64 << 20,
+			SpoolMaxAge:         24 * time.Hour,
+		},
 	}
 }
 
@@ -3,6 +3,12 @@ package config
 import (
 	"github.com/go-core-fx/fiberfx"
 	"github.com/go-core-fx/redisfx"
+	"github.com/pingplex/pingplex/internal/agents"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/probe"
+	"github.com/pingplex/pingplex/internal/scheduler"
+	"github.com/pingplex/pingplex/internal/secrets"
+	"github.com/pingplex/pingplex/internal/targets"
 	"github.com/pingplex/pingplex/pkg/gocqlfx"
 	"go.uber.org/fx"
 )
@@ -31,5 +37,82 @@ func Module() fx.Option {
 				URL: cfg.Redis.URL,
 			}
 		}),
+		fx.Provide(func(cfg Config) checker.Config {
+			return checker.Config{
+				DefaultTimeout: cfg.Checks.DefaultTimeout,
+				Exec: checker.ExecConfig{
+					PluginDir:       cfg.Checks.Exec.PluginDir,
+					AllowedCommands: cfg.Checks.Exec.AllowedCommands,
+					MaxOutputBytes:  cfg.Checks.Exec.MaxOutputBytes,
+				},
+				Diagnostics: checker.DiagnosticsConfig{
+					Timeout:      cfg.Checks.Diagnostics.Timeout,
+					MaxHops:      cfg.Checks.Diagnostics.MaxHops,
+					HopTimeout:   cfg.Checks.Diagnostics.HopTimeout,
+					MaxBodyBytes: cfg.Checks.Diagnostics.MaxBodyBytes,
+				},
+			}
+		}),
+		fx.Provide(func(cfg Config) secrets.Config {
+			return secrets.Config{
+				Keys:      cfg.Secrets.Keys,
+				ActiveKey: cfg.Secrets.ActiveKey,
+			}
+		}),
+		fx.Provide(func(cfg Config) targets.Config {
+			return targets.Config{
+				MinIntervalSeconds:     cfg.Targets.MinIntervalSeconds,
+				DefaultIntervalSeconds: cfg.Targets.DefaultIntervalSeconds,
+			}
+		}),
+		fx.Provide(func(cfg Config) scheduler.Config {
+			return scheduler.Config{
+				Workers:        cfg.Scheduler.Workers,
+				QueueSize:      cfg.Scheduler.QueueSize,
+				ResyncInterval: cfg.Scheduler.ResyncInterval,
+				Shards:         cfg.Scheduler.Shards,
+				LeaseTTL:       cfg.Scheduler.LeaseTTL,
+			}
+		}),
+		fx.Provide(func(cfg Config) agents.Config {
+			return agents.Config{
+				SignatureWindow:    cfg.Agents.SignatureWindow,
+				HeartbeatTimeout:   cfg.Agents.HeartbeatTimeout,
+				AssignmentTimeout:  cfg.Agents.AssignmentTimeout,
+				GRPCAddress:        cfg.Agents.GRPCAddress,
+				GRPCTLSCert:        cfg.Agents.GRPCTLSCert,
+				GRPCTLSKey:         cfg.Agents.GRPCTLSKey,
+				GRPCPlaintext:      cfg.Agents.GRPCPlaintext,
+				MinVersion:         cfg.Agents.MinVersion,
+				RecommendedVersion: cfg.Agents.RecommendedVersion,
+				AdminTokens:        cfg.Agents.AdminTokens,
+				CanaryTargets:      cfg.Agents.CanaryTargets,
+				CanaryInterval:     cfg.Agents.CanaryInterval,
+				AuditInterval:      cfg.Agents.AuditInterval,
+				PromoteAfter:       cfg.Agents.PromoteAfter,
+				FlagAfter:          cfg.Agents.FlagAfter,
+				SuspendAfter:       cfg.Agents.SuspendAfter,
+			}
+		}),
+		fx.Provide(func(cfg Config) probe.Config {
+			return probe.Config{
+				ServerURL:           cfg.Agent.ServerURL,
+				GRPCAddress:         cfg.Agent.GRPCAddress,
+				GRPCPlaintext:       cfg.Agent.GRPCPlaintext,
+				DataDir:             cfg.Agent.DataDir,
+				Name:                cfg.Agent.Name,
+				Location:            cfg.Agent.Location,
+				Regions:             cfg.Agent.Regions,
+				CheckTypes:          cfg.Agent.CheckTypes,
+				MaxConcurrentChecks: cfg.Agent.MaxConcurrentChecks,
+				Tags:                cfg.Agent.Tags,
+				PollWait:            cfg.Agent.PollWait,
+				HeartbeatInterval:   cfg.Agent.HeartbeatInterval,
+				UploadInterval:      cfg.Agent.UploadInterval,
+				UploadBatchSize:     cfg.Agent.UploadBatchSize,
+				SpoolMaxBytes:       cfg.Agent.SpoolMaxBytes,
+				SpoolMaxAge:         cfg.Agent.SpoolMaxAge,
+			}
+		}),
 	)
 }
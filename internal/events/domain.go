@@ -0,0 +1,69 @@
+package events
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Type identifies the kind of event.
+type Type string
+
+const (
+	// TypeContentChanged is emitted when the content of a content_change target differs from the last snapshot
+	TypeContentChanged Type = "content.changed"
+	// TypeIncidentOpened is emitted when a target goes down
+	TypeIncidentOpened Type = "incident.opened"
+	// TypeIncidentResolved is emitted when a target recovers
+	TypeIncidentResolved Type = "incident.resolved"
+	// TypeCheckPending is emitted when a failure awaits confirmation by a recheck
+	TypeCheckPending Type = "check.pending"
+	// TypeTargetUpdated is emitted when a target is created or changed
+	TypeTargetUpdated Type = "target.updated"
+	// TypeTargetDeleted is emitted when a target is deleted
+	TypeTargetDeleted Type = "target.deleted"
+	// TypeAgentStatusChanged is emitted when an agent changes status, e.g. goes inactive
+	TypeAgentStatusChanged Type = "agent.status_changed"
+	// TypeAgentFlagged is emitted when the canary checks of an agent diverge from the consensus
+	TypeAgentFlagged Type = "agent.flagged"
+)
+
+// Event is a notification about a target or an agent, published to subscribers.
+type Event struct {
+	// ID is the unique event identifier
+	ID gocql.UUID `json:"id"`
+	// Type is the kind of event
+	Type Type `json:"type"`
+	// TargetID is the target the event is about
+	TargetID gocql.UUID `json:"targetId,omitzero"`
+	// AgentID is the agent the event is about
+	AgentID gocql.UUID `json:"agentId,omitzero"`
+	// Time is when the event occurred
+	Time time.Time `json:"time"`
+	// Data is the type-specific payload
+	Data any `json:"data,omitempty"`
+}
+
+// New creates a target event with a random ID.
+func New(t Type, targetID gocql.UUID, at time.Time, data any) Event {
+	return Event{
+		ID:       gocql.MustRandomUUID(),
+		Type:     t,
+		TargetID: targetID,
+		AgentID:  gocql.UUID{},
+		Time:     at,
+		Data:     data,
+	}
+}
+
+// NewAgent creates an agent event with a random ID.
+func NewAgent(t Type, agentID gocql.UUID, at time.Time, data any) Event {
+	return Event{
+		ID:       gocql.MustRandomUUID(),
+		Type:     t,
+		TargetID: gocql.UUID{},
+		AgentID:  agentID,
+		Time:     at,
+		Data:     data,
+	}
+}
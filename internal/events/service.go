@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/gocql/gocql"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Channel is the Redis pub/sub channel events are published to.
+const Channel = "pingplex:events"
+
+// Handler receives published events. It is called synchronously by
+// Publish, so it must not block.
+type Handler func(Event)
+
+// Service publishes events to in-process handlers and Redis subscribers.
+// Without Redis, events are only delivered in-process.
+type Service struct {
+	redis *redis.Client
+
+	mu       sync.RWMutex
+	handlers map[int]Handler
+	nextID   int
+
+	logger *zap.Logger
+}
+
+func NewService(redis *redis.Client, logger *zap.Logger) *Service {
+	return &Service{
+		redis: redis,
+
+		mu:       sync.RWMutex{},
+		handlers: map[int]Handler{},
+		nextID:   0,
+
+		logger: logger,
+	}
+}
+
+// Subscribe registers an in-process handler and returns a function removing it.
+func (s *Service) Subscribe(h Handler) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	s.handlers[id] = h
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.handlers, id)
+	}
+}
+
+func (s *Service) Publish(ctx context.Context, event Event) error {
+	fields := []zap.Field{zap.Stringer("id", event.ID), zap.String("type", string(event.Type))}
+	if event.AgentID != (gocql.UUID{}) {
+		fields = append(fields, zap.Stringer("agent_id", event.AgentID))
+	} else {
+		fields = append(fields, zap.Stringer("target_id", event.TargetID))
+	}
+	s.logger.Info("event", fields...)
+
+	s.mu.RLock()
+	for _, h := range s.handlers {
+		h(event)
+	}
+	s.mu.RUnlock()
+
+	if s.redis == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	if pubErr := s.redis.Publish(ctx, Channel, payload).Err(); pubErr != nil {
+		return fmt.Errorf("failed to publish event: %w", pubErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package incidents
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+)
+
+// Status is the lifecycle state of an incident.
+type Status string
+
+const (
+	StatusActive       Status = "active"
+	StatusAcknowledged Status = "acknowledged"
+	StatusResolved     Status = "resolved"
+)
+
+// Incident is a period during which a target was down.
+type Incident struct {
+	// ID is a time-based UUID of StartedAt
+	ID       gocql.UUID
+	TargetID gocql.UUID
+	Status   Status
+	// Title is a short summary of the failure
+	Title string
+	// Description is the failed check message
+	Description string
+	StartedAt   time.Time
+	// EndedAt is zero while the incident is active
+	EndedAt         time.Time
+	DowntimeSeconds int
+}
+
+// Diagnostics is the troubleshooting data of a failed check, linked to the
+// check result by target, check time and agent.
+type Diagnostics struct {
+	IncidentID gocql.UUID
+	TargetID   gocql.UUID
+	CheckTime  time.Time
+	AgentID    gocql.UUID
+
+	checker.Diagnostics
+}
@@ -0,0 +1,95 @@
+package incidents
+
+import "time"
+
+// IncidentResponse is a target incident.
+type IncidentResponse struct {
+	ID              string     `json:"id"`
+	TargetID        string     `json:"targetId"`
+	Status          string     `json:"status"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description,omitempty"`
+	StartedAt       time.Time  `json:"startedAt"`
+	EndedAt         *time.Time `json:"endedAt,omitempty"`
+	DowntimeSeconds int        `json:"downtimeSeconds"`
+}
+
+// HopResponse is a single step of the traced network path.
+type HopResponse struct {
+	// Probe time-to-live
+	TTL int `json:"ttl"`
+	// Replying router, empty when the probe was not answered
+	Addr string `json:"addr,omitempty"`
+	// Round-trip time in milliseconds
+	RTTMs float64 `json:"rttMs"`
+}
+
+// DiagnosticsResponse is the troubleshooting data of a failed check.
+type DiagnosticsResponse struct {
+	CheckTime       time.Time         `json:"checkTime"`
+	AgentID         string            `json:"agentId"`
+	CollectedAt     time.Time         `json:"collectedAt"`
+	ResolvedIPs     []string          `json:"resolvedIps"`
+	DNSError        string            `json:"dnsError,omitempty"`
+	Path            []HopResponse     `json:"path"`
+	PathError       string            `json:"pathError,omitempty"`
+	ResponseCode    int               `json:"responseCode,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	ResponseBody    string            `json:"responseBody,omitempty"`
+	ResponseError   string            `json:"responseError,omitempty"`
+}
+
+// IncidentDetailsResponse is an incident with the diagnostics collected for it.
+type IncidentDetailsResponse struct {
+	IncidentResponse
+
+	Diagnostics []DiagnosticsResponse `json:"diagnostics"`
+}
+
+func newIncidentResponse(i Incident) IncidentResponse {
+	var endedAt *time.Time
+	if !i.EndedAt.IsZero() {
+		endedAt = &i.EndedAt
+	}
+
+	return IncidentResponse{
+		ID:              i.ID.String(),
+		TargetID:        i.TargetID.String(),
+		Status:          string(i.Status),
+		Title:           i.Title,
+		Description:     i.Description,
+		StartedAt:       i.StartedAt,
+		EndedAt:         endedAt,
+		DowntimeSeconds: i.DowntimeSeconds,
+	}
+}
+
+func newDiagnosticsResponse(d Diagnostics) DiagnosticsResponse {
+	path := make([]HopResponse, len(d.Path))
+	for i, hop := range d.Path {
+		path[i] = HopResponse{
+			TTL:   hop.TTL,
+			Addr:  hop.Addr,
+			RTTMs: float64(hop.RTT) / float64(time.Millisecond),
+		}
+	}
+
+	resolved := d.ResolvedIPs
+	if resolved == nil {
+		resolved = []string{}
+	}
+
+	return DiagnosticsResponse{
+		CheckTime:       d.CheckTime,
+		AgentID:         d.AgentID.String(),
+		CollectedAt:     d.CollectedAt,
+		ResolvedIPs:     resolved,
+		DNSError:        d.DNSError,
+		Path:            path,
+		PathError:       d.PathError,
+		ResponseCode:    d.ResponseCode,
+		ResponseHeaders: d.ResponseHeaders,
+		ResponseBody:    d.ResponseBody,
+		ResponseError:   d.ResponseError,
+	}
+}
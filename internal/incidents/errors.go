@@ -0,0 +1,7 @@
+package incidents
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("not found")
+)
@@ -0,0 +1,105 @@
+package incidents
+
+import (
+	"errors"
+
+	"github.com/go-core-fx/fiberfx/handler"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	incidents *Service
+}
+
+func NewHandler(incidents *Service) handler.Handler {
+	return &Handler{
+		incidents: incidents,
+	}
+}
+
+func (h *Handler) Register(router fiber.Router) {
+	router = router.Group("/targets/:targetId/incidents")
+
+	router.Get("", h.list)
+	router.Get(":incidentId", h.get)
+}
+
+//	@Summary		List incidents
+//	@Description	Returns the latest incidents of the target, newest first
+//	@Tags			Incidents
+//	@Produce		json
+//	@Param			targetId	path		string	true	"Target ID"
+//	@Success		200			{array}		IncidentResponse
+//	@Failure		400			{object}	fiberfx.ErrorResponse
+//	@Router			/targets/{targetId}/incidents [get]
+//
+// List incidents.
+func (h *Handler) list(c *fiber.Ctx) error {
+	targetID, err := parseUUID(c, "targetId")
+	if err != nil {
+		return err
+	}
+
+	items, err := h.incidents.ListByTarget(c.Context(), targetID)
+	if err != nil {
+		return err
+	}
+
+	result := make([]IncidentResponse, len(items))
+	for i, item := range items {
+		result[i] = newIncidentResponse(item)
+	}
+
+	return c.JSON(result)
+}
+
+//	@Summary		Get incident
+//	@Description	Returns the incident with the failure diagnostics collected for it
+//	@Tags			Incidents
+//	@Produce		json
+//	@Param			targetId	path		string	true	"Target ID"
+//	@Param			incidentId	path		string	true	"Incident ID"
+//	@Success		200			{object}	IncidentDetailsResponse
+//	@Failure		404			{object}	fiberfx.ErrorResponse
+//	@Router			/targets/{targetId}/incidents/{incidentId} [get]
+//
+// Get incident.
+func (h *Handler) get(c *fiber.Ctx) error {
+	targetID, err := parseUUID(c, "targetId")
+	if err != nil {
+		return err
+	}
+
+	incidentID, err := parseUUID(c, "incidentId")
+	if err != nil {
+		return err
+	}
+
+	incident, diagnostics, err := h.incidents.Get(c.Context(), targetID, incidentID)
+	if errors.Is(err, ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	result := IncidentDetailsResponse{
+		IncidentResponse: newIncidentResponse(incident),
+		Diagnostics:      make([]DiagnosticsResponse, len(diagnostics)),
+	}
+	for i, d := range diagnostics {
+		result.Diagnostics[i] = newDiagnosticsResponse(d)
+	}
+
+	return c.JSON(result)
+}
+
+func parseUUID(c *fiber.Ctx, param string) (gocql.UUID, error) {
+	id, err := gocql.ParseUUID(c.Params(param))
+	if err != nil {
+		return gocql.UUID{}, fiber.NewError(fiber.StatusBadRequest, "invalid "+param)
+	}
+
+	return id, nil
+}
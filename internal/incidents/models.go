@@ -0,0 +1,179 @@
+package incidents
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/scylladb/gocqlx/v3/table"
+)
+
+//nolint:gochecknoglobals // table metadata
+var (
+	incidentsTable = table.New(table.Metadata{
+		Name: "incidents",
+		Columns: []string{
+			"target_id", "started_at", "incident_id", "ended_at", "status", "title", "description",
+			"resolved_at", "downtime_seconds",
+		},
+		PartKey: []string{"target_id"},
+		SortKey: []string{"started_at", "incident_id"},
+	})
+
+	activeIncidentsTable = table.New(table.Metadata{
+		Name:    "active_incidents",
+		Columns: []string{"target_id", "incident_id", "started_at", "title"},
+		PartKey: []string{"target_id"},
+		SortKey: []string{"incident_id"},
+	})
+
+	openIncidentsTable = table.New(table.Metadata{
+		Name:    "open_incidents",
+		Columns: []string{"target_id", "incident_id", "started_at", "title"},
+		PartKey: []string{"target_id"},
+		SortKey: []string{},
+	})
+
+	checkDiagnosticsTable = table.New(table.Metadata{
+		Name: "check_diagnostics",
+		Columns: []string{
+			"incident_id", "check_time", "agent_id", "target_id", "collected_at", "resolved_ips", "dns_error",
+			"path", "path_error", "response_code", "response_headers", "response_body", "response_error",
+		},
+		PartKey: []string{"incident_id"},
+		SortKey: []string{"check_time", "agent_id"},
+	})
+)
+
+type incidentModel struct {
+	TargetID        gocql.UUID `db:"target_id"`
+	StartedAt       time.Time  `db:"started_at"`
+	IncidentID      gocql.UUID `db:"incident_id"`
+	EndedAt         time.Time  `db:"ended_at"`
+	Status          string     `db:"status"`
+	Title           string     `db:"title"`
+	Description     string     `db:"description"`
+	ResolvedAt      time.Time  `db:"resolved_at"`
+	DowntimeSeconds int        `db:"downtime_seconds"`
+}
+
+type activeIncidentModel struct {
+	TargetID   gocql.UUID `db:"target_id"`
+	IncidentID gocql.UUID `db:"incident_id"`
+	StartedAt  time.Time  `db:"started_at"`
+	Title      string     `db:"title"`
+}
+
+type traceHopUDT struct {
+	TTL   int    `cql:"ttl"`
+	Addr  string `cql:"addr"`
+	RTTUs int    `cql:"rtt_us"`
+}
+
+type diagnosticsModel struct {
+	IncidentID      gocql.UUID        `db:"incident_id"`
+	CheckTime       time.Time         `db:"check_time"`
+	AgentID         gocql.UUID        `db:"agent_id"`
+	TargetID        gocql.UUID        `db:"target_id"`
+	CollectedAt     time.Time         `db:"collected_at"`
+	ResolvedIPs     []string          `db:"resolved_ips"`
+	DNSError        string            `db:"dns_error"`
+	Path            []traceHopUDT     `db:"path"`
+	PathError       string            `db:"path_error"`
+	ResponseCode    int               `db:"response_code"`
+	ResponseHeaders map[string]string `db:"response_headers"`
+	ResponseBody    string            `db:"response_body"`
+	ResponseError   string            `db:"response_error"`
+}
+
+func newIncidentModel(i Incident) incidentModel {
+	return incidentModel{
+		TargetID:        i.TargetID,
+		StartedAt:       i.StartedAt,
+		IncidentID:      i.ID,
+		EndedAt:         i.EndedAt,
+		Status:          string(i.Status),
+		Title:           i.Title,
+		Description:     i.Description,
+		ResolvedAt:      i.EndedAt,
+		DowntimeSeconds: i.DowntimeSeconds,
+	}
+}
+
+func (m incidentModel) active() activeIncidentModel {
+	return activeIncidentModel{
+		TargetID:   m.TargetID,
+		IncidentID: m.IncidentID,
+		StartedAt:  m.StartedAt,
+		Title:      m.Title,
+	}
+}
+
+func (m incidentModel) toDomain() Incident {
+	return Incident{
+		ID:              m.IncidentID,
+		TargetID:        m.TargetID,
+		Status:          Status(m.Status),
+		Title:           m.Title,
+		Description:     m.Description,
+		StartedAt:       m.StartedAt,
+		EndedAt:         m.EndedAt,
+		DowntimeSeconds: m.DowntimeSeconds,
+	}
+}
+
+func newDiagnosticsModel(d Diagnostics) diagnosticsModel {
+	path := make([]traceHopUDT, len(d.Path))
+	for i, hop := range d.Path {
+		path[i] = traceHopUDT{
+			TTL:   hop.TTL,
+			Addr:  hop.Addr,
+			RTTUs: int(hop.RTT.Microseconds()),
+		}
+	}
+
+	return diagnosticsModel{
+		IncidentID:      d.IncidentID,
+		CheckTime:       d.CheckTime.UTC().Truncate(time.Millisecond),
+		AgentID:         d.AgentID,
+		TargetID:        d.TargetID,
+		CollectedAt:     d.CollectedAt.UTC().Truncate(time.Millisecond),
+		ResolvedIPs:     d.ResolvedIPs,
+		DNSError:        d.DNSError,
+		Path:            path,
+		PathError:       d.PathError,
+		ResponseCode:    d.ResponseCode,
+		ResponseHeaders: d.ResponseHeaders,
+		ResponseBody:    d.ResponseBody,
+		ResponseError:   d.ResponseError,
+	}
+}
+
+func (m diagnosticsModel) toDomain() Diagnostics {
+	path := make([]checker.Hop, len(m.Path))
+	for i, hop := range m.Path {
+		path[i] = checker.Hop{
+			TTL:  hop.TTL,
+			Addr: hop.Addr,
+			RTT:  time.Duration(hop.RTTUs) * time.Microsecond,
+		}
+	}
+
+	return Diagnostics{
+		IncidentID: m.IncidentID,
+		TargetID:   m.TargetID,
+		CheckTime:  m.CheckTime,
+		AgentID:    m.AgentID,
+		Diagnostics: checker.Diagnostics{
+			CollectedAt:     m.CollectedAt,
+			ResolvedIPs:     m.ResolvedIPs,
+			DNSError:        m.DNSError,
+			Path:            path,
+			PathError:       m.PathError,
+			ResponseCode:    m.ResponseCode,
+			ResponseHeaders: m.ResponseHeaders,
+			ResponseBody:    m.ResponseBody,
+			ResponseError:   m.ResponseError,
+		},
+	}
+}
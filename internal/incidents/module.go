@@ -0,0 +1,15 @@
+package incidents
+
+import (
+	"github.com/go-core-fx/logger"
+	"go.uber.org/fx"
+)
+
+func Module() fx.Option {
+	return fx.Module(
+		"incidents",
+		logger.WithNamedLogger("incidents"),
+		fx.Provide(NewRepository, fx.Private),
+		fx.Provide(NewService),
+	)
+}
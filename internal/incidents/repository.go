@@ -0,0 +1,163 @@
+package incidents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v3"
+	"github.com/scylladb/gocqlx/v3/qb"
+)
+
+const maxListedIncidents = 100
+
+// Repository keeps incidents and the active_incidents index in sync.
+type Repository struct {
+	db gocqlx.Session
+}
+
+func NewRepository(db gocqlx.Session) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// GetActive returns the active incident of the target.
+func (r *Repository) GetActive(ctx context.Context, targetID gocql.UUID) (activeIncidentModel, error) {
+	var m activeIncidentModel
+	err := activeIncidentsTable.SelectBuilder(activeIncidentsTable.Metadata().Columns...).
+		Limit(1).
+		QueryContext(ctx, r.db).
+		Bind(targetID).
+		GetRelease(&m)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return activeIncidentModel{}, ErrNotFound
+	}
+	if err != nil {
+		return activeIncidentModel{}, fmt.Errorf("failed to get active incident: %w", err)
+	}
+
+	return m, nil
+}
+
+// Open claims the target for the new incident and stores it as active. When
+// another incident holds the target, it returns that one and false.
+func (r *Repository) Open(ctx context.Context, m incidentModel) (activeIncidentModel, bool, error) {
+	var holder activeIncidentModel
+	applied, err := openIncidentsTable.InsertBuilder().
+		Unique().
+		QueryContext(ctx, r.db).
+		BindStruct(m.active()).
+		GetCASRelease(&holder)
+	if err != nil {
+		return activeIncidentModel{}, false, fmt.Errorf("failed to claim incident: %w", err)
+	}
+	if !applied {
+		return holder, false, nil
+	}
+
+	batch := r.db.ContextBatch(ctx, gocql.LoggedBatch)
+
+	if err := batch.BindStruct(incidentsTable.InsertQueryContext(ctx, r.db), m); err != nil {
+		return activeIncidentModel{}, false, fmt.Errorf("failed to bind incident: %w", err)
+	}
+	if err := batch.BindStruct(activeIncidentsTable.InsertQueryContext(ctx, r.db), m.active()); err != nil {
+		return activeIncidentModel{}, false, fmt.Errorf("failed to bind active incident: %w", err)
+	}
+
+	if err := r.db.ExecuteBatch(batch); err != nil {
+		// Free the target for the retry, the incident was not stored.
+		return activeIncidentModel{}, false, errors.Join(
+			fmt.Errorf("failed to open incident: %w", err),
+			r.Release(context.WithoutCancel(ctx), m.active()),
+		)
+	}
+
+	return m.active(), true, nil
+}
+
+// Release frees the target held by the incident, unless another incident
+// holds it.
+func (r *Repository) Release(ctx context.Context, m activeIncidentModel) error {
+	_, err := openIncidentsTable.DeleteBuilder().
+		If(qb.Eq("incident_id")).
+		QueryContext(ctx, r.db).
+		BindStruct(m).
+		ExecCASRelease()
+	if err != nil {
+		return fmt.Errorf("failed to release incident: %w", err)
+	}
+
+	return nil
+}
+
+// Close stores the resolved incident, removes it from the active ones and
+// releases the target.
+func (r *Repository) Close(ctx context.Context, m incidentModel) error {
+	batch := r.db.ContextBatch(ctx, gocql.LoggedBatch)
+
+	if err := batch.BindStruct(incidentsTable.InsertQueryContext(ctx, r.db), m); err != nil {
+		return fmt.Errorf("failed to bind incident: %w", err)
+	}
+	if err := batch.BindStruct(activeIncidentsTable.DeleteQueryContext(ctx, r.db), m.active()); err != nil {
+		return fmt.Errorf("failed to bind active incident: %w", err)
+	}
+
+	if err := r.db.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("failed to close incident: %w", err)
+	}
+
+	return r.Release(ctx, m.active())
+}
+
+func (r *Repository) Get(ctx context.Context, key incidentModel) (incidentModel, error) {
+	var m incidentModel
+	err := incidentsTable.GetQueryContext(ctx, r.db).
+		BindStruct(key).
+		GetRelease(&m)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return incidentModel{}, ErrNotFound
+	}
+	if err != nil {
+		return incidentModel{}, fmt.Errorf("failed to get incident: %w", err)
+	}
+
+	return m, nil
+}
+
+// ListByTarget returns the latest incidents of the target, newest first.
+func (r *Repository) ListByTarget(ctx context.Context, targetID gocql.UUID) ([]incidentModel, error) {
+	var items []incidentModel
+	err := incidentsTable.SelectBuilder(incidentsTable.Metadata().Columns...).
+		Limit(maxListedIncidents).
+		QueryContext(ctx, r.db).
+		Bind(targetID).
+		SelectRelease(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list incidents: %w", err)
+	}
+
+	return items, nil
+}
+
+func (r *Repository) SaveDiagnostics(ctx context.Context, m diagnosticsModel) error {
+	if err := checkDiagnosticsTable.InsertQueryContext(ctx, r.db).BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to save diagnostics: %w", err)
+	}
+
+	return nil
+}
+
+// ListDiagnostics returns the diagnostics of the incident, newest first.
+func (r *Repository) ListDiagnostics(ctx context.Context, incidentID gocql.UUID) ([]diagnosticsModel, error) {
+	var items []diagnosticsModel
+	err := checkDiagnosticsTable.SelectQueryContext(ctx, r.db).
+		Bind(incidentID).
+		SelectRelease(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list diagnostics: %w", err)
+	}
+
+	return items, nil
+}
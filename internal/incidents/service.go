@@ -0,0 +1,187 @@
+package incidents
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.uber.org/zap"
+)
+
+// Service tracks the incidents of targets.
+type Service struct {
+	incidents *Repository
+
+	logger *zap.Logger
+}
+
+func NewService(incidents *Repository, logger *zap.Logger) *Service {
+	return &Service{
+		incidents: incidents,
+
+		logger: logger,
+	}
+}
+
+// Open starts an incident for the target, unless one is already active. It
+// returns the active incident and whether it was created by this call.
+//
+// Concurrent calls open a single incident: the target is claimed in a
+// lightweight transaction, the losers return the winner's incident.
+func (s *Service) Open(
+	ctx context.Context,
+	targetID gocql.UUID,
+	at time.Time,
+	title, description string,
+) (Incident, bool, error) {
+	active, err := s.incidents.GetActive(ctx, targetID)
+	if err == nil {
+		incident, getErr := s.get(ctx, targetID, active.IncidentID)
+		return incident, false, getErr
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return Incident{}, false, err
+	}
+
+	startedAt := at.UTC().Truncate(time.Millisecond)
+	incident := Incident{
+		ID:              gocql.UUIDFromTime(startedAt),
+		TargetID:        targetID,
+		Status:          StatusActive,
+		Title:           title,
+		Description:     description,
+		StartedAt:       startedAt,
+		EndedAt:         time.Time{},
+		DowntimeSeconds: 0,
+	}
+
+	holder, opened, err := s.incidents.Open(ctx, newIncidentModel(incident))
+	if err != nil {
+		return Incident{}, false, err
+	}
+	if !opened {
+		return s.held(ctx, holder, incident)
+	}
+
+	s.logger.Info("incident opened", zap.Stringer("target_id", targetID), zap.Stringer("incident_id", incident.ID))
+
+	return incident, true, nil
+}
+
+// held returns the incident holding the target. A resolved one, left behind by
+// a failed release, is released and the incident is opened again.
+func (s *Service) held(ctx context.Context, holder activeIncidentModel, incident Incident) (Incident, bool, error) {
+	current, err := s.get(ctx, holder.TargetID, holder.IncidentID)
+	if err != nil {
+		return Incident{}, false, err
+	}
+	if current.Status != StatusResolved {
+		return current, false, nil
+	}
+
+	if relErr := s.incidents.Release(ctx, holder); relErr != nil {
+		return Incident{}, false, relErr
+	}
+
+	holder, opened, err := s.incidents.Open(ctx, newIncidentModel(incident))
+	if err != nil {
+		return Incident{}, false, err
+	}
+	if !opened {
+		current, err = s.get(ctx, holder.TargetID, holder.IncidentID)
+		return current, false, err
+	}
+
+	s.logger.Info(
+		"incident opened",
+		zap.Stringer("target_id", incident.TargetID),
+		zap.Stringer("incident_id", incident.ID),
+	)
+
+	return incident, true, nil
+}
+
+// Resolve ends the active incident of the target. It returns ErrNotFound
+// when there is none.
+func (s *Service) Resolve(ctx context.Context, targetID gocql.UUID, at time.Time) (Incident, error) {
+	active, err := s.incidents.GetActive(ctx, targetID)
+	if err != nil {
+		return Incident{}, err
+	}
+
+	incident, err := s.get(ctx, targetID, active.IncidentID)
+	if err != nil {
+		return Incident{}, err
+	}
+
+	incident.Status = StatusResolved
+	incident.EndedAt = at.UTC().Truncate(time.Millisecond)
+	incident.DowntimeSeconds = int(incident.EndedAt.Sub(incident.StartedAt).Seconds())
+
+	if closeErr := s.incidents.Close(ctx, newIncidentModel(incident)); closeErr != nil {
+		return Incident{}, closeErr
+	}
+
+	s.logger.Info("incident resolved", zap.Stringer("target_id", targetID), zap.Stringer("incident_id", incident.ID))
+
+	return incident, nil
+}
+
+// AttachDiagnostics stores the diagnostics of a failed check with its incident.
+func (s *Service) AttachDiagnostics(ctx context.Context, diag Diagnostics) error {
+	return s.incidents.SaveDiagnostics(ctx, newDiagnosticsModel(diag))
+}
+
+// ListByTarget returns the latest incidents of the target, newest first.
+func (s *Service) ListByTarget(ctx context.Context, targetID gocql.UUID) ([]Incident, error) {
+	items, err := s.incidents.ListByTarget(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Incident, len(items))
+	for i, m := range items {
+		result[i] = m.toDomain()
+	}
+
+	return result, nil
+}
+
+// Get returns the incident with its diagnostics.
+func (s *Service) Get(ctx context.Context, targetID, incidentID gocql.UUID) (Incident, []Diagnostics, error) {
+	incident, err := s.get(ctx, targetID, incidentID)
+	if err != nil {
+		return Incident{}, nil, err
+	}
+
+	items, err := s.incidents.ListDiagnostics(ctx, incidentID)
+	if err != nil {
+		return Incident{}, nil, err
+	}
+
+	diagnostics := make([]Diagnostics, len(items))
+	for i, m := range items {
+		diagnostics[i] = m.toDomain()
+	}
+
+	return incident, diagnostics, nil
+}
+
+// get looks the incident up by its ID, which encodes the start time.
+func (s *Service) get(ctx context.Context, targetID, incidentID gocql.UUID) (Incident, error) {
+	if incidentID.Version() != 1 {
+		return Incident{}, ErrNotFound
+	}
+
+	m, err := s.incidents.Get(ctx, incidentModel{ //nolint:exhaustruct // primary key only
+		TargetID:   targetID,
+		StartedAt:  incidentID.Time(),
+		IncidentID: incidentID,
+	})
+	if err != nil {
+		return Incident{}, err
+	}
+
+	return m.toDomain(), nil
+}
@@ -0,0 +1,194 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingplex/pingplex/internal/agents"
+)
+
+const (
+	apiPath = "/api/v1/agents/"
+	// requestTimeout bounds the requests other than the work long-poll
+	requestTimeout = 30 * time.Second
+	nonceBytes     = 16
+	maxErrorBody   = 4 * 1024
+)
+
+// Client calls the agent API of the server, signing the requests with the
+// agent key once registered.
+type Client struct {
+	baseURL  *url.URL
+	http     *http.Client
+	identity *Identity
+}
+
+func NewClient(config Config, identity *Identity) (*Client, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(config.ServerURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server url: %w", err)
+	}
+
+	return &Client{
+		baseURL:  baseURL,
+		http:     &http.Client{}, //nolint:exhaustruct // timeouts are set per request
+		identity: identity,
+	}, nil
+}
+
+func (c *Client) Register(ctx context.Context, req agents.RegisterRequest) (agents.AgentResponse, error) {
+	var resp agents.AgentResponse
+	err := c.do(ctx, http.MethodPost, "register", req, &resp, requestTimeout)
+
+	return resp, err
+}
+
+func (c *Client) Me(ctx context.Context) (agents.AgentResponse, error) {
+	var resp agents.AgentResponse
+	err := c.do(ctx, http.MethodGet, "me", nil, &resp, requestTimeout)
+
+	return resp, err
+}
+
+func (c *Client) Heartbeat(ctx context.Context, req agents.HeartbeatRequest) (agents.HeartbeatResponse, error) {
+	var resp agents.HeartbeatResponse
+	err := c.do(ctx, http.MethodPost, "heartbeat", req, &resp, requestTimeout)
+
+	return resp, err
+}
+
+// Work waits up to the given time for at most max checks.
+func (c *Client) Work(ctx context.Context, limit int, wait time.Duration) (agents.WorkResponse, error) {
+	query := url.Values{}
+	query.Set("max", strconv.Itoa(limit))
+	query.Set("wait", strconv.Itoa(int(wait/time.Second)))
+
+	var resp agents.WorkResponse
+	err := c.do(ctx, http.MethodGet, "work?"+query.Encode(), nil, &resp, wait+requestTimeout)
+
+	return resp, err
+}
+
+func (c *Client) SubmitResults(ctx context.Context, req agents.SubmitResultsRequest) (agents.SubmitResultsResponse, error) {
+	var resp agents.SubmitResultsResponse
+	err := c.do(ctx, http.MethodPost, "results", req, &resp, requestTimeout)
+
+	return resp, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	target := c.baseURL.JoinPath(apiPath)
+	target, err := target.Parse(path)
+	if err != nil {
+		return fmt.Errorf("failed to build request url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.identity.Registered() {
+		if signErr := c.sign(req, body); signErr != nil {
+			return signErr
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRequestFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newStatusError(resp)
+	}
+
+	if decErr := json.NewDecoder(resp.Body).Decode(out); decErr != nil {
+		return fmt.Errorf("failed to decode response: %w", decErr)
+	}
+
+	return nil
+}
+
+func (c *Client) sign(req *http.Request, body []byte) error {
+	headers, err := c.signatureHeaders(req.Method, req.URL.RequestURI(), body)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	return nil
+}
+
+// signatureHeaders returns the headers authenticating a request of the agent.
+func (c *Client) signatureHeaders(method, path string, body []byte) (map[string]string, error) {
+	nonce := make([]byte, nonceBytes)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	now := time.Now()
+	encodedNonce := hex.EncodeToString(nonce)
+
+	return map[string]string{
+		agents.HeaderAgentID:   c.identity.ID.String(),
+		agents.HeaderTimestamp: strconv.FormatInt(now.Unix(), 10),
+		agents.HeaderNonce:     encodedNonce,
+		agents.HeaderSignature: agents.Sign(c.identity.Key, method, path, body, now, encodedNonce),
+	}, nil
+}
+
+// StatusError is an error response of the server.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil || body.Message == "" {
+		body.Message = strings.TrimSpace(string(raw))
+	}
+
+	return &StatusError{Code: resp.StatusCode, Message: body.Message}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", ErrRequestFailed, e.Code, e.Message)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrRequestFailed
+}
@@ -0,0 +1,38 @@
+package probe
+
+import "time"
+
+// Config holds the configuration of the agent mode.
+type Config struct {
+	// ServerURL is the base URL of the pingplex server
+	ServerURL string
+	// GRPCAddress selects the server control stream over polling the HTTP API
+	GRPCAddress string
+	// GRPCPlaintext disables TLS on the control stream, for a server serving it in plaintext
+	GRPCPlaintext bool
+	// DataDir keeps the agent key and ID between restarts
+	DataDir string
+
+	// Name defaults to the host name
+	Name     string
+	Location string
+	Regions  []string
+	// CheckTypes defaults to every type the agent can check
+	CheckTypes          []string
+	MaxConcurrentChecks int
+	Tags                []string
+
+	// PollWait is the long-poll timeout of work requests
+	PollWait time.Duration
+	// HeartbeatInterval is how often the agent reports it is alive
+	HeartbeatInterval time.Duration
+	// UploadInterval is how often results are uploaded
+	UploadInterval time.Duration
+	// UploadBatchSize is the maximum number of results per upload
+	UploadBatchSize int
+	// SpoolMaxBytes bounds the results kept on disk while uploads fail
+	SpoolMaxBytes int64
+	// SpoolMaxAge is how long after their check results are kept for an upload,
+	// at most agents.SubmissionTTL
+	SpoolMaxAge time.Duration
+}
@@ -0,0 +1,8 @@
+package probe
+
+import "errors"
+
+var (
+	ErrRequestFailed = errors.New("request failed")
+	ErrInvalidKey    = errors.New("invalid agent key")
+)
@@ -0,0 +1,108 @@
+package probe
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	keyFile = "agent.key"
+	idFile  = "agent.id"
+)
+
+// Identity is the key pair of the agent and the ID assigned at registration.
+type Identity struct {
+	dir string
+
+	Key ed25519.PrivateKey
+	// ID is zero until the agent registers
+	ID gocql.UUID
+}
+
+// LoadIdentity reads the identity from the directory, generating a key on first start.
+func LoadIdentity(dir string) (*Identity, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil { //nolint:mnd // owner only
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+
+	key, err := loadKey(filepath.Join(dir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{dir: dir, Key: key, ID: gocql.UUID{}}
+
+	raw, err := os.ReadFile(filepath.Join(dir, idFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return identity, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent id: %w", err)
+	}
+
+	if identity.ID, err = gocql.ParseUUID(strings.TrimSpace(string(raw))); err != nil {
+		return nil, fmt.Errorf("failed to parse agent id: %w", err)
+	}
+
+	return identity, nil
+}
+
+// PublicKey returns the base64 encoded public key.
+func (i *Identity) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(i.Key.Public().(ed25519.PublicKey)) //nolint:forcetypeassert // always ed25519
+}
+
+// Registered reports whether the agent has an ID.
+func (i *Identity) Registered() bool {
+	return i.ID != gocql.UUID{}
+}
+
+// SetID stores the ID assigned at registration.
+func (i *Identity) SetID(id gocql.UUID) error {
+	if err := os.WriteFile(filepath.Join(i.dir, idFile), []byte(id.String()+"\n"), 0o600); err != nil { //nolint:mnd // owner only
+		return fmt.Errorf("failed to write agent id: %w", err)
+	}
+	i.ID = id
+
+	return nil
+}
+
+func loadKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return generateKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent key: %w", err)
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKey, path)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func generateKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate agent key: %w", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(key.Seed()) + "\n"
+	if writeErr := os.WriteFile(path, []byte(encoded), 0o600); writeErr != nil { //nolint:mnd // owner only
+		return nil, fmt.Errorf("failed to write agent key: %w", writeErr)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,39 @@
+package probe
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-core-fx/logger"
+	"go.uber.org/fx"
+)
+
+func Module() fx.Option {
+	return fx.Module(
+		"probe",
+		logger.WithNamedLogger("probe"),
+		fx.Provide(func(config Config) (*Identity, error) {
+			return LoadIdentity(config.DataDir)
+		}, fx.Private),
+		fx.Provide(NewClient, fx.Private),
+		fx.Provide(NewStream, fx.Private),
+		fx.Provide(NewSpool, fx.Private),
+		fx.Provide(NewService),
+		fx.Invoke(func(lc fx.Lifecycle, svc *Service) {
+			ctx, cancel := context.WithCancel(context.Background())
+			var wg sync.WaitGroup
+
+			lc.Append(fx.Hook{
+				OnStart: func(_ context.Context) error {
+					wg.Go(func() { svc.Run(ctx) })
+					return nil
+				},
+				OnStop: func(_ context.Context) error {
+					cancel()
+					wg.Wait()
+					return nil
+				},
+			})
+		}),
+	)
+}
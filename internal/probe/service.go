@@ -0,0 +1,432 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-core-fx/healthfx"
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/agents"
+	"github.com/pingplex/pingplex/internal/checker"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxConcurrentChecks = 10
+	defaultPollWait            = 30 * time.Second
+	defaultHeartbeatInterval   = 30 * time.Second
+	defaultUploadInterval      = 5 * time.Second
+	defaultUploadBatchSize     = 100
+	maxBackoff                 = time.Minute
+	// shutdownTimeout bounds the final upload
+	shutdownTimeout = 10 * time.Second
+)
+
+// Service runs the agent: it registers with the server, sends heartbeats,
+// polls for checks, runs them and uploads the results.
+type Service struct {
+	config  Config
+	version string
+
+	identity *Identity
+	client   *Client
+	stream   *Stream
+	spool    *Spool
+	checks   *checker.Service
+
+	running atomic.Int32
+	results chan agents.ResultItem
+	freed   chan struct{}
+
+	logger *zap.Logger
+}
+
+func NewService(
+	config Config,
+	version healthfx.Version,
+	identity *Identity,
+	client *Client,
+	stream *Stream,
+	spool *Spool,
+	checks *checker.Service,
+	logger *zap.Logger,
+) *Service {
+	if config.MaxConcurrentChecks <= 0 {
+		config.MaxConcurrentChecks = defaultMaxConcurrentChecks
+	}
+	if config.PollWait <= 0 {
+		config.PollWait = defaultPollWait
+	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if config.UploadInterval <= 0 {
+		config.UploadInterval = defaultUploadInterval
+	}
+	if config.UploadBatchSize <= 0 {
+		config.UploadBatchSize = defaultUploadBatchSize
+	}
+
+	return &Service{
+		config:  config,
+		version: version.Version,
+
+		identity: identity,
+		client:   client,
+		stream:   stream,
+		spool:    spool,
+		checks:   checks,
+
+		running: atomic.Int32{},
+		results: make(chan agents.ResultItem, config.MaxConcurrentChecks),
+		freed:   make(chan struct{}, 1),
+
+		logger: logger,
+	}
+}
+
+// Run works until the context is canceled, then uploads the pending results.
+// The results left are uploaded on the next start.
+func (s *Service) Run(ctx context.Context) {
+	defer func() {
+		if err := s.spool.Close(); err != nil {
+			s.logger.Error("failed to close spool", zap.Error(err))
+		}
+	}()
+
+	if !s.register(ctx) {
+		return
+	}
+
+	var checks sync.WaitGroup
+	// Results of the running checks are still uploaded.
+	closeResults := func() {
+		checks.Wait()
+		close(s.results)
+	}
+
+	if s.stream != nil {
+		s.streamWork(ctx, &checks)
+		go closeResults()
+		s.upload(ctx)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() { s.heartbeats(ctx) })
+	wg.Go(func() {
+		s.poll(ctx, &checks)
+		closeResults()
+	})
+	wg.Go(func() { s.upload(ctx) })
+	wg.Wait()
+}
+
+// register registers the agent on first start, retrying until it succeeds.
+func (s *Service) register(ctx context.Context) bool {
+	for attempt := 0; ; attempt++ {
+		err := s.tryRegister(ctx)
+		if err == nil {
+			return true
+		}
+
+		s.logger.Error("failed to register agent", zap.Error(err))
+		if !sleep(ctx, backoff(attempt)) {
+			return false
+		}
+	}
+}
+
+func (s *Service) tryRegister(ctx context.Context) error {
+	if s.identity.Registered() {
+		agent, err := s.client.Me(ctx)
+		if err != nil {
+			return err
+		}
+
+		s.logger.Info("agent started", zap.String("agent_id", agent.ID), zap.String("status", agent.Status))
+		if agent.Version == s.version {
+			return nil
+		}
+
+		// Report the upgrade before polling, the server may refuse the old version.
+		_, err = s.client.Heartbeat(ctx, agents.HeartbeatRequest{Version: s.version})
+		return err
+	}
+
+	agent, err := s.client.Register(ctx, s.registration())
+	if err != nil {
+		return err
+	}
+
+	id, err := gocql.ParseUUID(agent.ID)
+	if err != nil {
+		return err
+	}
+	if idErr := s.identity.SetID(id); idErr != nil {
+		return idErr
+	}
+
+	s.logger.Info("agent registered, validating with canary checks", zap.String("agent_id", agent.ID))
+
+	return nil
+}
+
+func (s *Service) registration() agents.RegisterRequest {
+	name := s.config.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	checkTypes := s.config.CheckTypes
+	if len(checkTypes) == 0 {
+		for _, t := range s.checks.Types() {
+			checkTypes = append(checkTypes, string(t))
+		}
+	}
+
+	return agents.RegisterRequest{
+		Name:     name,
+		Version:  s.version,
+		Location: s.config.Location,
+		Capabilities: agents.CapabilitiesDTO{
+			CheckTypes:          checkTypes,
+			Regions:             s.config.Regions,
+			MaxConcurrentChecks: s.config.MaxConcurrentChecks,
+		},
+		PublicKey: s.identity.PublicKey(),
+		Tags:      s.config.Tags,
+	}
+}
+
+func (s *Service) heartbeats(ctx context.Context) {
+	ticker := time.NewTicker(s.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	status, upgrade := "", ""
+	for {
+		resp, err := s.client.Heartbeat(ctx, agents.HeartbeatRequest{Version: s.version})
+		switch {
+		case err != nil && ctx.Err() == nil:
+			s.logger.Warn("heartbeat failed", zap.Error(err))
+		case err == nil:
+			if resp.Status != status {
+				s.logger.Info("agent status", zap.String("status", resp.Status))
+				status = resp.Status
+			}
+			upgrade = s.upgrade(upgrade, resp.Upgrade)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// upgrade logs the upgrade notice of the server when it changed and returns
+// its message.
+func (s *Service) upgrade(previous string, notice *agents.UpgradeNotice) string {
+	switch {
+	case notice == nil:
+		return ""
+	case notice.Message == previous:
+		return previous
+	case notice.Required:
+		s.logger.Error("agent upgrade required", zap.String("message", notice.Message))
+	default:
+		s.logger.Warn("agent upgrade recommended", zap.String("message", notice.Message))
+	}
+
+	return notice.Message
+}
+
+// poll requests work within the free capacity and runs it.
+func (s *Service) poll(ctx context.Context, checks *sync.WaitGroup) {
+	failures := 0
+	for ctx.Err() == nil {
+		free := s.free()
+		if free == 0 {
+			select {
+			case <-ctx.Done():
+			case <-s.freed:
+			}
+			continue
+		}
+
+		work, err := s.client.Work(ctx, free, s.config.PollWait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			wait := backoff(failures)
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) && statusErr.Code == http.StatusForbidden {
+				// Suspended, rejected or outdated.
+				wait = s.config.PollWait
+			}
+			s.logger.Warn("failed to poll for work", zap.Error(err))
+			failures++
+			sleep(ctx, wait)
+			continue
+		}
+		failures = 0
+
+		for _, item := range work.Items {
+			s.start(ctx, checks, item)
+		}
+	}
+}
+
+// free returns how many more checks may run at once.
+func (s *Service) free() int {
+	return max(s.config.MaxConcurrentChecks-int(s.running.Load()), 0)
+}
+
+// start runs the check, or collects the failure diagnostics asked for, in the
+// background. The outcome is sent to the uploader, unless the check was cut
+// short by the shutdown: it says nothing about the target then, the server
+// accounts for the run once the assignment expires.
+func (s *Service) start(ctx context.Context, checks *sync.WaitGroup, item agents.WorkItemResponse) {
+	s.running.Add(1)
+	checks.Go(func() {
+		defer func() {
+			s.running.Add(-1)
+			select {
+			case s.freed <- struct{}{}:
+			default:
+			}
+		}()
+
+		if item.Diagnose {
+			diag := s.checks.Diagnose(ctx, item.Target)
+			if ctx.Err() != nil {
+				s.logger.Info("dropped interrupted diagnostics", zap.String("assignment_id", item.ID))
+				return
+			}
+			s.results <- agents.ResultItem{
+				ID:           gocql.MustRandomUUID().String(),
+				AssignmentID: item.ID,
+				Result:       checker.Result{TargetID: item.Target.ID, CheckTime: diag.CollectedAt}, //nolint:exhaustruct // not a check
+				Diagnostics:  &diag,
+			}
+			return
+		}
+
+		result := s.checks.Check(ctx, item.Target)
+		if ctx.Err() != nil {
+			s.logger.Info("dropped interrupted check", zap.String("assignment_id", item.ID))
+			return
+		}
+
+		s.results <- agents.ResultItem{
+			ID:           gocql.MustRandomUUID().String(),
+			AssignmentID: item.ID,
+			Result:       result,
+			Diagnostics:  nil,
+		}
+	})
+}
+
+// upload spools the results and sends them in batches until the results
+// channel is closed.
+func (s *Service) upload(ctx context.Context) {
+	ticker := time.NewTicker(s.config.UploadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item, ok := <-s.results:
+			if !ok {
+				final, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+				s.flush(final)
+				cancel()
+				return
+			}
+
+			s.spool.Add(item)
+			if s.spool.Len() >= s.config.UploadBatchSize && ctx.Err() == nil {
+				s.flush(ctx)
+			}
+		case <-ticker.C:
+			if ctx.Err() == nil {
+				s.flush(ctx)
+			}
+		}
+	}
+}
+
+// flush uploads the spooled results until the server fails or asks to retry.
+func (s *Service) flush(ctx context.Context) {
+	for s.spool.Len() > 0 {
+		batch := s.spool.Take(s.config.UploadBatchSize)
+		if len(batch) == 0 {
+			return
+		}
+
+		resp, err := s.client.SubmitResults(ctx, agents.SubmitResultsRequest{Results: batch})
+		if err != nil {
+			s.logger.Warn("failed to upload results", zap.Int("count", len(batch)), zap.Error(err))
+			s.spool.Requeue(batch)
+			return
+		}
+
+		if s.settle(batch, resp) {
+			// Retried on the next upload.
+			return
+		}
+	}
+}
+
+// settle resolves the uploaded batch from the server response, the results
+// the server asked to retry are queued again and the other rejected ones are
+// dropped. It reports whether any result is retried.
+func (s *Service) settle(batch []agents.ResultItem, resp agents.SubmitResultsResponse) bool {
+	retry := map[string]bool{}
+	for _, rejected := range resp.Rejected {
+		if rejected.Retry {
+			retry[rejected.ID] = true
+			continue
+		}
+		s.logger.Warn("result rejected", zap.String("id", rejected.ID), zap.String("error", rejected.Error))
+	}
+
+	var retried []agents.ResultItem
+	done := make([]string, 0, len(batch))
+	for _, item := range batch {
+		if retry[item.ID] {
+			retried = append(retried, item)
+		} else {
+			done = append(done, item.ID)
+		}
+	}
+
+	s.spool.Done(done...)
+	s.spool.Requeue(retried)
+
+	return len(retried) > 0
+}
+
+func backoff(attempt int) time.Duration {
+	return min(time.Second<<min(attempt, 6), maxBackoff) //nolint:mnd // 64s cap before min
+}
+
+// sleep waits for the duration, it returns false when the context is canceled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,386 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingplex/pingplex/internal/agents"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSpoolMaxBytes = 64 << 20
+
+	spoolDir   = "spool"
+	segmentExt = ".log"
+	// maxSegmentBytes is the size spool segments are rotated at
+	maxSegmentBytes = 1 << 20
+	// minSegments keeps the oldest segment from being most of a small spool
+	minSegments = 8
+)
+
+// Spool is the write-ahead log of the results not acknowledged by the server.
+// Results are appended to segment files as they complete and a segment is
+// deleted once all of its results are resolved, so results survive server
+// outages and agent restarts. The results left on start are replayed in
+// order, the server ignores the ones it recorded already.
+//
+// The spool is bounded: the oldest segment is dropped when it grows past its
+// size limit, and results checked longer ago than its maximum age expire.
+//
+// It is not safe for concurrent use.
+type Spool struct {
+	dir          string
+	maxBytes     int64
+	maxAge       time.Duration
+	segmentBytes int64
+
+	// queue holds the results waiting for an upload, in order
+	queue []agents.ResultItem
+	// index maps the unresolved results, queued or uploading, to their segment
+	index    map[string]*segment
+	segments []*segment
+	size     int64
+	nextSeq  uint64
+
+	logger *zap.Logger
+}
+
+type segment struct {
+	path string
+	// file is set on the segment results are appended to
+	file *os.File
+	size int64
+	// open is the number of unresolved results
+	open int
+}
+
+// NewSpool opens the spool in the data directory and loads the results left
+// by the previous run.
+func NewSpool(config Config, logger *zap.Logger) (*Spool, error) {
+	if config.SpoolMaxBytes <= 0 {
+		config.SpoolMaxBytes = defaultSpoolMaxBytes
+	}
+	if config.SpoolMaxAge <= 0 {
+		config.SpoolMaxAge = agents.SubmissionTTL
+	}
+	if config.SpoolMaxAge > agents.SubmissionTTL {
+		// Older results could be recorded twice, the server forgets them.
+		logger.Warn(
+			"spool max age exceeds the server deduplication window",
+			zap.Duration("max_age", config.SpoolMaxAge),
+			zap.Duration("capped_to", agents.SubmissionTTL),
+		)
+		config.SpoolMaxAge = agents.SubmissionTTL
+	}
+
+	s := &Spool{
+		dir:          filepath.Join(config.DataDir, spoolDir),
+		maxBytes:     config.SpoolMaxBytes,
+		maxAge:       config.SpoolMaxAge,
+		segmentBytes: min(maxSegmentBytes, max(config.SpoolMaxBytes/minSegments, 1)),
+
+		queue:    nil,
+		index:    map[string]*segment{},
+		segments: nil,
+		size:     0,
+		nextSeq:  0,
+
+		logger: logger,
+	}
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil { //nolint:mnd // owner only
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if len(s.queue) > 0 {
+		s.logger.Info("replaying spooled results", zap.Int("count", len(s.queue)))
+	}
+
+	return s, nil
+}
+
+// Len returns the number of results waiting for an upload.
+func (s *Spool) Len() int {
+	return len(s.queue)
+}
+
+// Add appends the result to the spool. When it cannot be written, the result
+// is only kept in memory.
+func (s *Spool) Add(item agents.ResultItem) {
+	seg, err := s.write(item)
+	if err != nil {
+		s.logger.Warn("failed to spool result", zap.String("id", item.ID), zap.Error(err))
+	}
+
+	s.queue = append(s.queue, item)
+	s.index[item.ID] = seg
+	if seg != nil {
+		seg.open++
+	}
+
+	s.evict()
+}
+
+// Take removes up to n results from the queue for an upload, dropping the
+// expired ones. The results stay spooled until they are resolved or queued
+// again.
+func (s *Spool) Take(n int) []agents.ResultItem {
+	s.expire()
+
+	batch := slices.Clone(s.queue[:min(n, len(s.queue))])
+	s.queue = s.queue[len(batch):]
+
+	return batch
+}
+
+// Requeue puts taken results back in front of the queue, in order.
+func (s *Spool) Requeue(items []agents.ResultItem) {
+	items = slices.DeleteFunc(slices.Clone(items), func(item agents.ResultItem) bool {
+		// Dropped while uploading.
+		_, ok := s.index[item.ID]
+		return !ok
+	})
+
+	s.queue = append(items, s.queue...)
+}
+
+// Done resolves taken results, deleting the segments left without unresolved ones.
+func (s *Spool) Done(ids ...string) {
+	for _, id := range ids {
+		seg, ok := s.index[id]
+		if !ok {
+			continue
+		}
+
+		delete(s.index, id)
+		if seg == nil {
+			continue
+		}
+		if seg.open--; seg.open == 0 {
+			s.remove(seg)
+		}
+	}
+}
+
+// Close flushes the segment results are appended to.
+func (s *Spool) Close() error {
+	for _, seg := range s.segments {
+		if seg.file == nil {
+			continue
+		}
+		if err := closeSegment(seg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write appends the result to the last segment, rotating it when full.
+func (s *Spool) write(item agents.ResultItem) (*segment, error) {
+	line, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode result: %w", err)
+	}
+	line = append(line, '\n')
+
+	seg := s.last()
+	if seg == nil || seg.file == nil || seg.size >= s.segmentBytes {
+		if seg, err = s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := seg.file.Write(line)
+	seg.size += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write spool segment: %w", err)
+	}
+
+	return seg, nil
+}
+
+// rotate closes the segment results are appended to and starts a new one.
+func (s *Spool) rotate() (*segment, error) {
+	if last := s.last(); last != nil && last.file != nil {
+		if err := closeSegment(last); err != nil {
+			return nil, err
+		}
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextSeq, segmentExt))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) //nolint:mnd // owner only
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	s.nextSeq++
+
+	seg := &segment{path: path, file: file, size: 0, open: 0}
+	s.segments = append(s.segments, seg)
+
+	return seg, nil
+}
+
+func (s *Spool) last() *segment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+// remove deletes the segment with the results left in it.
+func (s *Spool) remove(seg *segment) {
+	if seg.file != nil {
+		_ = seg.file.Close()
+		seg.file = nil
+	}
+	if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Warn("failed to delete spool segment", zap.String("path", seg.path), zap.Error(err))
+	}
+
+	s.size -= seg.size
+	s.segments = slices.DeleteFunc(s.segments, func(other *segment) bool { return other == seg })
+}
+
+// evict drops the oldest segments while the spool is over its size limit.
+func (s *Spool) evict() {
+	for s.size > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		dropped := 0
+		s.queue = slices.DeleteFunc(s.queue, func(item agents.ResultItem) bool {
+			return s.index[item.ID] == oldest
+		})
+		for id, seg := range s.index {
+			if seg == oldest {
+				delete(s.index, id)
+				dropped++
+			}
+		}
+		s.remove(oldest)
+
+		s.logger.Warn("spool full, dropping the oldest results", zap.Int("count", dropped))
+	}
+}
+
+// expire drops the results at the front of the queue checked longer ago than
+// the maximum age. Results are queued about in check time order.
+func (s *Spool) expire() {
+	cutoff := time.Now().Add(-s.maxAge)
+
+	n := 0
+	for n < len(s.queue) && s.queue[n].Result.CheckTime.Before(cutoff) {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	ids := make([]string, n)
+	for i, item := range s.queue[:n] {
+		ids[i] = item.ID
+	}
+	s.queue = s.queue[n:]
+	s.Done(ids...)
+
+	s.logger.Warn("dropping expired results", zap.Int("count", n))
+}
+
+// load reads the segments left by the previous run, in order.
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool dir: %w", err)
+	}
+
+	// Names are zero padded sequence numbers, so they sort in order.
+	for _, entry := range entries {
+		seq, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		n, parseErr := strconv.ParseUint(seq, 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		s.nextSeq = max(s.nextSeq, n+1)
+
+		if loadErr := s.loadSegment(filepath.Join(s.dir, entry.Name())); loadErr != nil {
+			return loadErr
+		}
+	}
+
+	s.evict()
+	s.expire()
+
+	return nil
+}
+
+func (s *Spool) loadSegment(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read spool segment: %w", err)
+	}
+
+	seg := &segment{path: path, file: nil, size: int64(len(raw)), open: 0}
+	s.segments = append(s.segments, seg)
+	s.size += seg.size
+
+	corrupt := 0
+	reader := bufio.NewReader(bytes.NewReader(raw))
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var item agents.ResultItem
+			if jsonErr := json.Unmarshal(line, &item); jsonErr != nil || item.ID == "" {
+				// A write interrupted by a crash.
+				corrupt++
+			} else if _, dup := s.index[item.ID]; !dup {
+				s.queue = append(s.queue, item)
+				s.index[item.ID] = seg
+				seg.open++
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+
+	if corrupt > 0 {
+		s.logger.Warn("skipped corrupt spooled results", zap.String("path", path), zap.Int("count", corrupt))
+	}
+	if seg.open == 0 {
+		s.remove(seg)
+	}
+
+	return nil
+}
+
+func closeSegment(seg *segment) error {
+	file := seg.file
+	seg.file = nil
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close spool segment: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pingplex/pingplex/internal/agents"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// streamKeepalive is how often an idle connection is pinged, within the server enforcement policy
+	streamKeepalive        = 30 * time.Second
+	streamKeepaliveTimeout = 10 * time.Second
+	// maxInflightBatches bounds the result batches awaiting an acknowledgement
+	maxInflightBatches = 4
+)
+
+// Stream is the control stream to the server.
+type Stream struct {
+	conn   *grpc.ClientConn
+	client *Client
+}
+
+// NewStream connects lazily to the control stream, it returns nil when the
+// agent polls the HTTP API instead.
+func NewStream(config Config, client *Client) (*Stream, error) {
+	if config.GRPCAddress == "" {
+		return nil, nil //nolint:nilnil // disabled
+	}
+
+	// Work frames carry the target credentials, plaintext is opt-in.
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12}) //nolint:exhaustruct // defaults
+	if config.GRPCPlaintext {
+		creds = insecure.NewCredentials()
+	}
+
+	conn, err := grpc.NewClient(
+		config.GRPCAddress,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(agents.JSONCodec{})),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                streamKeepalive,
+			Timeout:             streamKeepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+
+	return &Stream{conn: conn, client: client}, nil
+}
+
+func (s *Stream) Close() error {
+	return s.conn.Close()
+}
+
+func (s *Stream) open(ctx context.Context) (grpc.ClientStream, error) {
+	headers, err := s.client.signatureHeaders(http.MethodPost, agents.StreamMethod, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := s.conn.NewStream(
+		metadata.NewOutgoingContext(ctx, metadata.New(headers)),
+		&grpc.StreamDesc{StreamName: "Connect", Handler: nil, ServerStreams: true, ClientStreams: true},
+		agents.StreamMethod,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRequestFailed, err)
+	}
+
+	return stream, nil
+}
+
+// streamState survives reconnections: results not acknowledged when a
+// session ends are sent again by the next one, the server ignores duplicates.
+type streamState struct {
+	// inflight holds the uploaded batches awaiting an acknowledgement
+	inflight map[uint64][]agents.ResultItem
+	seq      uint64
+	status   string
+	upgrade  string
+	// outdated is set while the server refuses the agent version
+	outdated bool
+	interval time.Duration
+}
+
+// requeue moves the results awaiting an acknowledgement back to the spool, in order.
+func (st *streamState) requeue(spool *Spool) {
+	seqs := slices.Sorted(maps.Keys(st.inflight))
+
+	var unacknowledged []agents.ResultItem
+	for _, seq := range seqs {
+		unacknowledged = append(unacknowledged, st.inflight[seq]...)
+		delete(st.inflight, seq)
+	}
+
+	spool.Requeue(unacknowledged)
+}
+
+// streamWork works over the control stream, reconnecting with backoff, until
+// the context is canceled. Running checks and their results carry over
+// reconnections, and so does the work queued for the agent meanwhile.
+func (s *Service) streamWork(ctx context.Context, checks *sync.WaitGroup) {
+	defer s.stream.Close()
+
+	st := &streamState{
+		inflight: map[uint64][]agents.ResultItem{},
+		seq:      0,
+		status:   "",
+		upgrade:  "",
+		outdated: false,
+		interval: s.config.HeartbeatInterval,
+	}
+
+	failures := 0
+	for {
+		connected, err := s.session(ctx, checks, st)
+		st.requeue(s.spool)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			failures = 0
+		}
+
+		s.logger.Warn("control stream closed", zap.Error(err))
+
+		// Results keep coming while disconnected.
+		timer := time.NewTimer(backoff(failures))
+		failures++
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case item := <-s.results:
+				s.spool.Add(item)
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+}
+
+// session serves one control stream until it fails, it reports whether the
+// server accepted the agent.
+func (s *Service) session(ctx context.Context, checks *sync.WaitGroup, st *streamState) (bool, error) {
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := s.stream.open(sessionCtx)
+	if err != nil {
+		return false, err
+	}
+
+	frames := make(chan agents.Frame)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			var frame agents.Frame
+			if recvErr := stream.RecvMsg(&frame); recvErr != nil {
+				failed <- recvErr
+				return
+			}
+
+			select {
+			case frames <- frame:
+			case <-sessionCtx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(frame agents.Frame) error {
+		return stream.SendMsg(&frame)
+	}
+
+	connected := false
+	// granted is the free capacity announced to the server and not used yet
+	granted := 0
+	ready := func() error {
+		free := s.free() - granted
+		// Validating agents run canary checks.
+		if free <= 0 || st.outdated || (st.status != string(agents.StatusActive) && st.status != string(agents.StatusValidating)) {
+			return nil
+		}
+
+		granted += free
+		return send(agents.Frame{Ready: &agents.StreamReady{Slots: free}}) //nolint:exhaustruct // one payload
+	}
+	// retryAt holds uploads back after the server asked to retry results
+	var retryAt time.Time
+	upload := func() error {
+		if time.Now().Before(retryAt) {
+			return nil
+		}
+
+		for s.spool.Len() > 0 && len(st.inflight) < maxInflightBatches {
+			batch := s.spool.Take(s.config.UploadBatchSize)
+			if len(batch) == 0 {
+				return nil
+			}
+
+			// Requeued when sending fails.
+			st.seq++
+			st.inflight[st.seq] = batch
+			if sendErr := send(agents.Frame{ //nolint:exhaustruct // one payload
+				Seq:     st.seq,
+				Results: &agents.SubmitResultsRequest{Results: batch},
+			}); sendErr != nil {
+				return sendErr
+			}
+		}
+
+		return nil
+	}
+
+	heartbeatFrame := agents.Frame{Heartbeat: &agents.StreamHeartbeat{Version: s.version}} //nolint:exhaustruct // one payload
+	if sendErr := send(heartbeatFrame); sendErr != nil {
+		return false, sendErr
+	}
+
+	heartbeat := time.NewTicker(st.interval)
+	defer heartbeat.Stop()
+	uploads := time.NewTicker(s.config.UploadInterval)
+	defer uploads.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return connected, nil
+		case recvErr := <-failed:
+			return connected, recvErr
+		case frame := <-frames:
+			switch {
+			case frame.Config != nil:
+				connected = true
+				s.configure(st, heartbeat, *frame.Config)
+				err = ready()
+			case frame.Work != nil:
+				granted = max(granted-len(frame.Work.Items), 0)
+				for _, item := range frame.Work.Items {
+					s.start(ctx, checks, item)
+				}
+			case frame.Ack != nil:
+				if batch, ok := st.inflight[frame.Seq]; ok {
+					delete(st.inflight, frame.Seq)
+					if s.settle(batch, *frame.Ack) {
+						retryAt = time.Now().Add(s.config.UploadInterval)
+					}
+				}
+			}
+		case item := <-s.results:
+			s.spool.Add(item)
+		case <-s.freed:
+			err = ready()
+		case <-uploads.C:
+		case <-heartbeat.C:
+			err = send(heartbeatFrame)
+		}
+
+		if err == nil {
+			err = upload()
+		}
+		if err != nil {
+			return connected, err
+		}
+	}
+}
+
+// configure applies the configuration pushed by the server.
+func (s *Service) configure(st *streamState, heartbeat *time.Ticker, config agents.StreamConfig) {
+	if config.Status != st.status {
+		s.logger.Info("agent status", zap.String("status", config.Status))
+		st.status = config.Status
+	}
+	st.upgrade = s.upgrade(st.upgrade, config.Upgrade)
+	st.outdated = config.Upgrade != nil && config.Upgrade.Required
+
+	interval := time.Duration(config.HeartbeatInterval) * time.Second
+	if interval > 0 && interval != st.interval {
+		st.interval = interval
+		heartbeat.Reset(interval)
+	}
+}
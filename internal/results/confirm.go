@@ -0,0 +1,104 @@
+package results
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/targets"
+)
+
+// targetStatus returns the effective status of the target. Targets checked
+// before statuses were tracked start from their latest result.
+func (s *Service) targetStatus(ctx context.Context, targetID gocql.UUID) (targetStatusModel, error) {
+	state, err := s.results.GetTargetStatus(ctx, targetID)
+	if !errors.Is(err, ErrNotFound) {
+		return state, err
+	}
+
+	latest, err := s.results.LatestStatus(ctx, targetID)
+	if err != nil {
+		return targetStatusModel{}, err
+	}
+
+	return targetStatusModel{
+		TargetID:        targetID,
+		Status:          string(latest),
+		ConfirmedStatus: string(latest),
+		Failures:        0,
+		UpdatedAt:       time.Time{},
+	}, nil
+}
+
+// recheckGrace is how late a recheck may report before the pending target is
+// decided by its scheduled checks again, it covers the dispatch and the
+// assignment to an agent.
+const recheckGrace = 5 * time.Minute
+
+// confirm derives the next status of the target from the result.
+//
+// A failure of a target that is not down yet is confirmed once the retry
+// policy rechecks are exhausted, until then the target is pending and the
+// returned Pending describes the next recheck. Only the rechecks decide a
+// pending target: the scheduled results leave it as is, unless its recheck is
+// overdue and presumably lost.
+func (s *Service) confirm(
+	ctx context.Context,
+	agentID gocql.UUID,
+	state targetStatusModel,
+	result checker.Result,
+	recheck bool,
+) (targetStatusModel, *Pending, error) {
+	next := targetStatusModel{
+		TargetID:        result.TargetID,
+		Status:          string(result.Status),
+		ConfirmedStatus: string(result.Status),
+		Failures:        0,
+		UpdatedAt:       result.CheckTime.UTC().Truncate(time.Millisecond),
+	}
+
+	pending := checker.Status(state.Status) == checker.StatusPending
+	if !pending && (!isDown(result.Status) || isDown(checker.Status(state.ConfirmedStatus))) {
+		return next, nil, nil
+	}
+
+	target, err := s.targets.Get(ctx, result.TargetID)
+	if errors.Is(err, targets.ErrNotFound) {
+		return next, nil, nil
+	}
+	if err != nil {
+		return targetStatusModel{}, nil, fmt.Errorf("failed to load target: %w", err)
+	}
+
+	overdue := !result.CheckTime.Before(state.UpdatedAt.Add(target.Retry.Interval + recheckGrace))
+	if pending && !recheck && !overdue {
+		return state, nil, nil
+	}
+	if !isDown(result.Status) {
+		return next, nil, nil
+	}
+
+	failures := 1
+	if pending && recheck {
+		failures = state.Failures + 1
+	}
+	if failures > target.Retry.Retries {
+		return next, nil, nil
+	}
+
+	next.Status = string(checker.StatusPending)
+	next.ConfirmedStatus = state.ConfirmedStatus
+	next.Failures = failures
+
+	return next, &Pending{
+		Status:        result.Status,
+		Attempt:       failures,
+		Retries:       target.Retry.Retries,
+		RecheckAt:     result.CheckTime.Add(target.Retry.Interval),
+		AgentID:       agentID,
+		OtherLocation: target.Retry.OtherLocation,
+	}, nil
+}
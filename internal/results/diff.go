@@ -0,0 +1,47 @@
+package results
+
+import (
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const maxDiffLines = 200
+
+// textDiff returns a line diff of the snapshots, prefixing removed lines
+// with "-" and added lines with "+". Unchanged lines are omitted.
+func textDiff(previous, current string) string {
+	dmp := diffmatchpatch.New()
+
+	// Terminate the last lines, so appending a line does not change the previous one.
+	a, b, lines := dmp.DiffLinesToChars(previous+"\n", current+"\n")
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+
+	var sb strings.Builder
+	written := 0
+	for _, d := range diffs {
+		var prefix string
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "- "
+		case diffmatchpatch.DiffInsert:
+			prefix = "+ "
+		case diffmatchpatch.DiffEqual:
+			continue
+		}
+
+		for line := range strings.Lines(d.Text) {
+			if written == maxDiffLines {
+				sb.WriteString("...\n")
+				return sb.String()
+			}
+
+			sb.WriteString(prefix)
+			sb.WriteString(strings.TrimSuffix(line, "\n"))
+			sb.WriteByte('\n')
+			written++
+		}
+	}
+
+	return sb.String()
+}
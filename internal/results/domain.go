@@ -0,0 +1,57 @@
+package results
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/incidents"
+)
+
+// ContentChange is the payload of content.changed events.
+type ContentChange struct {
+	// PreviousHash is the fingerprint of the last snapshot
+	PreviousHash string `json:"previousHash"`
+	// Hash is the fingerprint of the new content
+	Hash string `json:"hash"`
+	// Diff is a line diff between the snapshots
+	Diff string `json:"diff"`
+}
+
+// Pending is the payload of check.pending events.
+type Pending struct {
+	// Status is the unconfirmed failure
+	Status checker.Status `json:"status"`
+	// Attempt is the number of failed checks so far
+	Attempt int `json:"attempt"`
+	// Retries is the number of confirmation rechecks of the target
+	Retries int `json:"retries"`
+	// RecheckAt is when the next recheck is due
+	RecheckAt time.Time `json:"recheckAt"`
+	// AgentID is the agent that ran the failed check
+	AgentID gocql.UUID `json:"agentId"`
+	// OtherLocation requires the recheck to run from another location or agent
+	OtherLocation bool `json:"otherLocation"`
+}
+
+// IncidentData is the payload of incident events.
+type IncidentData struct {
+	IncidentID string     `json:"incidentId"`
+	Title      string     `json:"title"`
+	StartedAt  time.Time  `json:"startedAt"`
+	EndedAt    *time.Time `json:"endedAt,omitempty"`
+}
+
+func newIncidentData(i incidents.Incident) IncidentData {
+	var endedAt *time.Time
+	if !i.EndedAt.IsZero() {
+		endedAt = &i.EndedAt
+	}
+
+	return IncidentData{
+		IncidentID: i.ID.String(),
+		Title:      i.Title,
+		StartedAt:  i.StartedAt,
+		EndedAt:    endedAt,
+	}
+}
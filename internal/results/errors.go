@@ -0,0 +1,8 @@
+package results
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("target status changed concurrently")
+)
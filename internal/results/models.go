@@ -0,0 +1,231 @@
+package results
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/scylladb/gocqlx/v3/table"
+)
+
+//nolint:gochecknoglobals // table metadata
+var (
+	checkResultsTable = table.New(table.Metadata{
+		Name: "check_results",
+		Columns: []string{
+			"target_id", "bucket", "check_time", "agent_id", "status", "response_time_ms",
+			"response_code", "error_message", "ssl_expiry", "metrics", "proxy_connect_ms", "content_hash",
+			"broken_links",
+		},
+		PartKey: []string{"target_id", "bucket"},
+		SortKey: []string{"check_time", "agent_id"},
+	})
+
+	latestCheckResultsTable = table.New(table.Metadata{
+		Name: "latest_check_results",
+		Columns: []string{
+			"target_id", "agent_id", "check_time", "status", "response_time_ms", "response_code",
+		},
+		PartKey: []string{"target_id"},
+		SortKey: []string{"agent_id"},
+	})
+
+	checkResultsByFamilyTable = table.New(table.Metadata{
+		Name: "check_results_by_family",
+		Columns: []string{
+			"target_id", "bucket", "check_time", "agent_id", "ip_family", "status", "response_time_ms",
+			"response_code", "error_message",
+		},
+		PartKey: []string{"target_id", "bucket"},
+		SortKey: []string{"check_time", "agent_id", "ip_family"},
+	})
+
+	statusHistoryTable = table.New(table.Metadata{
+		Name:    "status_history",
+		Columns: []string{"target_id", "bucket", "changed_at", "old_status", "new_status", "reason", "agent_id"},
+		PartKey: []string{"target_id", "bucket"},
+		SortKey: []string{"changed_at"},
+	})
+
+	targetStatusTable = table.New(table.Metadata{
+		Name:    "target_status",
+		Columns: []string{"target_id", "status", "confirmed_status", "failures", "updated_at"},
+		PartKey: []string{"target_id"},
+		SortKey: []string{},
+	})
+
+	contentSnapshotsTable = table.New(table.Metadata{
+		Name:    "content_snapshots",
+		Columns: []string{"target_id", "hash", "snapshot", "checked_at", "changed_at"},
+		PartKey: []string{"target_id"},
+		SortKey: []string{},
+	})
+)
+
+type perfMetricUDT struct {
+	Label string   `cql:"label"`
+	Value float64  `cql:"value"`
+	Unit  string   `cql:"unit"`
+	Warn  string   `cql:"warn"`
+	Crit  string   `cql:"crit"`
+	Min   *float64 `cql:"min"`
+	Max   *float64 `cql:"max"`
+}
+
+type brokenLinkUDT struct {
+	URL    string `cql:"url"`
+	Page   string `cql:"page"`
+	Status int    `cql:"status"`
+	Error  string `cql:"error"`
+}
+
+type checkResultModel struct {
+	TargetID       gocql.UUID      `db:"target_id"`
+	Bucket         time.Time       `db:"bucket"`
+	CheckTime      time.Time       `db:"check_time"`
+	AgentID        gocql.UUID      `db:"agent_id"`
+	Status         string          `db:"status"`
+	ResponseTimeMs int             `db:"response_time_ms"`
+	ResponseCode   int             `db:"response_code"`
+	ErrorMessage   string          `db:"error_message"`
+	SSLExpiry      time.Time       `db:"ssl_expiry"`
+	Metrics        []perfMetricUDT `db:"metrics"`
+	ProxyConnectMs int             `db:"proxy_connect_ms"`
+	ContentHash    string          `db:"content_hash"`
+	BrokenLinks    []brokenLinkUDT `db:"broken_links"`
+}
+
+type familyResultModel struct {
+	TargetID       gocql.UUID `db:"target_id"`
+	Bucket         time.Time  `db:"bucket"`
+	CheckTime      time.Time  `db:"check_time"`
+	AgentID        gocql.UUID `db:"agent_id"`
+	IPFamily       string     `db:"ip_family"`
+	Status         string     `db:"status"`
+	ResponseTimeMs int        `db:"response_time_ms"`
+	ResponseCode   int        `db:"response_code"`
+	ErrorMessage   string     `db:"error_message"`
+}
+
+type statusChangeModel struct {
+	TargetID  gocql.UUID `db:"target_id"`
+	Bucket    time.Time  `db:"bucket"`
+	ChangedAt time.Time  `db:"changed_at"`
+	OldStatus string     `db:"old_status"`
+	NewStatus string     `db:"new_status"`
+	Reason    string     `db:"reason"`
+	AgentID   gocql.UUID `db:"agent_id"`
+}
+
+type targetStatusModel struct {
+	TargetID        gocql.UUID `db:"target_id"`
+	Status          string     `db:"status"`
+	ConfirmedStatus string     `db:"confirmed_status"`
+	Failures        int        `db:"failures"`
+	UpdatedAt       time.Time  `db:"updated_at"`
+}
+
+type contentSnapshotModel struct {
+	TargetID  gocql.UUID `db:"target_id"`
+	Hash      string     `db:"hash"`
+	Snapshot  string     `db:"snapshot"`
+	CheckedAt time.Time  `db:"checked_at"`
+	ChangedAt time.Time  `db:"changed_at"`
+}
+
+func newCheckResultModel(agentID gocql.UUID, r checker.Result) checkResultModel {
+	checkTime := r.CheckTime.UTC().Truncate(time.Millisecond)
+
+	var metrics []perfMetricUDT
+	if len(r.Metrics) > 0 {
+		metrics = make([]perfMetricUDT, len(r.Metrics))
+		for i, m := range r.Metrics {
+			metrics[i] = perfMetricUDT{
+				Label: m.Label,
+				Value: m.Value,
+				Unit:  m.Unit,
+				Warn:  m.Warn,
+				Crit:  m.Crit,
+				Min:   m.Min,
+				Max:   m.Max,
+			}
+		}
+	}
+
+	var brokenLinks []brokenLinkUDT
+	if len(r.BrokenLinks) > 0 {
+		brokenLinks = make([]brokenLinkUDT, len(r.BrokenLinks))
+		for i, l := range r.BrokenLinks {
+			brokenLinks[i] = brokenLinkUDT{
+				URL:    l.URL,
+				Page:   l.Page,
+				Status: l.Status,
+				Error:  l.Error,
+			}
+		}
+	}
+
+	var contentHash string
+	if r.Content != nil {
+		contentHash = r.Content.Hash
+	}
+
+	return checkResultModel{
+		TargetID:       r.TargetID,
+		Bucket:         checkTime.Truncate(24 * time.Hour),
+		CheckTime:      checkTime,
+		AgentID:        agentID,
+		Status:         string(r.Status),
+		ResponseTimeMs: int(r.ResponseTime.Milliseconds()),
+		ResponseCode:   r.ResponseCode,
+		ErrorMessage:   errorMessage(r),
+		SSLExpiry:      r.SSLExpiry,
+		Metrics:        metrics,
+		ProxyConnectMs: int(r.ProxyConnectTime.Milliseconds()),
+		ContentHash:    contentHash,
+		BrokenLinks:    brokenLinks,
+	}
+}
+
+func newFamilyResultModels(agentID gocql.UUID, r checker.Result) []familyResultModel {
+	checkTime := r.CheckTime.UTC().Truncate(time.Millisecond)
+
+	models := make([]familyResultModel, len(r.Families))
+	for i, f := range r.Families {
+		models[i] = familyResultModel{
+			TargetID:       r.TargetID,
+			Bucket:         checkTime.Truncate(24 * time.Hour),
+			CheckTime:      checkTime,
+			AgentID:        agentID,
+			IPFamily:       string(f.Family),
+			Status:         string(f.Status),
+			ResponseTimeMs: int(f.ResponseTime.Milliseconds()),
+			ResponseCode:   f.ResponseCode,
+			ErrorMessage:   errorMessage(f),
+		}
+	}
+
+	return models
+}
+
+func newStatusChangeModel(agentID gocql.UUID, previous checker.Status, r checker.Result) statusChangeModel {
+	changedAt := r.CheckTime.UTC().Truncate(time.Millisecond)
+
+	return statusChangeModel{
+		TargetID:  r.TargetID,
+		Bucket:    changedAt.Truncate(24 * time.Hour),
+		ChangedAt: changedAt,
+		OldStatus: string(previous),
+		NewStatus: string(r.Status),
+		Reason:    r.Message,
+		AgentID:   agentID,
+	}
+}
+
+// errorMessage keeps the message of failed checks only.
+func errorMessage(r checker.Result) string {
+	if r.Status == checker.StatusUp {
+		return ""
+	}
+	return r.Message
+}
@@ -0,0 +1,15 @@
+package results
+
+import (
+	"github.com/go-core-fx/logger"
+	"go.uber.org/fx"
+)
+
+func Module() fx.Option {
+	return fx.Module(
+		"results",
+		logger.WithNamedLogger("results"),
+		fx.Provide(NewRepository, fx.Private),
+		fx.Provide(fx.Annotate(NewService, fx.ParamTags("", "", "", "", "", `optional:"true"`))),
+	)
+}
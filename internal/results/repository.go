@@ -0,0 +1,194 @@
+package results
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/scylladb/gocqlx/v3"
+	"github.com/scylladb/gocqlx/v3/qb"
+)
+
+type Repository struct {
+	db gocqlx.Session
+}
+
+func NewRepository(db gocqlx.Session) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Save stores the check result and makes it the latest one of the agent for
+// the target. The effective status of the target is stored apart, see
+// SaveTargetStatus.
+func (r *Repository) Save(ctx context.Context, m checkResultModel) error {
+	if err := checkResultsTable.InsertQueryContext(ctx, r.db).BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to save check result: %w", err)
+	}
+
+	// Written at the check time, a result uploaded late never replaces a newer one.
+	err := latestCheckResultsTable.InsertBuilder().
+		TimestampNamed("write_time").
+		QueryContext(ctx, r.db).
+		BindStructMap(m, qb.M{"write_time": m.CheckTime.UnixMicro()}).
+		ExecRelease()
+	if err != nil {
+		return fmt.Errorf("failed to save latest check result: %w", err)
+	}
+
+	return nil
+}
+
+// SaveHistory stores the check result without making it the latest one.
+func (r *Repository) SaveHistory(ctx context.Context, m checkResultModel) error {
+	if err := checkResultsTable.InsertQueryContext(ctx, r.db).BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to save check result: %w", err)
+	}
+
+	return nil
+}
+
+// SaveFamilies stores the per-family results of a dual-stack check.
+func (r *Repository) SaveFamilies(ctx context.Context, models []familyResultModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+
+	// All rows share the partition of the check.
+	batch := r.db.ContextBatch(ctx, gocql.UnloggedBatch)
+	for _, m := range models {
+		if err := batch.BindStruct(checkResultsByFamilyTable.InsertQueryContext(ctx, r.db), m); err != nil {
+			return fmt.Errorf("failed to bind family result: %w", err)
+		}
+	}
+
+	if err := r.db.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("failed to save family results: %w", err)
+	}
+
+	return nil
+}
+
+// LatestStatus returns the status of the latest check of the target, empty
+// when it was never checked.
+func (r *Repository) LatestStatus(ctx context.Context, targetID gocql.UUID) (checker.Status, error) {
+	var items []checkResultModel
+	err := latestCheckResultsTable.SelectBuilder("check_time", "status").
+		QueryContext(ctx, r.db).
+		Bind(targetID).
+		SelectRelease(&items)
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest status: %w", err)
+	}
+
+	// One row per agent, the newest one wins.
+	var latest checkResultModel
+	for _, m := range items {
+		if m.CheckTime.After(latest.CheckTime) {
+			latest = m
+		}
+	}
+
+	return checker.Status(latest.Status), nil
+}
+
+// GetTargetStatus returns the effective status of the target.
+func (r *Repository) GetTargetStatus(ctx context.Context, targetID gocql.UUID) (targetStatusModel, error) {
+	var m targetStatusModel
+	err := targetStatusTable.GetQueryContext(ctx, r.db).
+		BindStruct(targetStatusModel{TargetID: targetID}). //nolint:exhaustruct // primary key only
+		GetRelease(&m)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return targetStatusModel{}, ErrNotFound
+	}
+	if err != nil {
+		return targetStatusModel{}, fmt.Errorf("failed to get target status: %w", err)
+	}
+
+	return m, nil
+}
+
+// SaveTargetStatus replaces the previous effective status of the target in a
+// lightweight transaction, it reports false when another result changed it
+// meanwhile. A previous status without UpdatedAt was never stored.
+func (r *Repository) SaveTargetStatus(ctx context.Context, previous, next targetStatusModel) (bool, error) {
+	if previous.UpdatedAt.IsZero() {
+		applied, err := targetStatusTable.InsertBuilder().
+			Unique().
+			QueryContext(ctx, r.db).
+			BindStruct(next).
+			ExecCASRelease()
+		if err != nil {
+			return false, fmt.Errorf("failed to save target status: %w", err)
+		}
+		return applied, nil
+	}
+
+	applied, err := targetStatusTable.UpdateBuilder("status", "confirmed_status", "failures", "updated_at").
+		If(
+			qb.EqNamed("status", "previous_status"),
+			qb.EqNamed("failures", "previous_failures"),
+			qb.EqNamed("updated_at", "previous_updated_at"),
+		).
+		QueryContext(ctx, r.db).
+		BindStructMap(next, qb.M{
+			"previous_status":     previous.Status,
+			"previous_failures":   previous.Failures,
+			"previous_updated_at": previous.UpdatedAt,
+		}).
+		ExecCASRelease()
+	if err != nil {
+		return false, fmt.Errorf("failed to save target status: %w", err)
+	}
+
+	return applied, nil
+}
+
+// DeleteTargetStatus removes the effective status of the target unless
+// another result changed it meanwhile.
+func (r *Repository) DeleteTargetStatus(ctx context.Context, m targetStatusModel) error {
+	_, err := targetStatusTable.DeleteBuilder().
+		If(qb.Eq("updated_at")).
+		QueryContext(ctx, r.db).
+		BindStruct(m).
+		ExecCASRelease()
+	if err != nil {
+		return fmt.Errorf("failed to delete target status: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) SaveStatusChange(ctx context.Context, m statusChangeModel) error {
+	if err := statusHistoryTable.InsertQueryContext(ctx, r.db).BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to save status change: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetSnapshot(ctx context.Context, targetID gocql.UUID) (contentSnapshotModel, error) {
+	var m contentSnapshotModel
+	err := contentSnapshotsTable.GetQueryContext(ctx, r.db).
+		BindStruct(contentSnapshotModel{TargetID: targetID}). //nolint:exhaustruct // primary key only
+		GetRelease(&m)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return contentSnapshotModel{}, ErrNotFound
+	}
+	if err != nil {
+		return contentSnapshotModel{}, fmt.Errorf("failed to get content snapshot: %w", err)
+	}
+
+	return m, nil
+}
+
+func (r *Repository) SaveSnapshot(ctx context.Context, m contentSnapshotModel) error {
+	if err := contentSnapshotsTable.InsertQueryContext(ctx, r.db).BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to save content snapshot: %w", err)
+	}
+
+	return nil
+}
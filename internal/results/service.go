@@ -0,0 +1,356 @@
+package results
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/events"
+	"github.com/pingplex/pingplex/internal/incidents"
+	"github.com/pingplex/pingplex/internal/targets"
+	"go.uber.org/zap"
+)
+
+const (
+	// backfillAfter is how much older than the last recorded result a result
+	// is late, so results of concurrent checks still count.
+	backfillAfter = time.Minute
+	// maxDiagnoses is the number of failure diagnostics collected at once by the server
+	maxDiagnoses = 8
+	// maxStatusAttempts is how often the status is derived again when
+	// concurrent results changed it
+	maxStatusAttempts = 3
+)
+
+// LocalAgentID identifies checks run by the server itself.
+//
+//nolint:gochecknoglobals // zero UUID
+var LocalAgentID = gocql.UUID{}
+
+// RemoteDiagnoser collects failure diagnostics on the agent that observed
+// the failure, the agent reports them back later.
+type RemoteDiagnoser interface {
+	Diagnose(ctx context.Context, agentID, incidentID gocql.UUID, target checker.Target, checkTime time.Time) error
+}
+
+// Service records check results and derives status changes, incidents and
+// events from them.
+type Service struct {
+	results   *Repository
+	events    *events.Service
+	incidents *incidents.Service
+	targets   *targets.Service
+	checks    *checker.Service
+	remote    RemoteDiagnoser
+	diagnoses chan struct{}
+
+	logger *zap.Logger
+}
+
+func NewService(
+	results *Repository,
+	events *events.Service,
+	incidents *incidents.Service,
+	targets *targets.Service,
+	checks *checker.Service,
+	remote RemoteDiagnoser,
+	logger *zap.Logger,
+) *Service {
+	return &Service{
+		results:   results,
+		events:    events,
+		incidents: incidents,
+		targets:   targets,
+		checks:    checks,
+		remote:    remote,
+		diagnoses: make(chan struct{}, maxDiagnoses),
+
+		logger: logger,
+	}
+}
+
+// Record stores the result of a check run by the agent, recheck tells the
+// confirmation rechecks of pending failures from the other runs.
+//
+// Failures are confirmed according to the target retry policy, the target is
+// pending meanwhile. A confirmed change to down opens an incident and requests
+// failure diagnostics from where the failure was observed, a recovery
+// resolves it.
+//
+// Results checked well before the last recorded one, uploaded late by an
+// agent, only backfill the history. The status is replaced in a lightweight
+// transaction, concurrent results are derived one after the other.
+func (s *Service) Record(ctx context.Context, agentID gocql.UUID, result checker.Result, recheck bool) error {
+	state, err := s.targetStatus(ctx, result.TargetID)
+	if err != nil {
+		return err
+	}
+
+	if isLate(state, result) {
+		return s.backfill(ctx, agentID, result)
+	}
+
+	if saveErr := s.results.Save(ctx, newCheckResultModel(agentID, result)); saveErr != nil {
+		return saveErr
+	}
+	if famErr := s.results.SaveFamilies(ctx, newFamilyResultModels(agentID, result)); famErr != nil {
+		return famErr
+	}
+
+	next, pending, err := s.confirm(ctx, agentID, state, result, recheck)
+	for attempt := 1; err == nil && next != state; attempt++ {
+		applied, saveErr := s.results.SaveTargetStatus(ctx, state, next)
+		if saveErr != nil || applied {
+			err = saveErr
+			break
+		}
+		if attempt == maxStatusAttempts {
+			return ErrConflict
+		}
+
+		state, err = s.targetStatus(ctx, result.TargetID)
+		if err != nil {
+			return err
+		}
+		if isLate(state, result) {
+			// Newer results decided the status meanwhile.
+			return nil
+		}
+		next, pending, err = s.confirm(ctx, agentID, state, result, recheck)
+	}
+	if err != nil {
+		return err
+	}
+
+	if transErr := s.transition(ctx, agentID, state, next, result); transErr != nil {
+		s.restore(ctx, state, next)
+		return transErr
+	}
+
+	if pending != nil {
+		event := events.New(events.TypeCheckPending, result.TargetID, result.CheckTime, *pending)
+		if pubErr := s.events.Publish(ctx, event); pubErr != nil {
+			s.logger.Warn("failed to publish event", zap.Error(pubErr))
+		}
+	}
+
+	if result.Content != nil {
+		return s.detectContentChange(ctx, result)
+	}
+
+	return nil
+}
+
+// restore puts the previous status back after a failed transition, so the
+// retry of the result derives the transition again.
+func (s *Service) restore(ctx context.Context, state, next targetStatusModel) {
+	ctx = context.WithoutCancel(ctx)
+
+	var err error
+	if state.UpdatedAt.IsZero() {
+		err = s.results.DeleteTargetStatus(ctx, next)
+	} else {
+		_, err = s.results.SaveTargetStatus(ctx, next, state)
+	}
+	if err != nil {
+		s.logger.Warn("failed to restore target status", zap.Stringer("target_id", next.TargetID), zap.Error(err))
+	}
+}
+
+// isLate tells a result checked well before the last recorded one.
+func isLate(state targetStatusModel, result checker.Result) bool {
+	return result.CheckTime.Before(state.UpdatedAt.Add(-backfillAfter))
+}
+
+// backfill stores a late result without deriving the target status from it.
+func (s *Service) backfill(ctx context.Context, agentID gocql.UUID, result checker.Result) error {
+	if err := s.results.SaveHistory(ctx, newCheckResultModel(agentID, result)); err != nil {
+		return err
+	}
+	if err := s.results.SaveFamilies(ctx, newFamilyResultModels(agentID, result)); err != nil {
+		return err
+	}
+
+	s.logger.Debug(
+		"late check result backfilled",
+		zap.Stringer("target_id", result.TargetID),
+		zap.Stringer("agent_id", agentID),
+		zap.Time("check_time", result.CheckTime),
+	)
+
+	return nil
+}
+
+// transition records a change of the confirmed status and opens or resolves
+// the incident of the target.
+func (s *Service) transition(
+	ctx context.Context,
+	agentID gocql.UUID,
+	state, next targetStatusModel,
+	result checker.Result,
+) error {
+	previous := checker.Status(state.ConfirmedStatus)
+	confirmed := checker.Status(next.ConfirmedStatus)
+	if previous == confirmed {
+		return nil
+	}
+
+	if histErr := s.results.SaveStatusChange(ctx, newStatusChangeModel(agentID, previous, result)); histErr != nil {
+		return histErr
+	}
+
+	switch {
+	case isDown(confirmed) && !isDown(previous):
+		return s.openIncident(ctx, agentID, result)
+	case !isDown(confirmed) && isDown(previous):
+		return s.resolveIncident(ctx, result)
+	}
+
+	return nil
+}
+
+// openIncident opens an incident for the failed target and requests the
+// failure diagnostics.
+func (s *Service) openIncident(ctx context.Context, agentID gocql.UUID, result checker.Result) error {
+	target, err := s.targets.CheckTarget(ctx, result.TargetID)
+	if err != nil {
+		return fmt.Errorf("failed to load target: %w", err)
+	}
+
+	title := fmt.Sprintf("%s is %s", target.Name, result.Status)
+	incident, opened, err := s.incidents.Open(ctx, result.TargetID, result.CheckTime, title, result.Message)
+	if err != nil || !opened {
+		return err
+	}
+
+	event := events.New(events.TypeIncidentOpened, result.TargetID, incident.StartedAt, newIncidentData(incident))
+	if pubErr := s.events.Publish(ctx, event); pubErr != nil {
+		s.logger.Warn("failed to publish event", zap.Error(pubErr))
+	}
+
+	s.diagnose(ctx, agentID, incident.ID, target.CheckTarget(), result.CheckTime)
+
+	return nil
+}
+
+// diagnose collects the failure diagnostics in the background, on the
+// server for its own checks and on the observing agent otherwise. They are
+// skipped when the agent is unreachable, the server does not see the target
+// from the agent's network.
+func (s *Service) diagnose(
+	ctx context.Context,
+	agentID, incidentID gocql.UUID,
+	target checker.Target,
+	checkTime time.Time,
+) {
+	if agentID != LocalAgentID {
+		if s.remote == nil {
+			return
+		}
+		if err := s.remote.Diagnose(ctx, agentID, incidentID, target, checkTime); err != nil {
+			s.logger.Info(
+				"failure diagnostics skipped",
+				zap.Stringer("target_id", target.ID),
+				zap.Stringer("agent_id", agentID),
+				zap.Error(err),
+			)
+		}
+		return
+	}
+
+	select {
+	case s.diagnoses <- struct{}{}:
+	default:
+		s.logger.Warn("too many failure diagnostics running, skipped", zap.Stringer("target_id", target.ID))
+		return
+	}
+
+	// The result is recorded already, the diagnostics do not hold it up.
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() { <-s.diagnoses }()
+
+		diag := s.checks.Diagnose(ctx, target)
+		if err := s.AttachDiagnostics(ctx, agentID, incidentID, target.ID, checkTime, diag); err != nil {
+			s.logger.Error("failed to store failure diagnostics", zap.Stringer("target_id", target.ID), zap.Error(err))
+		}
+	}()
+}
+
+// AttachDiagnostics stores the diagnostics the agent collected for the failed
+// check with its incident.
+func (s *Service) AttachDiagnostics(
+	ctx context.Context,
+	agentID, incidentID, targetID gocql.UUID,
+	checkTime time.Time,
+	diag checker.Diagnostics,
+) error {
+	return s.incidents.AttachDiagnostics(ctx, incidents.Diagnostics{
+		IncidentID:  incidentID,
+		TargetID:    targetID,
+		CheckTime:   checkTime,
+		AgentID:     agentID,
+		Diagnostics: diag.Redacted(),
+	})
+}
+
+func (s *Service) resolveIncident(ctx context.Context, result checker.Result) error {
+	incident, err := s.incidents.Resolve(ctx, result.TargetID, result.CheckTime)
+	if errors.Is(err, incidents.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	event := events.New(events.TypeIncidentResolved, result.TargetID, incident.EndedAt, newIncidentData(incident))
+
+	return s.events.Publish(ctx, event)
+}
+
+// detectContentChange compares the content with the last snapshot and emits
+// a content.changed event when it differs. The first snapshot is a baseline.
+func (s *Service) detectContentChange(ctx context.Context, result checker.Result) error {
+	previous, err := s.results.GetSnapshot(ctx, result.TargetID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	checkedAt := result.CheckTime.UTC().Truncate(time.Millisecond)
+	snapshot := contentSnapshotModel{
+		TargetID:  result.TargetID,
+		Hash:      result.Content.Hash,
+		Snapshot:  result.Content.Snapshot,
+		CheckedAt: checkedAt,
+		ChangedAt: previous.ChangedAt,
+	}
+
+	changed := previous.Hash != "" && previous.Hash != snapshot.Hash
+	if previous.Hash != snapshot.Hash {
+		snapshot.ChangedAt = checkedAt
+	}
+
+	if saveErr := s.results.SaveSnapshot(ctx, snapshot); saveErr != nil {
+		return saveErr
+	}
+
+	if !changed {
+		return nil
+	}
+
+	event := events.New(events.TypeContentChanged, result.TargetID, checkedAt, ContentChange{
+		PreviousHash: previous.Hash,
+		Hash:         snapshot.Hash,
+		Diff:         textDiff(previous.Snapshot, snapshot.Snapshot),
+	})
+
+	return s.events.Publish(ctx, event)
+}
+
+// isDown reports whether the status counts as an outage.
+func isDown(status checker.Status) bool {
+	return status == checker.StatusDown || status == checker.StatusTimeout
+}
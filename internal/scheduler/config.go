@@ -0,0 +1,17 @@
+package scheduler
+
+import "time"
+
+// Config holds the configuration for the scheduler module.
+type Config struct {
+	// Workers is the number of checks run concurrently
+	Workers int
+	// QueueSize limits the checks waiting for a worker, overflowing checks are skipped
+	QueueSize int
+	// ResyncInterval is how often the schedule is reconciled with the stored targets
+	ResyncInterval time.Duration
+	// Shards is the number of target shards split between replicas, it must be the same on all replicas
+	Shards int
+	// LeaseTTL is how long a shard stays owned by a replica that stopped renewing it
+	LeaseTTL time.Duration
+}
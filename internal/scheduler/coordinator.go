@@ -0,0 +1,418 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/events"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultShards   = 64
+	defaultLeaseTTL = 10 * time.Second
+
+	// maxDueRechecks is the number of due rechecks taken at once
+	maxDueRechecks = 100
+
+	keyPrefix   = "pingplex:scheduler:"
+	replicasKey = keyPrefix + "replicas"
+	rechecksKey = keyPrefix + "rechecks"
+)
+
+//nolint:gochecknoglobals // scripts are loaded once per connection
+var (
+	// renewScript extends the lease when it is still held by the replica.
+	renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// releaseScript deletes the lease when it is still held by the replica.
+	releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+// Coordinator splits the targets between scheduler replicas.
+//
+// Targets are hashed into shards, each replica holds leases on an equal share
+// of the shards and renews them every third of the lease TTL. The shards of a
+// dead replica become free when its leases expire and are claimed by the
+// others. Without Redis the replica owns every shard.
+//
+// Pending rechecks are kept in Redis too, so they run on the replica owning
+// the target when they are due, even when the replica that scheduled them is
+// gone. Without Redis they are kept in memory.
+type Coordinator struct {
+	config    Config
+	redis     *redis.Client
+	replicaID string
+
+	mu     sync.RWMutex
+	leases map[int]time.Time
+
+	rechecksMu sync.Mutex
+	rechecks   []recheck
+
+	logger *zap.Logger
+}
+
+// recheck is a confirmation check waiting for its time.
+type recheck struct {
+	TargetID      gocql.UUID    `json:"targetId"`
+	ScheduledAt   time.Time     `json:"scheduledAt"`
+	Interval      time.Duration `json:"interval"`
+	ExcludeAgents []gocql.UUID  `json:"excludeAgents,omitempty"`
+}
+
+func newRecheck(job Job) recheck {
+	return recheck{
+		TargetID:      job.TargetID,
+		ScheduledAt:   job.ScheduledAt.UTC(),
+		Interval:      job.Interval,
+		ExcludeAgents: job.ExcludeAgents,
+	}
+}
+
+// job returns the recheck job, the target type is filled in on dispatch.
+func (r recheck) job() Job {
+	return Job{
+		TargetID:      r.TargetID,
+		Type:          "",
+		Kind:          KindRecheck,
+		ScheduledAt:   r.ScheduledAt,
+		Interval:      r.Interval,
+		Location:      "",
+		ExcludeAgents: r.ExcludeAgents,
+		Behind:        false,
+		Done:          nil,
+	}
+}
+
+func NewCoordinator(config Config, redis *redis.Client, logger *zap.Logger) *Coordinator {
+	if config.Shards <= 0 {
+		config.Shards = defaultShards
+	}
+	if config.LeaseTTL <= 0 {
+		config.LeaseTTL = defaultLeaseTTL
+	}
+
+	return &Coordinator{
+		config:    config,
+		redis:     redis,
+		replicaID: gocql.MustRandomUUID().String(),
+
+		mu:     sync.RWMutex{},
+		leases: map[int]time.Time{},
+
+		rechecksMu: sync.Mutex{},
+		rechecks:   nil,
+
+		logger: logger,
+	}
+}
+
+// Owns reports whether the replica holds a valid lease on the target shard.
+func (c *Coordinator) Owns(targetID gocql.UUID) bool {
+	if c.redis == nil {
+		return true
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	expiresAt, ok := c.leases[c.shard(targetID)]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// Claim filters out the jobs already run by another replica, which may
+// happen right after a shard changes hands. The claims expire after the
+// check interval, or the lease TTL when that is longer.
+func (c *Coordinator) Claim(ctx context.Context, jobs []Job) []Job {
+	if c.redis == nil || len(jobs) == 0 {
+		return jobs
+	}
+
+	cmds := make([]*redis.BoolCmd, len(jobs))
+	_, err := c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, job := range jobs {
+			key := keyPrefix + "run:" + job.TargetID.String() + ":" + job.Location + ":" +
+				strconv.FormatInt(job.ScheduledAt.UnixMilli(), 10)
+			cmds[i] = pipe.SetNX(ctx, key, c.replicaID, max(job.Interval, c.config.LeaseTTL))
+		}
+		return nil
+	})
+	if err != nil {
+		// The shard leases are still valid, so the jobs are ours to run.
+		c.logger.Warn("failed to claim checks", zap.Error(err))
+		return jobs
+	}
+
+	claimed := jobs[:0]
+	for i, job := range jobs {
+		if cmds[i].Val() {
+			claimed = append(claimed, job)
+		}
+	}
+
+	return claimed
+}
+
+// Defer stores the recheck until its scheduled time.
+func (c *Coordinator) Defer(ctx context.Context, job Job) error {
+	r := newRecheck(job)
+
+	if c.redis == nil {
+		c.rechecksMu.Lock()
+		defer c.rechecksMu.Unlock()
+
+		c.rechecks = append(c.rechecks, r)
+		return nil
+	}
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode recheck: %w", err)
+	}
+
+	z := redis.Z{Score: float64(r.ScheduledAt.UnixMilli()), Member: payload}
+	if addErr := c.redis.ZAdd(ctx, rechecksKey, z).Err(); addErr != nil {
+		return fmt.Errorf("failed to store recheck: %w", addErr)
+	}
+
+	return nil
+}
+
+// Due takes the rechecks of the owned targets that are due by now. Each
+// recheck is taken by a single replica.
+func (c *Coordinator) Due(ctx context.Context, now time.Time) ([]Job, error) {
+	if c.redis == nil {
+		c.rechecksMu.Lock()
+		defer c.rechecksMu.Unlock()
+
+		var due []Job
+		c.rechecks = slices.DeleteFunc(c.rechecks, func(r recheck) bool {
+			if r.ScheduledAt.After(now) {
+				return false
+			}
+			due = append(due, r.job())
+			return true
+		})
+		return due, nil
+	}
+
+	items, err := c.redis.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     rechecksKey,
+		Start:   "-inf",
+		Stop:    strconv.FormatInt(now.UnixMilli(), 10),
+		ByScore: true,
+		ByLex:   false,
+		Rev:     false,
+		Offset:  0,
+		Count:   maxDueRechecks,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rechecks: %w", err)
+	}
+
+	var due []Job
+	for _, payload := range items {
+		var r recheck
+		if jsonErr := json.Unmarshal([]byte(payload), &r); jsonErr != nil {
+			c.logger.Warn("failed to decode recheck", zap.Error(jsonErr))
+			_ = c.redis.ZRem(ctx, rechecksKey, payload).Err()
+			continue
+		}
+		if !c.Owns(r.TargetID) {
+			continue
+		}
+
+		// Removing it claims it.
+		removed, remErr := c.redis.ZRem(ctx, rechecksKey, payload).Result()
+		if remErr != nil {
+			return due, fmt.Errorf("failed to take recheck: %w", remErr)
+		}
+		if removed > 0 {
+			due = append(due, r.job())
+		}
+	}
+
+	return due, nil
+}
+
+// Run maintains the shard leases until the context is canceled, then
+// releases them so other replicas take over immediately.
+func (c *Coordinator) Run(ctx context.Context) {
+	if c.redis == nil {
+		return
+	}
+
+	ticker := time.NewTicker(c.config.LeaseTTL / 3) //nolint:mnd // renew three times per lease
+	defer ticker.Stop()
+
+	for {
+		if err := c.heartbeat(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Error("scheduler heartbeat failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			c.release(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Listen passes the events published by any replica to the handler until the
+// context is canceled.
+func (c *Coordinator) Listen(ctx context.Context, handler events.Handler) {
+	if c.redis == nil {
+		return
+	}
+
+	sub := c.redis.Subscribe(ctx, events.Channel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			var event events.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				c.logger.Warn("failed to decode event", zap.Error(err))
+				continue
+			}
+			handler(event)
+		}
+	}
+}
+
+// heartbeat registers the replica, renews its leases and balances the shards
+// between the live replicas.
+func (c *Coordinator) heartbeat(ctx context.Context) error {
+	now := time.Now()
+	ttl := c.config.LeaseTTL
+
+	replicas, err := c.register(ctx, now)
+	if err != nil {
+		return err
+	}
+	fair := (c.config.Shards + replicas - 1) / replicas
+
+	leases := make(map[int]time.Time, fair)
+	for shard := range c.owned() {
+		renewed, renewErr := renewScript.Run(ctx, c.redis, []string{shardKey(shard)}, c.replicaID, ttl.Milliseconds()).Int()
+		if renewErr != nil {
+			return fmt.Errorf("failed to renew lease: %w", renewErr)
+		}
+		if renewed == 1 {
+			leases[shard] = now.Add(ttl)
+		}
+	}
+
+	// Shards are probed from a replica specific offset, so replicas starting
+	// together do not compete for the same ones.
+	start := int(crc32.ChecksumIEEE([]byte(c.replicaID)) % uint32(c.config.Shards)) //nolint:gosec // shards is positive
+	for i := 0; i < c.config.Shards && len(leases) < fair; i++ {
+		shard := (start + i) % c.config.Shards
+		if _, ok := leases[shard]; ok {
+			continue
+		}
+
+		acquired, setErr := c.redis.SetNX(ctx, shardKey(shard), c.replicaID, ttl).Result()
+		if setErr != nil {
+			return fmt.Errorf("failed to acquire lease: %w", setErr)
+		}
+		if acquired {
+			leases[shard] = now.Add(ttl)
+		}
+	}
+
+	// Hand the surplus over to replicas that joined since.
+	for shard := range leases {
+		if len(leases) <= fair {
+			break
+		}
+		if relErr := releaseScript.Run(ctx, c.redis, []string{shardKey(shard)}, c.replicaID).Err(); relErr != nil {
+			return fmt.Errorf("failed to release lease: %w", relErr)
+		}
+		delete(leases, shard)
+	}
+
+	c.setLeases(leases)
+
+	return nil
+}
+
+// register refreshes the replica membership and returns the number of live replicas.
+func (c *Coordinator) register(ctx context.Context, now time.Time) (int, error) {
+	var card *redis.IntCmd
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, replicasKey, redis.Z{Score: float64(now.Add(c.config.LeaseTTL).UnixMilli()), Member: c.replicaID})
+		pipe.ZRemRangeByScore(ctx, replicasKey, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		card = pipe.ZCard(ctx, replicasKey)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to register replica: %w", err)
+	}
+
+	return max(int(card.Val()), 1), nil
+}
+
+func (c *Coordinator) release(ctx context.Context) {
+	for shard := range c.owned() {
+		if err := releaseScript.Run(ctx, c.redis, []string{shardKey(shard)}, c.replicaID).Err(); err != nil {
+			c.logger.Warn("failed to release lease", zap.Int("shard", shard), zap.Error(err))
+		}
+	}
+	if err := c.redis.ZRem(ctx, replicasKey, c.replicaID).Err(); err != nil {
+		c.logger.Warn("failed to unregister replica", zap.Error(err))
+	}
+
+	c.setLeases(map[int]time.Time{})
+}
+
+func (c *Coordinator) owned() map[int]time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.leases
+}
+
+func (c *Coordinator) setLeases(leases map[int]time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(leases) != len(c.leases) {
+		c.logger.Info("scheduler shards changed", zap.Int("owned", len(leases)), zap.Int("shards", c.config.Shards))
+	}
+	c.leases = leases
+}
+
+func (c *Coordinator) shard(targetID gocql.UUID) int {
+	return int(crc32.ChecksumIEEE(targetID.Bytes()) % uint32(c.config.Shards)) //nolint:gosec // shards is positive
+}
+
+func shardKey(shard int) string {
+	return keyPrefix + "shard:" + strconv.Itoa(shard)
+}
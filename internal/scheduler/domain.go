@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+)
+
+// JobKind tells why a check runs.
+type JobKind string
+
+const (
+	// KindScheduled is a run of the target schedule
+	KindScheduled JobKind = "scheduled"
+	// KindRecheck confirms a failure
+	KindRecheck JobKind = "recheck"
+	// KindManual is requested through the API and runs even for disabled targets
+	KindManual JobKind = "manual"
+	// KindCanary verifies an agent against the others, only agents run it and
+	// its result is not recorded
+	KindCanary JobKind = "canary"
+	// KindDiagnostics collects the diagnostics of a failure on the agent that
+	// observed it, only agents run it
+	KindDiagnostics JobKind = "diagnostics"
+)
+
+// Job is a check due for execution.
+type Job struct {
+	TargetID gocql.UUID
+	// Type is the target type, agents only run the types they support
+	Type        checker.Type
+	Kind        JobKind
+	ScheduledAt time.Time
+	Interval    time.Duration
+	// Location is where the check runs from, empty for any location
+	Location string
+	// ExcludeAgents lists the agents the job should not run on
+	ExcludeAgents []gocql.UUID
+	// Behind marks a run dispatched after the scheduler fell behind, the runs
+	// missed since are recorded already
+	Behind bool
+	// Done, when set, receives the outcome of the job
+	Done func(Report)
+}
+
+// Report is the outcome of a job.
+type Report struct {
+	Location string
+	Result   checker.Result
+	// Err is set when the check could not run or its result was not recorded
+	Err error
+}
+
+// Dispatcher executes the scheduled jobs.
+type Dispatcher interface {
+	// Dispatch queues the job without blocking and reports whether it was accepted.
+	Dispatch(job Job) bool
+}
+
+// RemoteDispatcher hands jobs to remote agents.
+type RemoteDispatcher interface {
+	// Dispatch queues the job for an agent without blocking. It returns false
+	// when no agent can run the job, which then runs locally.
+	Dispatch(job Job) bool
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+import "time"
+
+// CheckReportResponse is the result of an on-demand check from one location.
+type CheckReportResponse struct {
+	// Location the check ran from, empty for the server itself
+	Location string `json:"location"`
+	// Check outcome, empty when the check did not run
+	Status         string     `json:"status,omitempty"`
+	CheckTime      *time.Time `json:"checkTime,omitempty"`
+	ResponseTimeMs int64      `json:"responseTimeMs"`
+	ResponseCode   int        `json:"responseCode,omitempty"`
+	Message        string     `json:"message,omitempty"`
+	// Reason the check did not run or was not recorded
+	Error string `json:"error,omitempty"`
+}
+
+func newCheckReportResponse(r Report) CheckReportResponse {
+	var errMessage string
+	if r.Err != nil {
+		errMessage = r.Err.Error()
+	}
+
+	var checkTime *time.Time
+	if !r.Result.CheckTime.IsZero() {
+		checkTime = &r.Result.CheckTime
+	}
+
+	return CheckReportResponse{
+		Location:       r.Location,
+		Status:         string(r.Result.Status),
+		CheckTime:      checkTime,
+		ResponseTimeMs: r.Result.ResponseTime.Milliseconds(),
+		ResponseCode:   r.Result.ResponseCode,
+		Message:        r.Result.Message,
+		Error:          errMessage,
+	}
+}
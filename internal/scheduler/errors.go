@@ -0,0 +1,9 @@
+package scheduler
+
+import "errors"
+
+var (
+	ErrDisabled  = errors.New("target is disabled")
+	ErrQueueFull = errors.New("check queue is full")
+	ErrNoAgent   = errors.New("no agent serves the location")
+)
@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-core-fx/fiberfx/handler"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pingplex/pingplex/internal/targets"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// checkNowTimeout limits how long on-demand check results are streamed.
+const checkNowTimeout = 5 * time.Minute
+
+type Handler struct {
+	scheduler *Service
+
+	logger *zap.Logger
+}
+
+func NewHandler(scheduler *Service, logger *zap.Logger) handler.Handler {
+	return &Handler{
+		scheduler: scheduler,
+
+		logger: logger,
+	}
+}
+
+func (h *Handler) Register(router fiber.Router) {
+	router.Post("/targets/:id/check", h.check)
+}
+
+//	@Summary		Check target now
+//	@Description	Checks the target from all of its locations and streams the results as server-sent events: a "result" event per location, then "done", or "timeout" when locations did not report in time
+//	@Tags			Targets
+//	@Produce		text/event-stream
+//	@Param			id	path		string	true	"Target ID"
+//	@Success		200	{object}	CheckReportResponse
+//	@Failure		404	{object}	fiberfx.ErrorResponse
+//	@Router			/targets/{id}/check [post]
+//
+// Check target now.
+func (h *Handler) check(c *fiber.Ctx) error {
+	id, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid target id")
+	}
+
+	reports, err := h.scheduler.CheckNow(c.Context(), id)
+	if errors.Is(err, targets.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), checkNowTimeout)
+		defer cancel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				_ = writeEvent(w, "timeout", struct{}{})
+				return
+			case report, ok := <-reports:
+				if !ok {
+					_ = writeEvent(w, "done", struct{}{})
+					return
+				}
+				if writeErr := writeEvent(w, "result", newCheckReportResponse(report)); writeErr != nil {
+					// The client went away, the results are recorded regardless.
+					h.logger.Debug("failed to stream check result", zap.Error(writeErr))
+					return
+				}
+			}
+		}
+	}))
+
+	return nil
+}
+
+// writeEvent writes a server-sent event and flushes it to the client.
+func writeEvent(w *bufio.Writer, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	if _, writeErr := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); writeErr != nil {
+		return fmt.Errorf("failed to write event: %w", writeErr)
+	}
+
+	if flushErr := w.Flush(); flushErr != nil {
+		return fmt.Errorf("failed to flush event: %w", flushErr)
+	}
+
+	return nil
+}
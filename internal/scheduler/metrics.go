@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// MissReason tells why a scheduled check did not run on time.
+type MissReason string
+
+const (
+	// MissQueueFull is a check dropped because no worker was free
+	MissQueueFull MissReason = "queue_full"
+	// MissBehind is a run skipped because the scheduler fell behind
+	MissBehind MissReason = "behind"
+	// MissLate is a check started after its next run was due
+	MissLate MissReason = "late"
+	// MissExpired is a check handed to an agent that expired before it ran or reported
+	MissExpired MissReason = "expired"
+	// MissNoAgent is a check of a location no agent could take
+	MissNoAgent MissReason = "no_agent"
+)
+
+// Metrics exports the scheduler timing.
+type Metrics struct {
+	lag    *prometheus.HistogramVec
+	missed *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		lag: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "pingplex",
+			Subsystem: "scheduler",
+			Name:      "lag_seconds",
+			Help:      "Delay between the planned and the actual start of scheduled checks",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30, 60, 300},
+		}, []string{"location"}),
+		missed: promauto.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "pingplex",
+			Subsystem: "scheduler",
+			Name:      "missed_checks_total",
+			Help:      "Scheduled checks that did not run on time",
+		}, []string{"location", "reason"}),
+	}
+}
+
+// ObserveLag records the start delay of a scheduled check.
+func (m *Metrics) ObserveLag(location string, lag time.Duration) {
+	m.lag.WithLabelValues(locationLabel(location)).Observe(lag.Seconds())
+}
+
+// AddMissed counts scheduled checks that did not run on time.
+func (m *Metrics) AddMissed(location string, reason MissReason, runs int) {
+	m.missed.WithLabelValues(locationLabel(location), string(reason)).Add(float64(runs))
+}
+
+func locationLabel(location string) string {
+	if location == "" {
+		return "any"
+	}
+	return location
+}
@@ -0,0 +1,25 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v3/table"
+)
+
+//nolint:gochecknoglobals // table metadata
+var checkGapsTable = table.New(table.Metadata{
+	Name:    "check_gaps",
+	Columns: []string{"target_id", "started_at", "location", "ended_at", "reason", "missed_runs"},
+	PartKey: []string{"target_id"},
+	SortKey: []string{"started_at", "location"},
+})
+
+type checkGapModel struct {
+	TargetID   gocql.UUID `db:"target_id"`
+	StartedAt  time.Time  `db:"started_at"`
+	Location   string     `db:"location"`
+	EndedAt    time.Time  `db:"ended_at"`
+	Reason     string     `db:"reason"`
+	MissedRuns int        `db:"missed_runs"`
+}
@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-core-fx/logger"
+	"go.uber.org/fx"
+)
+
+func Module() fx.Option {
+	return fx.Module(
+		"scheduler",
+		logger.WithNamedLogger("scheduler"),
+		fx.Provide(NewMetrics, fx.Private),
+		fx.Provide(NewRepository, fx.Private),
+		fx.Provide(NewTracker),
+		fx.Provide(NewRunner, fx.Private),
+		fx.Provide(
+			fx.Annotate(NewRouter, fx.ParamTags("", `optional:"true"`, ""), fx.As(new(Dispatcher))), fx.Private,
+		),
+		fx.Provide(
+			fx.Annotate(NewCoordinator, fx.ParamTags("", `optional:"true"`)), fx.Private,
+		),
+		fx.Provide(NewService),
+		fx.Invoke(func(lc fx.Lifecycle, runner *Runner, coordinator *Coordinator, tracker *Tracker, svc *Service) {
+			ctx, cancel := context.WithCancel(context.Background())
+			var wg sync.WaitGroup
+
+			lc.Append(fx.Hook{
+				OnStart: func(_ context.Context) error {
+					wg.Go(func() { runner.Run(ctx) })
+					wg.Go(func() { coordinator.Run(ctx) })
+					wg.Go(func() { tracker.Run(ctx) })
+					wg.Go(func() { svc.Run(ctx) })
+					return nil
+				},
+				OnStop: func(_ context.Context) error {
+					cancel()
+					wg.Wait()
+					return nil
+				},
+			})
+		}),
+	)
+}
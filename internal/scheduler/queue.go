@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"container/heap"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/targets"
+)
+
+// planned is the schedule of a target with the settings of its jobs.
+type planned struct {
+	schedule  targets.Schedule
+	checkType checker.Type
+	locations []string
+}
+
+func newPlanned(t targets.Target, schedule targets.Schedule) *planned {
+	locations := slices.Clone(t.Locations)
+	slices.Sort(locations)
+
+	return &planned{
+		schedule:  schedule,
+		checkType: t.Type,
+		locations: locations,
+	}
+}
+
+// key identifies the plan, entries are rebuilt when it changes.
+func (p *planned) key() string {
+	return p.schedule.Key() + "|" + string(p.checkType) + "|" + strings.Join(p.locations, ",")
+}
+
+// entry is a scheduled target.
+type entry struct {
+	targetID gocql.UUID
+	*planned
+	next  time.Time
+	index int
+}
+
+func newEntry(targetID gocql.UUID, p *planned, now time.Time) *entry {
+	return &entry{
+		targetID: targetID,
+		planned:  p,
+		next:     p.schedule.Next(now),
+		index:    -1,
+	}
+}
+
+// jobs returns the jobs of the run, one per location of the target or a
+// single one for any location.
+func (e *entry) jobs(scheduledAt, next time.Time, behind bool) []Job {
+	locations := e.locations
+	if len(locations) == 0 {
+		locations = []string{""}
+	}
+
+	jobs := make([]Job, len(locations))
+	for i, location := range locations {
+		jobs[i] = Job{
+			TargetID:      e.targetID,
+			Type:          e.checkType,
+			Kind:          KindScheduled,
+			ScheduledAt:   scheduledAt,
+			Interval:      next.Sub(scheduledAt),
+			Location:      location,
+			ExcludeAgents: nil,
+			Behind:        behind,
+			Done:          nil,
+		}
+	}
+
+	return jobs
+}
+
+// queue is a min-heap of entries ordered by their next run.
+type queue []*entry
+
+var _ heap.Interface = (*queue)(nil)
+
+func (q queue) Len() int {
+	return len(q)
+}
+
+func (q queue) Less(i, j int) bool {
+	return q[i].next.Before(q[j].next)
+}
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queue) Push(x any) {
+	e := x.(*entry) //nolint:errcheck,forcetypeassert // only entries are pushed
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *queue) Pop() any {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*q = old[:n-1]
+
+	return e
+}
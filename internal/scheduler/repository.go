@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/scylladb/gocqlx/v3"
+)
+
+type Repository struct {
+	db gocqlx.Session
+}
+
+func NewRepository(db gocqlx.Session) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// SaveGap records a period without the planned check data.
+func (r *Repository) SaveGap(ctx context.Context, m checkGapModel) error {
+	if err := checkGapsTable.InsertQueryContext(ctx, r.db).BindStruct(m).ExecRelease(); err != nil {
+		return fmt.Errorf("failed to save check gap: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+// Router hands jobs to the remote agents when one can run them and to the
+// local runner otherwise, so targets keep being checked without agents.
+//
+// Jobs of a location no agent can take are not run locally, the server is
+// not in that location. They are recorded as missed instead.
+type Router struct {
+	local   *Runner
+	remote  RemoteDispatcher
+	tracker *Tracker
+}
+
+func NewRouter(local *Runner, remote RemoteDispatcher, tracker *Tracker) *Router {
+	return &Router{
+		local:   local,
+		remote:  remote,
+		tracker: tracker,
+	}
+}
+
+func (r *Router) Dispatch(job Job) bool {
+	if r.remote == nil {
+		return r.local.Dispatch(job)
+	}
+	if r.remote.Dispatch(job) {
+		return true
+	}
+
+	if job.Location != "" {
+		r.tracker.Missed(job, MissNoAgent, 1, job.ScheduledAt.Add(job.Interval))
+		if job.Done != nil {
+			job.Done(Report{Location: job.Location, Err: ErrNoAgent}) //nolint:exhaustruct // not run
+		}
+		return true
+	}
+
+	return r.local.Dispatch(job)
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/results"
+	"github.com/pingplex/pingplex/internal/targets"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWorkers   = 16
+	defaultQueueSize = 1000
+)
+
+// Runner executes dispatched jobs on a pool of local workers.
+//
+// The server is a single location, so rechecks that should run elsewhere are
+// run locally as well.
+type Runner struct {
+	config Config
+	jobs   chan Job
+
+	targets *targets.Service
+	checks  *checker.Service
+	results *results.Service
+	tracker *Tracker
+
+	logger *zap.Logger
+}
+
+func NewRunner(
+	config Config,
+	targets *targets.Service,
+	checks *checker.Service,
+	results *results.Service,
+	tracker *Tracker,
+	logger *zap.Logger,
+) *Runner {
+	if config.Workers <= 0 {
+		config.Workers = defaultWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultQueueSize
+	}
+
+	return &Runner{
+		config: config,
+		jobs:   make(chan Job, config.QueueSize),
+
+		targets: targets,
+		checks:  checks,
+		results: results,
+		tracker: tracker,
+
+		logger: logger,
+	}
+}
+
+// Dispatch queues the job, it returns false when the queue is full.
+func (r *Runner) Dispatch(job Job) bool {
+	select {
+	case r.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run executes queued jobs until the context is canceled.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range r.config.Workers {
+		wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-r.jobs:
+					r.run(ctx, job)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func (r *Runner) run(ctx context.Context, job Job) {
+	r.tracker.Started(job, time.Now())
+
+	report := Report{Location: job.Location} //nolint:exhaustruct // filled below
+	if job.Done != nil {
+		defer func() { job.Done(report) }()
+	}
+
+	target, err := r.targets.CheckTarget(ctx, job.TargetID)
+	if errors.Is(err, targets.ErrNotFound) {
+		report.Err = err
+		return
+	}
+	if err != nil {
+		r.logger.Error("failed to load target", zap.Stringer("target_id", job.TargetID), zap.Error(err))
+		report.Err = err
+		return
+	}
+	if !target.Enabled && job.Kind != KindManual {
+		report.Err = ErrDisabled
+		return
+	}
+
+	report.Result = r.checks.Check(ctx, target.CheckTarget())
+	if recErr := r.results.Record(ctx, results.LocalAgentID, report.Result, job.Kind == KindRecheck); recErr != nil {
+		r.logger.Error("failed to record result", zap.Stringer("target_id", job.TargetID), zap.Error(recErr))
+		report.Err = recErr
+	}
+}
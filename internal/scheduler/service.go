@@ -0,0 +1,452 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/events"
+	"github.com/pingplex/pingplex/internal/results"
+	"github.com/pingplex/pingplex/internal/targets"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultResyncInterval = time.Minute
+	maxCountedRuns        = 10000
+	// recheckInterval is how often the due rechecks are collected
+	recheckInterval = time.Second
+	// pendingQueueSize bounds the rechecks waiting to be stored
+	pendingQueueSize = 256
+)
+
+// plan is a schedule change, loaded from the targets and applied by the
+// dispatch loop. A nil schedule removes the target.
+type plan struct {
+	schedules map[gocql.UUID]*planned
+	// full marks a complete snapshot, targets missing from it are removed
+	full bool
+}
+
+// Service dispatches checks of the enabled targets at their intervals.
+//
+// The schedule is kept in memory: it is loaded on start, updated from target
+// change events and reconciled with the stored targets periodically. Every
+// replica keeps the whole schedule but only dispatches the targets of the
+// shards it owns.
+type Service struct {
+	config Config
+
+	targets     *targets.Service
+	events      *events.Service
+	dispatcher  Dispatcher
+	coordinator *Coordinator
+	tracker     *Tracker
+
+	// entries and queue are owned by the dispatch loop
+	entries map[gocql.UUID]*entry
+	queue   queue
+	plans   chan plan
+
+	mu      sync.Mutex
+	changed map[gocql.UUID]struct{}
+	wake    chan struct{}
+
+	// pending holds the rechecks handed over by the event handler
+	pending chan Job
+
+	logger *zap.Logger
+}
+
+func NewService(
+	config Config,
+	targets *targets.Service,
+	events *events.Service,
+	dispatcher Dispatcher,
+	coordinator *Coordinator,
+	tracker *Tracker,
+	logger *zap.Logger,
+) *Service {
+	if config.ResyncInterval <= 0 {
+		config.ResyncInterval = defaultResyncInterval
+	}
+
+	return &Service{
+		config: config,
+
+		targets:     targets,
+		events:      events,
+		dispatcher:  dispatcher,
+		coordinator: coordinator,
+		tracker:     tracker,
+
+		entries: map[gocql.UUID]*entry{},
+		queue:   queue{},
+		plans:   make(chan plan),
+
+		mu:      sync.Mutex{},
+		changed: map[gocql.UUID]struct{}{},
+		wake:    make(chan struct{}, 1),
+
+		pending: make(chan Job, pendingQueueSize),
+
+		logger: logger,
+	}
+}
+
+// Run schedules the checks until the context is canceled.
+func (s *Service) Run(ctx context.Context) {
+	unsubscribe := s.events.Subscribe(s.onEvent)
+	defer unsubscribe()
+
+	// Rechecks are stored by the replica that recorded the failure only.
+	unsubscribePending := s.events.Subscribe(s.onPending)
+	defer unsubscribePending()
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		s.load(ctx)
+	})
+	wg.Go(func() {
+		s.deferRechecks(ctx)
+	})
+	wg.Go(func() {
+		// Targets changed through other replicas.
+		s.coordinator.Listen(ctx, s.onEvent)
+	})
+	s.dispatch(ctx)
+	wg.Wait()
+}
+
+// CheckNow dispatches an immediate check of the target from each of its
+// locations, or from any location when it has none. The returned channel
+// receives the reports as they arrive and is closed once all of them did.
+func (s *Service) CheckNow(ctx context.Context, targetID gocql.UUID) (<-chan Report, error) {
+	target, err := s.targets.Get(ctx, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load target: %w", err)
+	}
+
+	locations := target.Locations
+	if len(locations) == 0 {
+		locations = []string{""}
+	}
+
+	reports := make(chan Report, len(locations))
+	var wg sync.WaitGroup
+	now := time.Now()
+	for _, location := range locations {
+		wg.Add(1)
+		job := Job{
+			TargetID:      targetID,
+			Type:          target.Type,
+			Kind:          KindManual,
+			ScheduledAt:   now,
+			Interval:      0,
+			Location:      location,
+			ExcludeAgents: nil,
+			Behind:        false,
+			Done: func(report Report) {
+				reports <- report
+				wg.Done()
+			},
+		}
+		if !s.dispatcher.Dispatch(job) {
+			job.Done(Report{Location: location, Err: ErrQueueFull}) //nolint:exhaustruct // not run
+		}
+	}
+
+	go func() {
+		wg.Wait()
+		close(reports)
+	}()
+
+	return reports, nil
+}
+
+// onEvent marks changed targets for reloading.
+func (s *Service) onEvent(event events.Event) {
+	if event.Type != events.TypeTargetUpdated && event.Type != events.TypeTargetDeleted {
+		return
+	}
+
+	s.mu.Lock()
+	s.changed[event.TargetID] = struct{}{}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// onPending queues the confirmation recheck of a pending failure for storing,
+// it runs on the replica owning the target when due.
+func (s *Service) onPending(event events.Event) {
+	pending, ok := event.Data.(results.Pending)
+	if event.Type != events.TypeCheckPending || !ok {
+		return
+	}
+
+	job := Job{
+		TargetID:      event.TargetID,
+		Type:          "",
+		Kind:          KindRecheck,
+		ScheduledAt:   pending.RecheckAt,
+		Interval:      pending.RecheckAt.Sub(event.Time),
+		Location:      "",
+		ExcludeAgents: nil,
+		Behind:        false,
+		Done:          nil,
+	}
+	if pending.OtherLocation {
+		job.ExcludeAgents = []gocql.UUID{pending.AgentID}
+	}
+
+	select {
+	case s.pending <- job:
+	default:
+		// The target stays pending until its next scheduled check.
+		s.logger.Warn("recheck queue is full", zap.Stringer("target_id", job.TargetID))
+	}
+}
+
+// deferRechecks stores the queued rechecks with the coordinator, out of the
+// event handler.
+func (s *Service) deferRechecks(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.pending:
+			if err := s.coordinator.Defer(ctx, job); err != nil {
+				s.logger.Error("failed to schedule recheck", zap.Stringer("target_id", job.TargetID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// recheck dispatches the due rechecks of the owned targets.
+func (s *Service) recheck(ctx context.Context, now time.Time) {
+	jobs, err := s.coordinator.Due(ctx, now)
+	if err != nil {
+		s.logger.Warn("failed to collect rechecks", zap.Error(err))
+	}
+
+	for _, job := range jobs {
+		target, getErr := s.targets.Get(ctx, job.TargetID)
+		if getErr != nil {
+			s.logger.Warn("failed to load target, skipping recheck", zap.Stringer("target_id", job.TargetID), zap.Error(getErr))
+			continue
+		}
+		job.Type = target.Type
+
+		if !s.dispatcher.Dispatch(job) {
+			s.logger.Warn("check queue is full, skipping recheck", zap.Stringer("target_id", job.TargetID))
+		}
+	}
+}
+
+// load produces schedule plans from the stored targets: a full snapshot on
+// start and every resync interval, and the changed targets in between.
+func (s *Service) load(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ResyncInterval)
+	defer ticker.Stop()
+
+	s.resync(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.resync(ctx)
+		case <-s.wake:
+			s.reload(ctx)
+		}
+	}
+}
+
+func (s *Service) resync(ctx context.Context) {
+	p := plan{schedules: map[gocql.UUID]*planned{}, full: true}
+
+	err := s.targets.ForEach(ctx, func(t targets.Target) error {
+		if planned := s.plan(t); planned != nil {
+			p.schedules[t.ID] = planned
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("failed to load targets", zap.Error(err))
+		return
+	}
+
+	s.apply(ctx, p)
+}
+
+func (s *Service) reload(ctx context.Context) {
+	s.mu.Lock()
+	changed := s.changed
+	s.changed = map[gocql.UUID]struct{}{}
+	s.mu.Unlock()
+
+	p := plan{schedules: make(map[gocql.UUID]*planned, len(changed)), full: false}
+	for id := range changed {
+		t, err := s.targets.Get(ctx, id)
+		switch {
+		case errors.Is(err, targets.ErrNotFound):
+			p.schedules[id] = nil
+		case err != nil:
+			// The next resync picks the change up.
+			s.logger.Error("failed to load target", zap.Stringer("target_id", id), zap.Error(err))
+		default:
+			p.schedules[id] = s.plan(t)
+		}
+	}
+
+	s.apply(ctx, p)
+}
+
+func (s *Service) apply(ctx context.Context, p plan) {
+	select {
+	case <-ctx.Done():
+	case s.plans <- p:
+	}
+}
+
+// dispatch hands the due entries and rechecks to the dispatcher and applies
+// schedule plans.
+func (s *Service) dispatch(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	rechecks := time.NewTicker(recheckInterval)
+	defer rechecks.Stop()
+
+	for {
+		timer.Reset(s.untilNext())
+
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-s.plans:
+			s.update(p, time.Now())
+		case now := <-timer.C:
+			s.runDue(ctx, now)
+		case now := <-rechecks.C:
+			s.recheck(ctx, now)
+		}
+	}
+}
+
+func (s *Service) untilNext() time.Duration {
+	if len(s.queue) == 0 {
+		return s.config.ResyncInterval
+	}
+
+	return max(time.Until(s.queue[0].next), 0)
+}
+
+func (s *Service) runDue(ctx context.Context, now time.Time) {
+	var jobs []Job
+	for len(s.queue) > 0 && !s.queue[0].next.After(now) {
+		e := s.queue[0]
+
+		owned := s.coordinator.Owns(e.targetID)
+		scheduledAt := e.next
+		e.next = e.schedule.Next(scheduledAt)
+		behind := !e.next.IsZero() && !e.next.After(now)
+		if owned {
+			jobs = append(jobs, e.jobs(scheduledAt, e.next, behind)...)
+		}
+
+		if behind {
+			// Fell behind, skip the missed runs. The late start of the run
+			// dispatched now is part of the same gap.
+			skipped := e.next
+			runs := countRuns(e.schedule, skipped, now)
+			e.next = e.schedule.Next(now)
+			if owned {
+				for _, job := range e.jobs(skipped, e.schedule.Next(skipped), true) {
+					s.tracker.Missed(job, MissBehind, runs, e.next)
+				}
+			}
+		}
+		if e.next.IsZero() {
+			// The schedule has no more runs.
+			s.remove(e.targetID)
+			continue
+		}
+		heap.Fix(&s.queue, e.index)
+	}
+
+	for _, job := range s.coordinator.Claim(ctx, jobs) {
+		if !s.dispatcher.Dispatch(job) {
+			s.logger.Warn("check queue is full, skipping check", zap.Stringer("target_id", job.TargetID))
+			s.tracker.Missed(job, MissQueueFull, 1, job.ScheduledAt.Add(job.Interval))
+		}
+	}
+}
+
+// countRuns returns the number of runs of the schedule from the given run
+// until now, capped to keep long outages cheap.
+func countRuns(schedule targets.Schedule, from, now time.Time) int {
+	runs := 0
+	for at := from; !at.IsZero() && !at.After(now) && runs < maxCountedRuns; at = schedule.Next(at) {
+		runs++
+	}
+
+	return runs
+}
+
+func (s *Service) update(p plan, now time.Time) {
+	if p.full {
+		for id, e := range s.entries {
+			if _, ok := p.schedules[id]; !ok {
+				s.remove(e.targetID)
+			}
+		}
+	}
+
+	for id, planned := range p.schedules {
+		if e, ok := s.entries[id]; ok && planned != nil && e.key() == planned.key() {
+			continue
+		}
+
+		s.remove(id)
+		if planned == nil {
+			continue
+		}
+
+		e := newEntry(id, planned, now)
+		if e.next.IsZero() {
+			continue
+		}
+		s.entries[id] = e
+		heap.Push(&s.queue, e)
+	}
+}
+
+func (s *Service) remove(id gocql.UUID) {
+	if e, ok := s.entries[id]; ok {
+		heap.Remove(&s.queue, e.index)
+		delete(s.entries, id)
+	}
+}
+
+// plan returns the check plan of the target, nil when it is not scheduled.
+func (s *Service) plan(t targets.Target) *planned {
+	if !t.Enabled {
+		return nil
+	}
+
+	schedule, err := t.Schedule()
+	if err != nil {
+		s.logger.Error("invalid target schedule", zap.Stringer("target_id", t.ID), zap.Error(err))
+		return nil
+	}
+
+	return newPlanned(t, schedule)
+}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const gapQueueSize = 1000
+
+// Tracker compares the planned runs of scheduled checks with their actual
+// execution. It exports the lag and the missed checks as metrics and records
+// the periods left without data as gaps, so they are not mistaken for uptime.
+type Tracker struct {
+	metrics *Metrics
+	gaps    *Repository
+	pending chan checkGapModel
+
+	logger *zap.Logger
+}
+
+func NewTracker(metrics *Metrics, gaps *Repository, logger *zap.Logger) *Tracker {
+	return &Tracker{
+		metrics: metrics,
+		gaps:    gaps,
+		pending: make(chan checkGapModel, gapQueueSize),
+
+		logger: logger,
+	}
+}
+
+// Started records the start of the job. A scheduled check starting after its
+// next run was due leaves a gap, unless the scheduler recorded it already
+// when it fell behind.
+func (t *Tracker) Started(job Job, at time.Time) {
+	if job.Kind != KindScheduled {
+		return
+	}
+
+	lag := max(at.Sub(job.ScheduledAt), 0)
+	t.metrics.ObserveLag(job.Location, lag)
+
+	if job.Interval > 0 && lag >= job.Interval && !job.Behind {
+		t.Missed(job, MissLate, int(lag/job.Interval), at)
+	}
+}
+
+// Missed records scheduled runs that did not happen, from the planned time
+// of the job until the given time.
+func (t *Tracker) Missed(job Job, reason MissReason, runs int, until time.Time) {
+	if job.Kind != KindScheduled || runs <= 0 {
+		return
+	}
+
+	t.metrics.AddMissed(job.Location, reason, runs)
+
+	gap := checkGapModel{
+		TargetID:   job.TargetID,
+		StartedAt:  job.ScheduledAt.UTC().Truncate(time.Millisecond),
+		Location:   job.Location,
+		EndedAt:    until.UTC().Truncate(time.Millisecond),
+		Reason:     string(reason),
+		MissedRuns: runs,
+	}
+
+	select {
+	case t.pending <- gap:
+	default:
+		t.logger.Warn("gap queue is full, dropping gap", zap.Stringer("target_id", job.TargetID))
+	}
+}
+
+// Run stores the recorded gaps until the context is canceled.
+func (t *Tracker) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case gap := <-t.pending:
+			if err := t.gaps.SaveGap(ctx, gap); err != nil {
+				t.logger.Error("failed to save check gap", zap.Stringer("target_id", gap.TargetID), zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package secrets
+
+// Config holds the master keys used for envelope encryption.
+type Config struct {
+	// Keys maps key IDs to base64 encoded 256-bit master keys
+	Keys map[string]string
+	// ActiveKey is the ID of the key used to wrap new data keys,
+	// the other keys are kept to open records sealed before a rotation
+	ActiveKey string
+}
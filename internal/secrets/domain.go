@@ -0,0 +1,16 @@
+package secrets
+
+// Envelope is an encrypted record payload together with its wrapped data key.
+type Envelope struct {
+	// KeyID identifies the master key that wrapped DataKey
+	KeyID string
+	// DataKey is the per-record data key encrypted with the master key
+	DataKey []byte
+	// Ciphertext is the payload encrypted with the data key
+	Ciphertext []byte
+}
+
+// IsZero reports whether the envelope holds no payload.
+func (e Envelope) IsZero() bool {
+	return e.KeyID == "" && len(e.DataKey) == 0 && len(e.Ciphertext) == 0
+}
@@ -0,0 +1,10 @@
+package secrets
+
+import "errors"
+
+var (
+	ErrInvalidConfig = errors.New("invalid config")
+	ErrNoActiveKey   = errors.New("no active master key configured")
+	ErrUnknownKey    = errors.New("unknown master key")
+	ErrDecrypt       = errors.New("failed to decrypt")
+)
@@ -0,0 +1,181 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+const keySize = 32
+
+// Service implements envelope encryption: every record is encrypted with its
+// own random data key, which is in turn encrypted ("wrapped") with a master key.
+//
+// Rotating the master key only requires re-wrapping the data keys, the record
+// payloads are left untouched.
+type Service struct {
+	keys   map[string]cipher.AEAD
+	active string
+
+	logger *zap.Logger
+}
+
+func New(config Config, logger *zap.Logger) (*Service, error) {
+	keys := make(map[string]cipher.AEAD, len(config.Keys))
+	for id, encoded := range config.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q is not valid base64: %w", ErrInvalidConfig, id, err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("%w: key %q must be %d bytes long", ErrInvalidConfig, id, keySize)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %w", ErrInvalidConfig, id, err)
+		}
+		keys[id] = aead
+	}
+
+	if config.ActiveKey != "" {
+		if _, ok := keys[config.ActiveKey]; !ok {
+			return nil, fmt.Errorf("%w: active key %q is not configured", ErrInvalidConfig, config.ActiveKey)
+		}
+	} else {
+		logger.Warn("no active master key configured, sealing secrets is disabled")
+	}
+
+	return &Service{
+		keys:   keys,
+		active: config.ActiveKey,
+
+		logger: logger,
+	}, nil
+}
+
+// Seal encrypts plaintext with a fresh data key wrapped by the active master key.
+//
+// The additional data binds the envelope to its record, e.g. the record ID,
+// so an envelope copied to another record fails to open.
+func (s *Service) Seal(plaintext, additionalData []byte) (Envelope, error) {
+	master, ok := s.keys[s.active]
+	if !ok {
+		return Envelope{}, ErrNoActiveKey
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return Envelope{}, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		KeyID:      s.active,
+		DataKey:    seal(master, dataKey, []byte(s.active)),
+		Ciphertext: seal(aead, plaintext, additionalData),
+	}, nil
+}
+
+// Open decrypts the envelope sealed with the same additional data.
+func (s *Service) Open(envelope Envelope, additionalData []byte) ([]byte, error) {
+	dataKey, err := s.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := open(aead, envelope.Ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload: %w", ErrDecrypt, err)
+	}
+
+	return plaintext, nil
+}
+
+// NeedsRewrap reports whether the envelope was wrapped by a non-active master key.
+func (s *Service) NeedsRewrap(envelope Envelope) bool {
+	return !envelope.IsZero() && s.active != "" && envelope.KeyID != s.active
+}
+
+// Rewrap re-encrypts the data key with the active master key, leaving the payload as is.
+func (s *Service) Rewrap(envelope Envelope) (Envelope, error) {
+	master, ok := s.keys[s.active]
+	if !ok {
+		return Envelope{}, ErrNoActiveKey
+	}
+
+	dataKey, err := s.unwrap(envelope)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		KeyID:      s.active,
+		DataKey:    seal(master, dataKey, []byte(s.active)),
+		Ciphertext: envelope.Ciphertext,
+	}, nil
+}
+
+func (s *Service) unwrap(envelope Envelope) ([]byte, error) {
+	master, ok := s.keys[envelope.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, envelope.KeyID)
+	}
+
+	dataKey, err := open(master, envelope.DataKey, []byte(envelope.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key: %w", ErrDecrypt, err)
+	}
+
+	return dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+
+	return aead, nil
+}
+
+// seal returns nonce || ciphertext.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, _ = rand.Read(nonce)
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short") //nolint:err113 // wrapped by callers
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	return plaintext, nil
+}
@@ -6,7 +6,12 @@ import (
 	"github.com/go-core-fx/fiberfx/health"
 	"github.com/go-core-fx/fiberfx/validation"
 	"github.com/go-core-fx/logger"
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"github.com/pingplex/pingplex/internal/agents"
+	"github.com/pingplex/pingplex/internal/incidents"
+	"github.com/pingplex/pingplex/internal/scheduler"
+	"github.com/pingplex/pingplex/internal/targets"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -23,8 +28,16 @@ func Module() fx.Option {
 			return opts
 		}),
 
+		fx.Provide(func() *validator.Validate {
+			return validator.New(validator.WithRequiredStructEnabled())
+		}, fx.Private),
+
 		fx.Provide(
 			fx.Annotate(health.NewHandler, fx.ResultTags(`group:"handlers"`)), fx.Private,
+			fx.Annotate(targets.NewHandler, fx.ResultTags(`group:"handlers"`)), fx.Private,
+			fx.Annotate(incidents.NewHandler, fx.ResultTags(`group:"handlers"`)), fx.Private,
+			fx.Annotate(scheduler.NewHandler, fx.ResultTags(`group:"handlers"`)), fx.Private,
+			fx.Annotate(agents.NewHandler, fx.ResultTags(`group:"handlers"`)), fx.Private,
 			// fx.Annotate(stacks.NewHandler, fx.ResultTags(`group:"handlers"`)), fx.Private,
 		),
 
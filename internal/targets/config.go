@@ -0,0 +1,9 @@
+package targets
+
+// Config holds the configuration for the targets module.
+type Config struct {
+	// MinIntervalSeconds is the shortest allowed check interval
+	MinIntervalSeconds int
+	// DefaultIntervalSeconds is used for targets created without an interval
+	DefaultIntervalSeconds int
+}
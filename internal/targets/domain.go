@@ -0,0 +1,73 @@
+package targets
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+)
+
+// Target is a monitored endpoint.
+//
+// Targets returned by the Service carry redacted credentials, the real values
+// are only available to the checks through Service.CheckTarget.
+type Target struct {
+	ID     gocql.UUID
+	UserID gocql.UUID
+
+	Name   string
+	Type   checker.Type
+	URL    string
+	Config checker.CheckConfig
+
+	IntervalSeconds int
+	Cron            string
+	Timezone        string
+	Retry           RetryPolicy
+	Locations       []string
+	Tags            []string
+	Enabled         bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CheckTarget converts the target to the checker's view.
+func (t Target) CheckTarget() checker.Target {
+	return checker.Target{
+		ID:     t.ID,
+		Type:   t.Type,
+		URL:    t.URL,
+		Config: t.Config,
+		Family: checker.FamilyAny,
+	}
+}
+
+// TargetInput holds the user-editable target fields.
+type TargetInput struct {
+	UserID gocql.UUID
+
+	Name   string
+	Type   checker.Type
+	URL    string
+	Config checker.CheckConfig
+
+	IntervalSeconds int
+	Cron            string
+	Timezone        string
+	Retry           RetryPolicy
+	Locations       []string
+	Tags            []string
+	Enabled         bool
+}
+
+// RetryPolicy controls the confirmation of failures before a target is
+// reported down.
+type RetryPolicy struct {
+	// Retries is the number of confirmation rechecks, zero reports failures immediately
+	Retries int
+	// Interval is the delay between rechecks
+	Interval time.Duration
+	// OtherLocation requires rechecks to run from a different location or agent than the failed check
+	OtherLocation bool
+}
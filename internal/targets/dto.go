@@ -0,0 +1,297 @@
+package targets
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+)
+
+// nextRunsCount is the number of planned runs returned with targets.
+const nextRunsCount = 5
+
+// AuthDTO holds HTTP check credentials.
+type AuthDTO struct {
+	// Authentication scheme
+	Type string `json:"type" validate:"omitempty,oneof=basic bearer oauth2"`
+	// Basic auth user name
+	Username string `json:"username,omitempty"`
+	// Basic auth password
+	Password string `json:"password,omitempty"`
+	// Static bearer token
+	Token string `json:"token,omitempty"`
+	// OAuth2 token endpoint, https only
+	TokenURL string `json:"tokenUrl,omitempty" validate:"required_if=Type oauth2,omitempty,https_url"`
+	// OAuth2 client ID
+	ClientID string `json:"clientId,omitempty" validate:"required_if=Type oauth2"`
+	// OAuth2 client secret
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// OAuth2 scopes
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// CheckConfigDTO holds the probe settings of a target.
+//
+// Secret values (header values, body, passwords, tokens, client secret and
+// key, proxy credentials) are returned as "[redacted]".
+type CheckConfigDTO struct {
+	// Check timeout in seconds
+	Timeout int `json:"timeout,omitempty" validate:"omitempty,min=1,max=300"`
+	// HTTP request method
+	Method string `json:"method,omitempty" validate:"omitempty,oneof=GET HEAD POST PUT PATCH DELETE OPTIONS"`
+	// HTTP request headers
+	Headers map[string]string `json:"headers,omitempty"`
+	// HTTP request body
+	Body string `json:"body,omitempty"`
+	// Follow HTTP redirects
+	FollowRedirects bool `json:"followRedirects"`
+	// Verify TLS certificates, defaults to true
+	VerifySSL *bool `json:"verifySsl,omitempty"`
+	// Plugin name for exec checks
+	Command string `json:"command,omitempty"`
+	// Plugin arguments for exec checks
+	Args []string `json:"args,omitempty"`
+	// Outbound proxy URL (http, https, socks5)
+	ProxyURL string `json:"proxyUrl,omitempty" validate:"omitempty,url"`
+	// HTTP authentication
+	Auth *AuthDTO `json:"auth,omitempty"`
+	// PEM encoded client certificate for mTLS
+	ClientCert string `json:"clientCert,omitempty"`
+	// PEM encoded client key for mTLS
+	ClientKey string `json:"clientKey,omitempty"`
+	// CSS selector for content_change checks
+	Selector string `json:"selector,omitempty"`
+	// JSONPath expression for content_change checks
+	JSONPath string `json:"jsonPath,omitempty"`
+	// Levels of linked pages followed by crawl checks
+	CrawlDepth int `json:"crawlDepth,omitempty" validate:"omitempty,min=0,max=3"`
+	// Maximum number of resources checked by crawl checks
+	CrawlLimit int `json:"crawlLimit,omitempty" validate:"omitempty,min=1,max=1000"`
+	// Include resources of other origins in crawl checks
+	CrawlExternal bool `json:"crawlExternal,omitempty"`
+	// Broken resources tolerated before the target is down
+	CrawlThreshold int `json:"crawlThreshold,omitempty" validate:"omitempty,min=0"`
+	// Check IPv4 and IPv6 addresses separately
+	DualStack bool `json:"dualStack,omitempty"`
+	// Dual-stack status rule: all families must be up, or any of them
+	FamilyRule string `json:"familyRule,omitempty" validate:"omitempty,oneof=all any"`
+}
+
+// RetryPolicyDTO holds the failure confirmation settings.
+type RetryPolicyDTO struct {
+	// Confirmation rechecks before the target is reported down
+	Retries int `json:"retries" validate:"min=0,max=10"`
+	// Delay between rechecks in seconds
+	IntervalSeconds int `json:"intervalSeconds,omitempty" validate:"omitempty,min=1,max=3600"`
+	// Recheck from a different location or agent than the failed check
+	OtherLocation bool `json:"otherLocation"`
+}
+
+// TargetRequest is the create and update target payload.
+type TargetRequest struct {
+	// Owner ID
+	UserID string `json:"userId" validate:"required,uuid"`
+	// Display name
+	Name string `json:"name" validate:"required,max=255"`
+	// Check type
+	Type string `json:"type" validate:"required"`
+	// Probe address
+	URL string `json:"url,omitempty" validate:"omitempty,max=2048"`
+	// Probe settings
+	Config CheckConfigDTO `json:"config"`
+	// Check interval in seconds
+	IntervalSeconds int `json:"intervalSeconds,omitempty" validate:"omitempty,min=1"`
+	// Cron expression, replaces the interval when set
+	Cron string `json:"cron,omitempty" validate:"omitempty,max=255"`
+	// IANA timezone of the cron expression, defaults to UTC
+	Timezone string `json:"timezone,omitempty" validate:"omitempty,max=64"`
+	// Failure confirmation, failures are reported immediately when omitted
+	Retry *RetryPolicyDTO `json:"retry,omitempty"`
+	// Locations to check from
+	Locations []string `json:"locations,omitempty"`
+	// Free-form tags
+	Tags []string `json:"tags,omitempty"`
+	// Whether the target is checked, defaults to true
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// TargetResponse is a target with redacted credentials.
+type TargetResponse struct {
+	ID              string         `json:"id"`
+	UserID          string         `json:"userId"`
+	Name            string         `json:"name"`
+	Type            string         `json:"type"`
+	URL             string         `json:"url,omitempty"`
+	Config          CheckConfigDTO `json:"config"`
+	IntervalSeconds int            `json:"intervalSeconds"`
+	Cron            string         `json:"cron,omitempty"`
+	Timezone        string         `json:"timezone,omitempty"`
+	NextRuns        []time.Time    `json:"nextRuns"`
+	Retry           RetryPolicyDTO `json:"retry"`
+	Locations       []string       `json:"locations"`
+	Tags            []string       `json:"tags"`
+	Enabled         bool           `json:"enabled"`
+	CreatedAt       time.Time      `json:"createdAt"`
+	UpdatedAt       time.Time      `json:"updatedAt"`
+}
+
+func (r TargetRequest) toInput() (TargetInput, error) {
+	userID, err := gocql.ParseUUID(r.UserID)
+	if err != nil {
+		return TargetInput{}, fmt.Errorf("%w: invalid user id: %w", ErrValidation, err)
+	}
+
+	enabled := true
+	if r.Enabled != nil {
+		enabled = *r.Enabled
+	}
+
+	var retry RetryPolicy
+	if r.Retry != nil {
+		retry = RetryPolicy{
+			Retries:       r.Retry.Retries,
+			Interval:      time.Duration(r.Retry.IntervalSeconds) * time.Second,
+			OtherLocation: r.Retry.OtherLocation,
+		}
+	}
+
+	return TargetInput{
+		UserID:          userID,
+		Name:            r.Name,
+		Type:            checker.Type(r.Type),
+		URL:             r.URL,
+		Config:          r.Config.toDomain(),
+		IntervalSeconds: r.IntervalSeconds,
+		Cron:            r.Cron,
+		Timezone:        r.Timezone,
+		Retry:           retry,
+		Locations:       r.Locations,
+		Tags:            r.Tags,
+		Enabled:         enabled,
+	}, nil
+}
+
+func (c CheckConfigDTO) toDomain() checker.CheckConfig {
+	verifySSL := true
+	if c.VerifySSL != nil {
+		verifySSL = *c.VerifySSL
+	}
+
+	var auth checker.Auth
+	if c.Auth != nil {
+		auth = checker.Auth{
+			Type:         checker.AuthType(c.Auth.Type),
+			Username:     c.Auth.Username,
+			Password:     c.Auth.Password,
+			Token:        c.Auth.Token,
+			TokenURL:     c.Auth.TokenURL,
+			ClientID:     c.Auth.ClientID,
+			ClientSecret: c.Auth.ClientSecret,
+			Scopes:       c.Auth.Scopes,
+		}
+	}
+
+	return checker.CheckConfig{
+		Timeout:         time.Duration(c.Timeout) * time.Second,
+		Method:          c.Method,
+		Headers:         c.Headers,
+		Body:            c.Body,
+		FollowRedirects: c.FollowRedirects,
+		VerifySSL:       verifySSL,
+		ProxyURL:        c.ProxyURL,
+		Auth:            auth,
+		ClientCert:      c.ClientCert,
+		ClientKey:       c.ClientKey,
+		Command:         c.Command,
+		Args:            c.Args,
+		Selector:        c.Selector,
+		JSONPath:        c.JSONPath,
+		CrawlDepth:      c.CrawlDepth,
+		CrawlLimit:      c.CrawlLimit,
+		CrawlExternal:   c.CrawlExternal,
+		CrawlThreshold:  c.CrawlThreshold,
+		DualStack:       c.DualStack,
+		FamilyRule:      checker.FamilyRule(c.FamilyRule),
+	}
+}
+
+func newCheckConfigDTO(c checker.CheckConfig) CheckConfigDTO {
+	var auth *AuthDTO
+	if c.Auth.Type != checker.AuthNone {
+		auth = &AuthDTO{
+			Type:         string(c.Auth.Type),
+			Username:     c.Auth.Username,
+			Password:     c.Auth.Password,
+			Token:        c.Auth.Token,
+			TokenURL:     c.Auth.TokenURL,
+			ClientID:     c.Auth.ClientID,
+			ClientSecret: c.Auth.ClientSecret,
+			Scopes:       c.Auth.Scopes,
+		}
+	}
+
+	return CheckConfigDTO{
+		Timeout:         int(c.Timeout / time.Second),
+		Method:          c.Method,
+		Headers:         c.Headers,
+		Body:            c.Body,
+		FollowRedirects: c.FollowRedirects,
+		VerifySSL:       &c.VerifySSL,
+		Command:         c.Command,
+		Args:            c.Args,
+		ProxyURL:        c.ProxyURL,
+		Auth:            auth,
+		ClientCert:      c.ClientCert,
+		ClientKey:       c.ClientKey,
+		Selector:        c.Selector,
+		JSONPath:        c.JSONPath,
+		CrawlDepth:      c.CrawlDepth,
+		CrawlLimit:      c.CrawlLimit,
+		CrawlExternal:   c.CrawlExternal,
+		CrawlThreshold:  c.CrawlThreshold,
+		DualStack:       c.DualStack,
+		FamilyRule:      string(c.FamilyRule),
+	}
+}
+
+func newTargetResponse(t Target) TargetResponse {
+	nextRuns := []time.Time{}
+	if schedule, err := t.Schedule(); err == nil && t.Enabled {
+		nextRuns = NextRuns(schedule, time.Now(), nextRunsCount)
+	}
+
+	return TargetResponse{
+		ID:              t.ID.String(),
+		UserID:          t.UserID.String(),
+		Name:            t.Name,
+		Type:            string(t.Type),
+		URL:             t.URL,
+		Config:          newCheckConfigDTO(t.Config),
+		IntervalSeconds: t.IntervalSeconds,
+		Cron:            t.Cron,
+		Timezone:        t.Timezone,
+		NextRuns:        nextRuns,
+		Retry:           newRetryPolicyDTO(t.Retry),
+		Locations:       nonNil(t.Locations),
+		Tags:            nonNil(t.Tags),
+		Enabled:         t.Enabled,
+		CreatedAt:       t.CreatedAt,
+		UpdatedAt:       t.UpdatedAt,
+	}
+}
+
+func newRetryPolicyDTO(p RetryPolicy) RetryPolicyDTO {
+	return RetryPolicyDTO{
+		Retries:         p.Retries,
+		IntervalSeconds: int(p.Interval / time.Second),
+		OtherLocation:   p.OtherLocation,
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,8 @@
+package targets
+
+import "errors"
+
+var (
+	ErrNotFound   = errors.New("target not found")
+	ErrValidation = errors.New("validation failed")
+)
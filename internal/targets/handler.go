@@ -0,0 +1,208 @@
+package targets
+
+import (
+	"errors"
+
+	"github.com/go-core-fx/fiberfx/handler"
+	"github.com/go-playground/validator/v10"
+	"github.com/gocql/gocql"
+	"github.com/gofiber/fiber/v2"
+)
+
+type listQuery struct {
+	UserID string `query:"userId" validate:"required,uuid"`
+}
+
+type Handler struct {
+	handler.Base
+
+	targets *Service
+}
+
+func NewHandler(targets *Service, validator *validator.Validate) handler.Handler {
+	return &Handler{
+		Base: handler.Base{Validator: validator},
+
+		targets: targets,
+	}
+}
+
+func (h *Handler) Register(router fiber.Router) {
+	router = router.Group("/targets")
+
+	router.Post("", h.create)
+	router.Get("", h.list)
+	router.Get(":id", h.get)
+	router.Put(":id", h.update)
+	router.Delete(":id", h.delete)
+}
+
+//	@Summary		Create target
+//	@Description	Creates a monitored target, credentials are stored encrypted
+//	@Tags			Targets
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		TargetRequest	true	"Target"
+//	@Success		201		{object}	TargetResponse
+//	@Failure		400		{object}	fiberfx.ErrorResponse
+//	@Router			/targets [post]
+//
+// Create target.
+func (h *Handler) create(c *fiber.Ctx) error {
+	input, err := h.parseRequest(c)
+	if err != nil {
+		return err
+	}
+
+	target, err := h.targets.Create(c.Context(), input)
+	if err != nil {
+		return h.toHTTPError(err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newTargetResponse(target))
+}
+
+//	@Summary		List targets
+//	@Description	Returns the user's targets with redacted credentials
+//	@Tags			Targets
+//	@Produce		json
+//	@Param			userId	query		string	true	"Owner ID"
+//	@Success		200		{array}		TargetResponse
+//	@Failure		400		{object}	fiberfx.ErrorResponse
+//	@Router			/targets [get]
+//
+// List targets.
+func (h *Handler) list(c *fiber.Ctx) error {
+	var query listQuery
+	if err := h.QueryParserValidator(c, &query); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	userID, err := gocql.ParseUUID(query.UserID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid user id")
+	}
+
+	items, err := h.targets.ListByUser(c.Context(), userID)
+	if err != nil {
+		return h.toHTTPError(err)
+	}
+
+	result := make([]TargetResponse, len(items))
+	for i, item := range items {
+		result[i] = newTargetResponse(item)
+	}
+
+	return c.JSON(result)
+}
+
+//	@Summary		Get target
+//	@Description	Returns the target with redacted credentials
+//	@Tags			Targets
+//	@Produce		json
+//	@Param			id	path		string	true	"Target ID"
+//	@Success		200	{object}	TargetResponse
+//	@Failure		404	{object}	fiberfx.ErrorResponse
+//	@Router			/targets/{id} [get]
+//
+// Get target.
+func (h *Handler) get(c *fiber.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	target, err := h.targets.Get(c.Context(), id)
+	if err != nil {
+		return h.toHTTPError(err)
+	}
+
+	return c.JSON(newTargetResponse(target))
+}
+
+//	@Summary		Update target
+//	@Description	Replaces the target settings, "[redacted]" values keep the stored credentials
+//	@Tags			Targets
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string			true	"Target ID"
+//	@Param			request	body		TargetRequest	true	"Target"
+//	@Success		200		{object}	TargetResponse
+//	@Failure		400		{object}	fiberfx.ErrorResponse
+//	@Failure		404		{object}	fiberfx.ErrorResponse
+//	@Router			/targets/{id} [put]
+//
+// Update target.
+func (h *Handler) update(c *fiber.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	input, err := h.parseRequest(c)
+	if err != nil {
+		return err
+	}
+
+	target, err := h.targets.Update(c.Context(), id, input)
+	if err != nil {
+		return h.toHTTPError(err)
+	}
+
+	return c.JSON(newTargetResponse(target))
+}
+
+//	@Summary		Delete target
+//	@Tags			Targets
+//	@Param			id	path	string	true	"Target ID"
+//	@Success		204
+//	@Failure		404	{object}	fiberfx.ErrorResponse
+//	@Router			/targets/{id} [delete]
+//
+// Delete target.
+func (h *Handler) delete(c *fiber.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	if delErr := h.targets.Delete(c.Context(), id); delErr != nil {
+		return h.toHTTPError(delErr)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) parseRequest(c *fiber.Ctx) (TargetInput, error) {
+	var req TargetRequest
+	if err := h.BodyParserValidator(c, &req); err != nil {
+		return TargetInput{}, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	input, err := req.toInput()
+	if err != nil {
+		return TargetInput{}, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return input, nil
+}
+
+func (h *Handler) toHTTPError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, ErrValidation):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return err
+}
+
+func parseID(c *fiber.Ctx) (gocql.UUID, error) {
+	id, err := gocql.ParseUUID(c.Params("id"))
+	if err != nil {
+		return gocql.UUID{}, fiber.NewError(fiber.StatusBadRequest, "invalid target id")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,266 @@
+package targets
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/secrets"
+	"github.com/scylladb/gocqlx/v3/table"
+)
+
+//nolint:gochecknoglobals // table metadata
+var (
+	targetsTable = table.New(table.Metadata{
+		Name: "targets",
+		Columns: []string{
+			"id", "user_id", "name", "type", "url", "config", "interval_seconds",
+			"locations", "tags", "enabled", "created_at", "updated_at", "secrets", "retry",
+			"cron", "timezone",
+		},
+		PartKey: []string{"id"},
+		SortKey: []string{},
+	})
+
+	targetsByUserTable = table.New(table.Metadata{
+		Name:    "targets_by_user",
+		Columns: []string{"user_id", "target_id", "name", "type", "enabled", "created_at"},
+		PartKey: []string{"user_id"},
+		SortKey: []string{"target_id"},
+	})
+)
+
+type checkAuthUDT struct {
+	Type         string   `cql:"type"`
+	Username     string   `cql:"username"`
+	Password     string   `cql:"password"`
+	Token        string   `cql:"token"`
+	TokenURL     string   `cql:"token_url"`
+	ClientID     string   `cql:"client_id"`
+	ClientSecret string   `cql:"client_secret"`
+	Scopes       []string `cql:"scopes"`
+}
+
+type checkConfigUDT struct {
+	Timeout         int               `cql:"timeout"`
+	Method          string            `cql:"method"`
+	Headers         map[string]string `cql:"headers"`
+	Body            string            `cql:"body"`
+	FollowRedirects bool              `cql:"follow_redirects"`
+	VerifySSL       bool              `cql:"verify_ssl"`
+	Command         string            `cql:"command"`
+	Args            []string          `cql:"args"`
+	ProxyURL        string            `cql:"proxy_url"`
+	Auth            checkAuthUDT      `cql:"auth"`
+	ClientCert      string            `cql:"client_cert"`
+	ClientKey       string            `cql:"client_key"`
+	Selector        string            `cql:"selector"`
+	JSONPath        string            `cql:"json_path"`
+	CrawlDepth      int               `cql:"crawl_depth"`
+	CrawlLimit      int               `cql:"crawl_limit"`
+	CrawlExternal   bool              `cql:"crawl_external"`
+	CrawlThreshold  int               `cql:"crawl_threshold"`
+	DualStack       bool              `cql:"dual_stack"`
+	FamilyRule      string            `cql:"family_rule"`
+}
+
+type retryPolicyUDT struct {
+	Retries         int  `cql:"retries"`
+	IntervalSeconds int  `cql:"interval_seconds"`
+	OtherLocation   bool `cql:"other_location"`
+}
+
+type secretEnvelopeUDT struct {
+	KeyID      string `cql:"key_id"`
+	DataKey    []byte `cql:"data_key"`
+	Ciphertext []byte `cql:"ciphertext"`
+}
+
+type targetModel struct {
+	ID              gocql.UUID        `db:"id"`
+	UserID          gocql.UUID        `db:"user_id"`
+	Name            string            `db:"name"`
+	Type            string            `db:"type"`
+	URL             string            `db:"url"`
+	Config          checkConfigUDT    `db:"config"`
+	IntervalSeconds int               `db:"interval_seconds"`
+	Locations       []string          `db:"locations"`
+	Tags            []string          `db:"tags"`
+	Enabled         bool              `db:"enabled"`
+	CreatedAt       time.Time         `db:"created_at"`
+	UpdatedAt       time.Time         `db:"updated_at"`
+	Secrets         secretEnvelopeUDT `db:"secrets"`
+	Retry           retryPolicyUDT    `db:"retry"`
+	Cron            string            `db:"cron"`
+	Timezone        string            `db:"timezone"`
+}
+
+type targetByUserModel struct {
+	UserID    gocql.UUID `db:"user_id"`
+	TargetID  gocql.UUID `db:"target_id"`
+	Name      string     `db:"name"`
+	Type      string     `db:"type"`
+	Enabled   bool       `db:"enabled"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+func newTargetModel(t Target, envelope secrets.Envelope) targetModel {
+	return targetModel{
+		ID:              t.ID,
+		UserID:          t.UserID,
+		Name:            t.Name,
+		Type:            string(t.Type),
+		URL:             t.URL,
+		Config:          newCheckConfigUDT(t.Config),
+		IntervalSeconds: t.IntervalSeconds,
+		Locations:       t.Locations,
+		Tags:            t.Tags,
+		Enabled:         t.Enabled,
+		CreatedAt:       t.CreatedAt,
+		UpdatedAt:       t.UpdatedAt,
+		Secrets:         newSecretEnvelopeUDT(envelope),
+		Retry:           newRetryPolicyUDT(t.Retry),
+		Cron:            t.Cron,
+		Timezone:        t.Timezone,
+	}
+}
+
+func newRetryPolicyUDT(p RetryPolicy) retryPolicyUDT {
+	return retryPolicyUDT{
+		Retries:         p.Retries,
+		IntervalSeconds: int(p.Interval / time.Second),
+		OtherLocation:   p.OtherLocation,
+	}
+}
+
+func newSecretEnvelopeUDT(envelope secrets.Envelope) secretEnvelopeUDT {
+	return secretEnvelopeUDT{
+		KeyID:      envelope.KeyID,
+		DataKey:    envelope.DataKey,
+		Ciphertext: envelope.Ciphertext,
+	}
+}
+
+func (m targetModel) byUser() targetByUserModel {
+	return targetByUserModel{
+		UserID:    m.UserID,
+		TargetID:  m.ID,
+		Name:      m.Name,
+		Type:      m.Type,
+		Enabled:   m.Enabled,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+func (m targetModel) envelope() secrets.Envelope {
+	return secrets.Envelope{
+		KeyID:      m.Secrets.KeyID,
+		DataKey:    m.Secrets.DataKey,
+		Ciphertext: m.Secrets.Ciphertext,
+	}
+}
+
+func (m targetModel) toDomain() Target {
+	return Target{
+		ID:              m.ID,
+		UserID:          m.UserID,
+		Name:            m.Name,
+		Type:            checker.Type(m.Type),
+		URL:             m.URL,
+		Config:          m.Config.toDomain(),
+		IntervalSeconds: m.IntervalSeconds,
+		Cron:            m.Cron,
+		Timezone:        m.Timezone,
+		Retry:           m.Retry.toDomain(),
+		Locations:       m.Locations,
+		Tags:            m.Tags,
+		Enabled:         m.Enabled,
+		CreatedAt:       m.CreatedAt,
+		UpdatedAt:       m.UpdatedAt,
+	}
+}
+
+// redacted returns the target with placeholders in place of its credentials,
+// including the ones stored in the clear by targets saved before sealing.
+func (m targetModel) redacted() Target {
+	target := m.toDomain()
+	target.Config, _ = splitSecrets(target.Config)
+
+	return target
+}
+
+func (r retryPolicyUDT) toDomain() RetryPolicy {
+	return RetryPolicy{
+		Retries:       r.Retries,
+		Interval:      time.Duration(r.IntervalSeconds) * time.Second,
+		OtherLocation: r.OtherLocation,
+	}
+}
+
+func newCheckConfigUDT(c checker.CheckConfig) checkConfigUDT {
+	return checkConfigUDT{
+		Timeout:         int(c.Timeout / time.Second),
+		Method:          c.Method,
+		Headers:         c.Headers,
+		Body:            c.Body,
+		FollowRedirects: c.FollowRedirects,
+		VerifySSL:       c.VerifySSL,
+		Command:         c.Command,
+		Args:            c.Args,
+		ProxyURL:        c.ProxyURL,
+		Auth: checkAuthUDT{
+			Type:         string(c.Auth.Type),
+			Username:     c.Auth.Username,
+			Password:     c.Auth.Password,
+			Token:        c.Auth.Token,
+			TokenURL:     c.Auth.TokenURL,
+			ClientID:     c.Auth.ClientID,
+			ClientSecret: c.Auth.ClientSecret,
+			Scopes:       c.Auth.Scopes,
+		},
+		ClientCert:     c.ClientCert,
+		ClientKey:      c.ClientKey,
+		Selector:       c.Selector,
+		JSONPath:       c.JSONPath,
+		CrawlDepth:     c.CrawlDepth,
+		CrawlLimit:     c.CrawlLimit,
+		CrawlExternal:  c.CrawlExternal,
+		CrawlThreshold: c.CrawlThreshold,
+		DualStack:      c.DualStack,
+		FamilyRule:     string(c.FamilyRule),
+	}
+}
+
+func (c checkConfigUDT) toDomain() checker.CheckConfig {
+	return checker.CheckConfig{
+		Timeout:         time.Duration(c.Timeout) * time.Second,
+		Method:          c.Method,
+		Headers:         c.Headers,
+		Body:            c.Body,
+		FollowRedirects: c.FollowRedirects,
+		VerifySSL:       c.VerifySSL,
+		ProxyURL:        c.ProxyURL,
+		Auth: checker.Auth{
+			Type:         checker.AuthType(c.Auth.Type),
+			Username:     c.Auth.Username,
+			Password:     c.Auth.Password,
+			Token:        c.Auth.Token,
+			TokenURL:     c.Auth.TokenURL,
+			ClientID:     c.Auth.ClientID,
+			ClientSecret: c.Auth.ClientSecret,
+			Scopes:       c.Auth.Scopes,
+		},
+		ClientCert:     c.ClientCert,
+		ClientKey:      c.ClientKey,
+		Command:        c.Command,
+		Args:           c.Args,
+		Selector:       c.Selector,
+		JSONPath:       c.JSONPath,
+		CrawlDepth:     c.CrawlDepth,
+		CrawlLimit:     c.CrawlLimit,
+		CrawlExternal:  c.CrawlExternal,
+		CrawlThreshold: c.CrawlThreshold,
+		DualStack:      c.DualStack,
+		FamilyRule:     checker.FamilyRule(c.FamilyRule),
+	}
+}
@@ -0,0 +1,46 @@
+package targets
+
+import (
+	"context"
+
+	"github.com/go-core-fx/logger"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func Module() fx.Option {
+	return fx.Module(
+		"targets",
+		logger.WithNamedLogger("targets"),
+		fx.Provide(NewRepository, fx.Private),
+		fx.Provide(NewService),
+		fx.Invoke(func(lc fx.Lifecycle, svc *Service, logger *zap.Logger) {
+			// Seal plaintext secrets and re-wrap the ones sealed with retired master
+			// keys in the background.
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+
+			lc.Append(fx.Hook{
+				OnStart: func(_ context.Context) error {
+					go func() {
+						defer close(done)
+
+						rotated, failed, err := svc.RotateSecrets(ctx)
+						if err != nil {
+							logger.Error("failed to rotate target secrets", zap.Error(err))
+						}
+						if rotated > 0 || failed > 0 {
+							logger.Info("target secrets rotated", zap.Int("count", rotated), zap.Int("failed", failed))
+						}
+					}()
+					return nil
+				},
+				OnStop: func(_ context.Context) error {
+					cancel()
+					<-done
+					return nil
+				},
+			})
+		}),
+	)
+}
@@ -0,0 +1,170 @@
+package targets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v3"
+	"github.com/scylladb/gocqlx/v3/qb"
+)
+
+// Repository keeps targets and the targets_by_user index in sync.
+type Repository struct {
+	db gocqlx.Session
+}
+
+func NewRepository(db gocqlx.Session) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Save inserts or replaces the target.
+func (r *Repository) Save(ctx context.Context, m targetModel) error {
+	batch := r.db.ContextBatch(ctx, gocql.LoggedBatch)
+
+	if err := batch.BindStruct(targetsTable.InsertQueryContext(ctx, r.db), m); err != nil {
+		return fmt.Errorf("failed to bind target: %w", err)
+	}
+	if err := batch.BindStruct(targetsByUserTable.InsertQueryContext(ctx, r.db), m.byUser()); err != nil {
+		return fmt.Errorf("failed to bind target index: %w", err)
+	}
+
+	if err := r.db.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("failed to save target: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) Get(ctx context.Context, id gocql.UUID) (targetModel, error) {
+	var m targetModel
+	err := targetsTable.GetQueryContext(ctx, r.db).
+		BindStruct(targetModel{ID: id}). //nolint:exhaustruct // primary key only
+		GetRelease(&m)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return targetModel{}, ErrNotFound
+	}
+	if err != nil {
+		return targetModel{}, fmt.Errorf("failed to get target: %w", err)
+	}
+
+	return m, nil
+}
+
+// ListByUser returns the user's targets ordered by ID.
+func (r *Repository) ListByUser(ctx context.Context, userID gocql.UUID) ([]targetModel, error) {
+	var index []targetByUserModel
+	err := targetsByUserTable.SelectQueryContext(ctx, r.db, "target_id").
+		Bind(userID).
+		SelectRelease(&index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user targets: %w", err)
+	}
+
+	if len(index) == 0 {
+		return []targetModel{}, nil
+	}
+
+	ids := make([]gocql.UUID, len(index))
+	for i, item := range index {
+		ids[i] = item.TargetID
+	}
+
+	var items []targetModel
+	err = qb.Select(targetsTable.Name()).
+		Columns(targetsTable.Metadata().Columns...).
+		Where(qb.In("id")).
+		QueryContext(ctx, r.db).
+		Bind(ids).
+		SelectRelease(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user targets: %w", err)
+	}
+
+	return items, nil
+}
+
+// Iterate calls fn for every target, stopping at the first error.
+func (r *Repository) Iterate(ctx context.Context, fn func(targetModel) error) error {
+	iter := qb.Select(targetsTable.Name()).
+		Columns(targetsTable.Metadata().Columns...).
+		QueryContext(ctx, r.db).
+		Iter()
+
+	var m targetModel
+	for iter.StructScan(&m) {
+		if err := fn(m); err != nil {
+			_ = iter.Close()
+			return err
+		}
+		m = targetModel{} //nolint:exhaustruct // reset before the next scan
+	}
+
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("failed to iterate targets: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSecrets replaces the secrets envelope of the target as it was read,
+// it reports false when the target was updated or deleted since.
+func (r *Repository) UpdateSecrets(ctx context.Context, m targetModel, envelope secretEnvelopeUDT) (bool, error) {
+	update := targetModel{ID: m.ID, Secrets: envelope, UpdatedAt: m.UpdatedAt} //nolint:exhaustruct // updated columns only
+	applied, err := targetsTable.UpdateBuilder("secrets").
+		If(qb.Eq("updated_at")).
+		QueryContext(ctx, r.db).
+		BindStruct(update).
+		ExecCASRelease()
+	if err != nil {
+		return false, fmt.Errorf("failed to update target secrets: %w", err)
+	}
+
+	return applied, nil
+}
+
+// UpdateConfig replaces the check config and secrets envelope of the target as
+// it was read, it reports false when the target was updated or deleted since.
+func (r *Repository) UpdateConfig(
+	ctx context.Context,
+	m targetModel,
+	config checkConfigUDT,
+	envelope secretEnvelopeUDT,
+) (bool, error) {
+	update := targetModel{ //nolint:exhaustruct // updated columns only
+		ID:        m.ID,
+		Config:    config,
+		Secrets:   envelope,
+		UpdatedAt: m.UpdatedAt,
+	}
+	applied, err := targetsTable.UpdateBuilder("config", "secrets").
+		If(qb.Eq("updated_at")).
+		QueryContext(ctx, r.db).
+		BindStruct(update).
+		ExecCASRelease()
+	if err != nil {
+		return false, fmt.Errorf("failed to update target config: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (r *Repository) Delete(ctx context.Context, m targetModel) error {
+	batch := r.db.ContextBatch(ctx, gocql.LoggedBatch)
+
+	if err := batch.BindStruct(targetsTable.DeleteQueryContext(ctx, r.db), m); err != nil {
+		return fmt.Errorf("failed to bind target: %w", err)
+	}
+	if err := batch.BindStruct(targetsByUserTable.DeleteQueryContext(ctx, r.db), m.byUser()); err != nil {
+		return fmt.Errorf("failed to bind target index: %w", err)
+	}
+
+	if err := r.db.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("failed to delete target: %w", err)
+	}
+
+	return nil
+}
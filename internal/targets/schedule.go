@@ -0,0 +1,118 @@
+package targets
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule computes the check times of a target.
+type Schedule interface {
+	// Next returns the first run after the given time.
+	Next(after time.Time) time.Time
+	// Key identifies the schedule settings, it changes when they do.
+	Key() string
+}
+
+// Schedule returns the check schedule of the target: the cron expression when
+// set, the check interval otherwise.
+func (t Target) Schedule() (Schedule, error) {
+	if t.Cron == "" {
+		return newIntervalSchedule(t.ID, time.Duration(t.IntervalSeconds)*time.Second), nil
+	}
+
+	return newCronSchedule(t.Cron, t.Timezone)
+}
+
+// NextRuns returns the next n runs of the schedule after the given time.
+func NextRuns(s Schedule, after time.Time, n int) []time.Time {
+	runs := make([]time.Time, 0, n)
+	for range n {
+		after = s.Next(after)
+		if after.IsZero() {
+			break
+		}
+		runs = append(runs, after)
+	}
+
+	return runs
+}
+
+// intervalSchedule runs at a fixed interval.
+//
+// Runs are aligned to the interval and shifted by an offset derived from the
+// target ID, so every replica computes the same times and targets sharing an
+// interval are spread over it.
+type intervalSchedule struct {
+	interval time.Duration
+	offset   time.Duration
+}
+
+func newIntervalSchedule(id gocql.UUID, interval time.Duration) *intervalSchedule {
+	h := fnv.New64a()
+	_, _ = h.Write(id.Bytes())
+
+	return &intervalSchedule{
+		interval: interval,
+		offset:   time.Duration(h.Sum64() % uint64(max(interval, 1))).Truncate(time.Millisecond), //nolint:gosec // positive
+	}
+}
+
+func (s *intervalSchedule) Next(after time.Time) time.Time {
+	if s.interval <= 0 {
+		return time.Time{}
+	}
+
+	next := after.Truncate(s.interval).Add(s.offset)
+	if !next.After(after) {
+		next = next.Add(s.interval)
+	}
+
+	return next
+}
+
+func (s *intervalSchedule) Key() string {
+	return s.interval.String()
+}
+
+// cronSchedule runs at the times matching a cron expression in a timezone.
+type cronSchedule struct {
+	spec     string
+	location *time.Location
+	schedule cron.Schedule
+}
+
+func newCronSchedule(spec, timezone string) (*cronSchedule, error) {
+	if timezone == "Local" {
+		// Replicas may run in different zones.
+		return nil, fmt.Errorf("%w: timezone must be an IANA name", ErrValidation)
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid timezone %q: %w", ErrValidation, timezone, err)
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cron expression %q: %w", ErrValidation, spec, err)
+	}
+
+	return &cronSchedule{
+		spec:     spec,
+		location: location,
+		schedule: schedule,
+	}, nil
+}
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	return s.schedule.Next(after.In(s.location))
+}
+
+func (s *cronSchedule) Key() string {
+	return strconv.Quote(s.spec) + " " + s.location.String()
+}
@@ -0,0 +1,174 @@
+package targets
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+
+	"github.com/pingplex/pingplex/internal/checker"
+)
+
+// Redacted replaces secret values in API responses. Sending it back on update
+// keeps the stored secret.
+const Redacted = "[redacted]"
+
+// targetSecrets holds the sensitive part of a check config, it is stored
+// encrypted in the targets.secrets envelope.
+type targetSecrets struct {
+	Headers          map[string]string `json:"headers,omitempty"`
+	Body             string            `json:"body,omitempty"`
+	ProxyURL         string            `json:"proxy_url,omitempty"`
+	AuthPassword     string            `json:"auth_password,omitempty"`
+	AuthToken        string            `json:"auth_token,omitempty"`
+	AuthClientSecret string            `json:"auth_client_secret,omitempty"`
+	ClientKey        string            `json:"client_key,omitempty"`
+}
+
+func (s targetSecrets) IsEmpty() bool {
+	return len(s.Headers) == 0 &&
+		s.Body == "" &&
+		s.ProxyURL == "" &&
+		s.AuthPassword == "" &&
+		s.AuthToken == "" &&
+		s.AuthClientSecret == "" &&
+		s.ClientKey == ""
+}
+
+// splitSecrets moves the sensitive values out of the config, leaving
+// placeholders in their place.
+func splitSecrets(config checker.CheckConfig) (checker.CheckConfig, targetSecrets) {
+	secrets := targetSecrets{
+		Headers:          nil,
+		Body:             config.Body,
+		ProxyURL:         "",
+		AuthPassword:     config.Auth.Password,
+		AuthToken:        config.Auth.Token,
+		AuthClientSecret: config.Auth.ClientSecret,
+		ClientKey:        config.ClientKey,
+	}
+
+	if len(config.Headers) > 0 {
+		secrets.Headers = maps.Clone(config.Headers)
+		config.Headers = make(map[string]string, len(secrets.Headers))
+		for k := range secrets.Headers {
+			config.Headers[k] = Redacted
+		}
+	}
+
+	if u, err := url.Parse(config.ProxyURL); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			secrets.ProxyURL = config.ProxyURL
+			config.ProxyURL = u.Redacted()
+		}
+	}
+
+	config.Body = redact(config.Body)
+	config.Auth.Password = redact(config.Auth.Password)
+	config.Auth.Token = redact(config.Auth.Token)
+	config.Auth.ClientSecret = redact(config.Auth.ClientSecret)
+	config.ClientKey = redact(config.ClientKey)
+
+	return config, secrets
+}
+
+// keepRedacted replaces placeholders with the stored secrets. Placeholders
+// without a stored secret are left in place.
+func keepRedacted(config checker.CheckConfig, stored targetSecrets) checker.CheckConfig {
+	if len(config.Headers) > 0 {
+		headers := make(map[string]string, len(config.Headers))
+		for k, v := range config.Headers {
+			if storedValue, ok := stored.Headers[k]; ok && v == Redacted {
+				v = storedValue
+			}
+			headers[k] = v
+		}
+		config.Headers = headers
+	}
+
+	if stored.ProxyURL != "" {
+		if u, err := url.Parse(stored.ProxyURL); err == nil && config.ProxyURL == u.Redacted() {
+			config.ProxyURL = stored.ProxyURL
+		}
+	}
+
+	config.Body = keep(config.Body, stored.Body)
+	config.Auth.Password = keep(config.Auth.Password, stored.AuthPassword)
+	config.Auth.Token = keep(config.Auth.Token, stored.AuthToken)
+	config.Auth.ClientSecret = keep(config.Auth.ClientSecret, stored.AuthClientSecret)
+	config.ClientKey = keep(config.ClientKey, stored.ClientKey)
+
+	return config
+}
+
+// forDestination drops the stored secrets sent to a destination that changed,
+// so pointing a target elsewhere requires entering them again. Proxy
+// credentials are only kept for the same proxy URL anyway.
+func (s targetSecrets) forDestination(urlChanged, tokenURLChanged bool) targetSecrets {
+	if urlChanged {
+		// The access token obtained with the client secret is sent to the url too.
+		return targetSecrets{
+			Headers:          nil,
+			Body:             "",
+			ProxyURL:         s.ProxyURL,
+			AuthPassword:     "",
+			AuthToken:        "",
+			AuthClientSecret: "",
+			ClientKey:        "",
+		}
+	}
+	if tokenURLChanged {
+		s.AuthClientSecret = ""
+	}
+
+	return s
+}
+
+// hasPlaceholders reports whether the config still holds placeholders.
+func hasPlaceholders(config checker.CheckConfig) bool {
+	for _, v := range config.Headers {
+		if v == Redacted {
+			return true
+		}
+	}
+
+	return slices.Contains([]string{
+		config.Body, config.Auth.Password, config.Auth.Token, config.Auth.ClientSecret, config.ClientKey,
+	}, Redacted)
+}
+
+// hasPlaintext reports whether the config holds secrets in the clear, as
+// stored by targets saved before secrets were sealed.
+func hasPlaintext(config checker.CheckConfig) bool {
+	_, plain := splitSecrets(config)
+
+	for _, v := range plain.Headers {
+		if v != Redacted {
+			return true
+		}
+	}
+
+	if plain.ProxyURL != "" {
+		// A redacted proxy URL is left as is by redacting it again.
+		if u, err := url.Parse(plain.ProxyURL); err == nil && u.Redacted() != plain.ProxyURL {
+			return true
+		}
+	}
+
+	return slices.ContainsFunc([]string{
+		plain.Body, plain.AuthPassword, plain.AuthToken, plain.AuthClientSecret, plain.ClientKey,
+	}, func(v string) bool { return v != "" && v != Redacted })
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return Redacted
+}
+
+func keep(value, stored string) string {
+	if value == Redacted && stored != "" {
+		return stored
+	}
+	return value
+}
@@ -0,0 +1,411 @@
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pingplex/pingplex/internal/checker"
+	"github.com/pingplex/pingplex/internal/events"
+	"github.com/pingplex/pingplex/internal/secrets"
+	"go.uber.org/zap"
+)
+
+const (
+	maxRetries           = 10
+	defaultRetryInterval = 10 * time.Second
+	// cronProbeRuns is the number of runs checked against the minimum interval
+	cronProbeRuns = 10
+)
+
+// Service manages targets.
+//
+// Check config credentials are stored encrypted. Every method returns them
+// redacted, except CheckTarget, which is meant for the checks only.
+type Service struct {
+	config Config
+
+	targets *Repository
+	secrets *secrets.Service
+	checks  *checker.Service
+	events  *events.Service
+
+	logger *zap.Logger
+}
+
+func NewService(
+	config Config,
+	targets *Repository,
+	secrets *secrets.Service,
+	checks *checker.Service,
+	events *events.Service,
+	logger *zap.Logger,
+) *Service {
+	return &Service{
+		config: config,
+
+		targets: targets,
+		secrets: secrets,
+		checks:  checks,
+		events:  events,
+
+		logger: logger,
+	}
+}
+
+func (s *Service) Create(ctx context.Context, input TargetInput) (Target, error) {
+	input = s.withDefaults(input)
+	if err := s.validate(input); err != nil {
+		return Target{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	target := Target{
+		ID:              gocql.MustRandomUUID(),
+		UserID:          input.UserID,
+		Name:            input.Name,
+		Type:            input.Type,
+		URL:             input.URL,
+		Config:          input.Config,
+		IntervalSeconds: input.IntervalSeconds,
+		Cron:            input.Cron,
+		Timezone:        input.Timezone,
+		Retry:           input.Retry,
+		Locations:       input.Locations,
+		Tags:            input.Tags,
+		Enabled:         input.Enabled,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	return s.save(ctx, target)
+}
+
+// Get returns the target with redacted credentials.
+func (s *Service) Get(ctx context.Context, id gocql.UUID) (Target, error) {
+	m, err := s.targets.Get(ctx, id)
+	if err != nil {
+		return Target{}, err
+	}
+
+	return m.redacted(), nil
+}
+
+// ListByUser returns the user's targets with redacted credentials.
+func (s *Service) ListByUser(ctx context.Context, userID gocql.UUID) ([]Target, error) {
+	items, err := s.targets.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Target, len(items))
+	for i, m := range items {
+		result[i] = m.redacted()
+	}
+
+	return result, nil
+}
+
+// Update replaces the target settings. Redacted placeholders in the input
+// config keep the stored credentials, unless the url or the token url they are
+// sent to changes.
+func (s *Service) Update(ctx context.Context, id gocql.UUID, input TargetInput) (Target, error) {
+	input = s.withDefaults(input)
+	if err := s.validate(input); err != nil {
+		return Target{}, err
+	}
+
+	m, err := s.targets.Get(ctx, id)
+	if err != nil {
+		return Target{}, err
+	}
+
+	target, err := s.unseal(m)
+	if err != nil {
+		return Target{}, err
+	}
+
+	_, stored := splitSecrets(target.Config)
+	stored = stored.forDestination(input.URL != m.URL, input.Config.Auth.TokenURL != m.Config.Auth.TokenURL)
+
+	config := keepRedacted(input.Config, stored)
+	if hasPlaceholders(config) {
+		return Target{}, fmt.Errorf("%w: credentials must be entered again when url or tokenUrl changes", ErrValidation)
+	}
+
+	target.Name = input.Name
+	target.Type = input.Type
+	target.URL = input.URL
+	target.Config = config
+	target.IntervalSeconds = input.IntervalSeconds
+	target.Cron = input.Cron
+	target.Timezone = input.Timezone
+	target.Retry = input.Retry
+	target.Locations = input.Locations
+	target.Tags = input.Tags
+	target.Enabled = input.Enabled
+	target.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+
+	if target.UserID != input.UserID {
+		// The owner is part of the index key, drop the stale index entry first.
+		if delErr := s.targets.Delete(ctx, m); delErr != nil {
+			return Target{}, delErr
+		}
+		target.UserID = input.UserID
+	}
+
+	return s.save(ctx, target)
+}
+
+func (s *Service) Delete(ctx context.Context, id gocql.UUID) error {
+	m, err := s.targets.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if delErr := s.targets.Delete(ctx, m); delErr != nil {
+		return delErr
+	}
+
+	s.notify(ctx, events.TypeTargetDeleted, id)
+
+	return nil
+}
+
+// ForEach calls fn for every target, with redacted credentials, stopping at
+// the first error.
+func (s *Service) ForEach(ctx context.Context, fn func(Target) error) error {
+	return s.targets.Iterate(ctx, func(m targetModel) error {
+		return fn(m.redacted())
+	})
+}
+
+// CheckTarget returns the target with decrypted credentials.
+//
+// It must only be used to run checks, never to build API responses.
+func (s *Service) CheckTarget(ctx context.Context, id gocql.UUID) (Target, error) {
+	m, err := s.targets.Get(ctx, id)
+	if err != nil {
+		return Target{}, err
+	}
+
+	return s.unseal(m)
+}
+
+// RotateSecrets seals the credentials of targets stored in the clear and
+// re-wraps the data keys of targets sealed with a non-active master key. It
+// returns the number of updated targets and of the ones that failed, which
+// are logged and left for the next run. Targets changed meanwhile are skipped,
+// their update sealed them already.
+func (s *Service) RotateSecrets(ctx context.Context) (int, int, error) {
+	rotated, failed := 0, 0
+
+	err := s.targets.Iterate(ctx, func(m targetModel) error {
+		applied, err := s.rotate(ctx, m)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			s.logger.Warn("failed to rotate target secrets", zap.Stringer("target_id", m.ID), zap.Error(err))
+			failed++
+			return nil
+		}
+		if applied {
+			rotated++
+		}
+		return nil
+	})
+
+	return rotated, failed, err
+}
+
+// rotate seals or re-wraps the secrets of the target, it reports whether the
+// target was updated.
+func (s *Service) rotate(ctx context.Context, m targetModel) (bool, error) {
+	if hasPlaintext(m.Config.toDomain()) {
+		return s.sealPlaintext(ctx, m)
+	}
+
+	envelope := m.envelope()
+	if !s.secrets.NeedsRewrap(envelope) {
+		return false, nil
+	}
+
+	rewrapped, err := s.secrets.Rewrap(envelope)
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrap secrets: %w", err)
+	}
+
+	return s.targets.UpdateSecrets(ctx, m, newSecretEnvelopeUDT(rewrapped))
+}
+
+// sealPlaintext moves the credentials of a target stored in the clear into its
+// secrets envelope, merging them with the sealed ones.
+func (s *Service) sealPlaintext(ctx context.Context, m targetModel) (bool, error) {
+	target, err := s.unseal(m)
+	if err != nil {
+		return false, err
+	}
+
+	redacted, envelope, err := s.seal(target)
+	if err != nil {
+		return false, fmt.Errorf("failed to seal plaintext secrets: %w", err)
+	}
+
+	return s.targets.UpdateConfig(ctx, m, newCheckConfigUDT(redacted), newSecretEnvelopeUDT(envelope))
+}
+
+// unseal returns the target with its credentials restored. Credentials stored
+// in the clear are kept as is.
+func (s *Service) unseal(m targetModel) (Target, error) {
+	stored, err := s.openSecrets(m)
+	if err != nil {
+		return Target{}, err
+	}
+
+	target := m.toDomain()
+	target.Config = keepRedacted(target.Config, stored)
+
+	return target, nil
+}
+
+// seal splits the target credentials out of its config and seals them.
+func (s *Service) seal(target Target) (checker.CheckConfig, secrets.Envelope, error) {
+	redacted, plain := splitSecrets(target.Config)
+	if plain.IsEmpty() {
+		return redacted, secrets.Envelope{}, nil
+	}
+
+	payload, err := json.Marshal(plain)
+	if err != nil {
+		return redacted, secrets.Envelope{}, fmt.Errorf("failed to encode secrets: %w", err)
+	}
+
+	envelope, err := s.secrets.Seal(payload, target.ID.Bytes())
+	if errors.Is(err, secrets.ErrNoActiveKey) {
+		return redacted, secrets.Envelope{}, fmt.Errorf("%w: credentials cannot be stored: %w", ErrValidation, err)
+	}
+	if err != nil {
+		return redacted, secrets.Envelope{}, fmt.Errorf("failed to seal secrets: %w", err)
+	}
+
+	return redacted, envelope, nil
+}
+
+// save seals the target credentials and persists it, returning the redacted target.
+func (s *Service) save(ctx context.Context, target Target) (Target, error) {
+	redacted, envelope, err := s.seal(target)
+	if err != nil {
+		return Target{}, err
+	}
+
+	target.Config = redacted
+	if saveErr := s.targets.Save(ctx, newTargetModel(target, envelope)); saveErr != nil {
+		return Target{}, saveErr
+	}
+
+	s.notify(ctx, events.TypeTargetUpdated, target.ID)
+
+	return target, nil
+}
+
+// notify publishes a target change, so schedulers pick it up without waiting for a resync.
+func (s *Service) notify(ctx context.Context, t events.Type, id gocql.UUID) {
+	if err := s.events.Publish(ctx, events.New(t, id, time.Now(), nil)); err != nil {
+		s.logger.Warn("failed to publish target change", zap.Stringer("target_id", id), zap.Error(err))
+	}
+}
+
+func (s *Service) openSecrets(m targetModel) (targetSecrets, error) {
+	var stored targetSecrets
+
+	envelope := m.envelope()
+	if envelope.IsZero() {
+		return stored, nil
+	}
+
+	payload, err := s.secrets.Open(envelope, m.ID.Bytes())
+	if err != nil {
+		return stored, fmt.Errorf("failed to open secrets of target %s: %w", m.ID, err)
+	}
+
+	if jsonErr := json.Unmarshal(payload, &stored); jsonErr != nil {
+		return stored, fmt.Errorf("failed to decode secrets of target %s: %w", m.ID, jsonErr)
+	}
+
+	return stored, nil
+}
+
+func (s *Service) withDefaults(input TargetInput) TargetInput {
+	if input.IntervalSeconds == 0 {
+		input.IntervalSeconds = s.config.DefaultIntervalSeconds
+	}
+	if input.Retry.Retries > 0 && input.Retry.Interval == 0 {
+		input.Retry.Interval = defaultRetryInterval
+	}
+
+	return input
+}
+
+func (s *Service) validate(input TargetInput) error {
+	if !s.checks.Supports(input.Type) {
+		return fmt.Errorf("%w: %s: %q", ErrValidation, checker.ErrUnsupportedType, input.Type)
+	}
+
+	if input.Type != checker.TypeExec && input.URL == "" {
+		return fmt.Errorf("%w: url is required", ErrValidation)
+	}
+
+	if input.Type == checker.TypeExec && input.Config.Command == "" {
+		return fmt.Errorf("%w: command is required for exec targets", ErrValidation)
+	}
+
+	if input.Config.DualStack && (input.Type == checker.TypeExec || input.Config.ProxyURL != "") {
+		return fmt.Errorf("%w: dual-stack checks are not supported for exec or proxied targets", ErrValidation)
+	}
+
+	if input.Config.Selector != "" && input.Config.JSONPath != "" {
+		return fmt.Errorf("%w: selector and jsonPath are mutually exclusive", ErrValidation)
+	}
+
+	if input.Retry.Retries < 0 || input.Retry.Retries > maxRetries {
+		return fmt.Errorf("%w: retries must be between 0 and %d", ErrValidation, maxRetries)
+	}
+
+	if input.Cron != "" {
+		return s.validateCron(input.Cron, input.Timezone)
+	}
+	if input.Timezone != "" {
+		return fmt.Errorf("%w: timezone requires a cron schedule", ErrValidation)
+	}
+
+	if input.IntervalSeconds < s.config.MinIntervalSeconds {
+		return fmt.Errorf("%w: interval must be at least %d seconds", ErrValidation, s.config.MinIntervalSeconds)
+	}
+
+	return nil
+}
+
+// validateCron checks that the expression parses and does not run more often
+// than the minimum interval.
+func (s *Service) validateCron(spec, timezone string) error {
+	schedule, err := newCronSchedule(spec, timezone)
+	if err != nil {
+		return err
+	}
+
+	runs := NextRuns(schedule, time.Now(), cronProbeRuns)
+	if len(runs) == 0 {
+		return fmt.Errorf("%w: cron expression %q never runs", ErrValidation, spec)
+	}
+	for i := 1; i < len(runs); i++ {
+		if runs[i].Sub(runs[i-1]) < time.Duration(s.config.MinIntervalSeconds)*time.Second {
+			return fmt.Errorf("%w: cron runs must be at least %d seconds apart", ErrValidation, s.config.MinIntervalSeconds)
+		}
+	}
+
+	return nil
+}
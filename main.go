@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"runtime"
 	"strconv"
 
@@ -19,11 +20,18 @@ var (
 )
 
 func main() {
-	internal.Run(healthfx.Version{
+	version := healthfx.Version{
 		Version:   appVersion,
 		ReleaseID: lo.Must1(strconv.Atoi(appReleaseID)),
 		BuildDate: appBuildDate,
 		GitCommit: appGitCommit,
 		GoVersion: appGoVersion,
-	})
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		internal.RunAgent(version)
+		return
+	}
+
+	internal.Run(version)
 }